@@ -5,25 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path"
+	"sync"
 	"time"
 
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
 	"github.com/dweymouth/supersonic/backend/util"
 	"github.com/dweymouth/supersonic/player"
 	"github.com/dweymouth/supersonic/sharedutil"
-	"github.com/fsnotify/fsnotify"
 	"github.com/google/uuid"
 
 	"github.com/20after4/configdir"
 	"github.com/zalando/go-keyring"
 )
 
-const (
-	sessionDir          = "session"
-	sessionLockFile     = ".lock"
-	sessionActivateFile = ".activate"
-)
+const sessionDir = "session"
 
 var (
 	ErrNoServers       = errors.New("no servers set up")
@@ -35,61 +33,69 @@ type App struct {
 	ServerManager   *ServerManager
 	ImageManager    *ImageManager
 	PlaybackManager *PlaybackManager
+	UndoManager     *UndoManager
+	History         *ListeningHistory
+	ScrobbleQueue   *ScrobbleQueue
 	Player          *player.Player
 	UpdateChecker   UpdateChecker
 	MPRISHandler    *MPRISHandler
+	ListenBrainz    *ListenBrainzScrobbler
+	LastFM          *LastFMScrobbler
+	DiscordRPC      *DiscordRichPresence
+	RemoteControl   *RemoteControlServer
+	TrackNotifier   *TrackNotifier
 	MPMediaHandler  *MPMediaHandler
 
 	// UI callbacks to be set in main
 	OnReactivate func()
 	OnExit       func()
+	// shows the page of the item linked by a (non-play) supersonic:// link
+	OnOpenDeepLink func(DeepLink)
 
 	appName       string
 	appVersionTag string
 	configFile    string
 	bgrndCtx      context.Context
 	cancel        context.CancelFunc
+
+	// the audio device in use, which is "auto" if the
+	// configured device is not currently available
+	audioDeviceLock       sync.Mutex
+	activeAudioDevice     string
+	onAudioDevicesChanged []func([]player.AudioDevice)
+	// signaled by the player when the list of audio devices changes
+	audioDevicesChanged chan struct{}
+
+	// listener on the IPC socket, nil if another instance has it
+	ipcListener net.Listener
+
+	// link opened before connecting to a server
+	pendingLinkLock sync.Mutex
+	pendingLink     *DeepLink
 }
 
 func (a *App) VersionTag() string {
 	return a.appVersionTag
 }
 
-func StartupApp(appName, displayAppName, appVersionTag, configFile, latestReleaseURL string) (*App, error) {
-	sessionPath := configdir.LocalConfig(appName, sessionDir)
-	if _, err := os.Stat(path.Join(sessionPath, sessionLockFile)); err == nil {
-		log.Println("Another instance is running. Reactivating it...")
-		reactivateFile := path.Join(sessionPath, sessionActivateFile)
-		if f, err := os.Create(reactivateFile); err == nil {
-			f.Close()
-		}
-		time.Sleep(750 * time.Millisecond)
-		if _, err := os.Stat(reactivateFile); err == nil {
-			log.Println("No other instance responded. Starting as normal...")
-			os.RemoveAll(sessionPath)
-		} else {
-			return nil, ErrAnotherInstance
-		}
+// Starts the app. If openURI is not empty, it is a supersonic:// link
+// to open once connected, which is handed off to the running instance
+// if there is one.
+func StartupApp(appName, displayAppName, appVersionTag, configFile, latestReleaseURL, openURI string) (*App, error) {
+	a := &App{appName: appName, appVersionTag: appVersionTag, configFile: configFile}
+	a.readConfig()
+
+	// Listen on the IPC socket right away, so that other instances started
+	// meanwhile hand off to this one, but don't serve requests until set up.
+	if err := a.startIPC(openURI); err != nil {
+		return nil, err
 	}
 
 	log.Printf("Starting %s...", appName)
 	log.Printf("Using config dir: %s", configdir.LocalConfig(appName))
 	log.Printf("Using cache dir: %s", configdir.LocalCache(appName))
 
-	a := &App{appName: appName, appVersionTag: appVersionTag, configFile: configFile}
 	a.bgrndCtx, a.cancel = context.WithCancel(context.Background())
-	a.readConfig()
-
-	if !a.Config.Application.AllowMultiInstance {
-		log.Println("Creating session lock file")
-		os.MkdirAll(sessionPath, 0770)
-		if f, err := os.Create(path.Join(sessionPath, sessionLockFile)); err == nil {
-			f.Close()
-		} else {
-			log.Printf("error creating session file: %s", err.Error())
-		}
-		a.startSessionWatcher(sessionPath)
-	}
 
 	a.UpdateChecker = NewUpdateChecker(appVersionTag, latestReleaseURL, &a.Config.Application.LastCheckedVersion)
 	a.UpdateChecker.Start(a.bgrndCtx, 24*time.Hour)
@@ -102,7 +108,33 @@ func StartupApp(appName, displayAppName, appVersionTag, configFile, latestReleas
 	}
 
 	a.ServerManager = NewServerManager(appName, a.Config)
-	a.PlaybackManager = NewPlaybackManager(a.bgrndCtx, a.ServerManager, a.Player, &a.Config.Scrobbling)
+	a.ServerManager.OnServerConnected(a.openPendingLink)
+	a.UndoManager = NewUndoManager()
+	a.PlaybackManager = NewPlaybackManager(a.bgrndCtx, a.ServerManager, a.Player, &a.Config.Scrobbling, &a.Config.LocalPlayback, a.UndoManager)
+	a.PlaybackManager.SetReplayGainOptions(a.Config.ReplayGain)
+	a.ScrobbleQueue = NewScrobbleQueue(a.bgrndCtx, path.Join(configdir.LocalConfig(appName), scrobbleQueueFileName), a.ServerManager)
+	a.PlaybackManager.SetScrobbleQueue(a.ScrobbleQueue)
+	a.ListenBrainz = NewListenBrainzScrobbler(appName, appVersionTag, &a.Config.ListenBrainz, a.ServerManager)
+	a.PlaybackManager.AddScrobbler(a.ListenBrainz)
+	a.LastFM = NewLastFMScrobbler(appName, &a.Config.LastFM, a.ServerManager)
+	a.PlaybackManager.AddScrobbler(a.LastFM)
+	a.ServerManager.OnSetFavorite(func(params mediaprovider.RatingFavoriteParameters, favorite bool) {
+		if len(params.TrackIDs) > 0 {
+			go a.LastFM.SetTracksLoved(params.TrackIDs, favorite)
+		}
+	})
+	a.DiscordRPC = NewDiscordRichPresence(a.bgrndCtx, &a.Config.Discord, a.PlaybackManager, a.Player)
+	a.RemoteControl = NewRemoteControlServer(appName,
+		path.Join(configdir.LocalConfig(appName), remoteControlTokenFileName), &a.Config.RemoteControl, a.PlaybackManager, a.Player, a.ServerManager)
+	if a.Config.RemoteControl.Enabled {
+		if err := a.RemoteControl.Start(); err != nil {
+			log.Printf("error starting remote control API: %s", err.Error())
+		}
+	}
+	a.History = NewListeningHistory(path.Join(configdir.LocalConfig(appName), historyFileName))
+	a.PlaybackManager.OnPlayEnded(func(play TrackPlay) {
+		a.History.AddPlay(a.ServerManager.ServerID.String(), play)
+	})
 	a.ImageManager = NewImageManager(a.bgrndCtx, a.ServerManager, configdir.LocalCache(a.appName))
 	a.Config.Application.MaxImageCacheSizeMB = clamp(a.Config.Application.MaxImageCacheSizeMB, 1, 500)
 	a.ImageManager.SetMaxOnDiskCacheSizeBytes(int64(a.Config.Application.MaxImageCacheSizeMB) * 1_048_576)
@@ -110,9 +142,25 @@ func StartupApp(appName, displayAppName, appVersionTag, configFile, latestReleas
 		_, _ = a.ImageManager.GetCoverThumbnail(coverID)
 	})
 
+	a.audioDevicesChanged = make(chan struct{}, 1)
+	a.Player.OnAudioDevicesChanged(a.signalAudioDevicesChanged)
+	go a.watchAudioDevices(a.bgrndCtx)
+
+	a.TrackNotifier = NewTrackNotifier(displayAppName, &a.Config.Application, a.PlaybackManager, a.Player)
+	a.TrackNotifier.CoverLookup = a.ImageManager.GetCoverThumbnail
+
 	a.setupMPRIS(displayAppName)
 	a.setupMPMedia()
 
+	if openURI != "" {
+		if err := a.OpenURI(openURI); err != nil {
+			log.Printf("error opening link: %s", err.Error())
+		}
+	}
+	if a.ipcListener != nil {
+		go serveIPC(a.bgrndCtx, a.ipcListener, a.handleIPCRequest)
+	}
+
 	return a, nil
 }
 
@@ -132,30 +180,67 @@ func (a *App) readConfig() {
 	a.Config = cfg
 }
 
-func (a *App) startSessionWatcher(sessionPath string) {
-	if sessionWatch, err := fsnotify.NewWatcher(); err == nil {
-		sessionWatch.Add(sessionPath)
+func (a *App) callOnReactivate() {
+	if a.OnReactivate != nil {
+		a.OnReactivate()
+	}
+}
+
+// Opens a supersonic:// link, playing the linked item for play links
+// or else showing its page. If not yet connected to a server,
+// the link is opened once the connection is made.
+func (a *App) OpenURI(uri string) error {
+	link, err := ParseDeepLink(uri)
+	if err != nil {
+		return err
+	}
+	a.pendingLinkLock.Lock()
+	if a.ServerManager.Server == nil {
+		a.pendingLink = &link
+		a.pendingLinkLock.Unlock()
+		return nil
+	}
+	a.pendingLinkLock.Unlock()
+	return a.openDeepLink(link)
+}
+
+func (a *App) openPendingLink() {
+	a.pendingLinkLock.Lock()
+	link := a.pendingLink
+	a.pendingLink = nil
+	a.pendingLinkLock.Unlock()
+	if link != nil {
 		go func() {
-			for {
-				select {
-				case <-a.bgrndCtx.Done():
-					return
-				case <-sessionWatch.Events:
-					activatePath := path.Join(sessionPath, sessionActivateFile)
-					if _, err := os.Stat(activatePath); err == nil {
-						os.Remove(path.Join(sessionPath, sessionActivateFile))
-						a.callOnReactivate()
-					}
-				}
+			if err := a.openDeepLink(*link); err != nil {
+				log.Printf("error opening link: %s", err.Error())
 			}
 		}()
 	}
 }
 
-func (a *App) callOnReactivate() {
-	if a.OnReactivate != nil {
-		a.OnReactivate()
+func (a *App) openDeepLink(link DeepLink) error {
+	if !link.Play {
+		if a.OnOpenDeepLink != nil {
+			a.OnOpenDeepLink(link)
+		}
+		return nil
 	}
+	switch link.Kind {
+	case DeepLinkAlbum:
+		return a.PlaybackManager.PlayAlbum(link.ID, 0, false)
+	case DeepLinkPlaylist:
+		return a.PlaybackManager.PlayPlaylist(link.ID, 0, false)
+	case DeepLinkTrack:
+		tr, err := a.ServerManager.Server.GetTrack(link.ID)
+		if err != nil {
+			return err
+		}
+		if err := a.PlaybackManager.LoadTracks([]*mediaprovider.Track{tr}, false, false); err != nil {
+			return err
+		}
+		return a.PlaybackManager.PlayFromBeginning()
+	}
+	return fmt.Errorf("unsupported link: %s", link.String())
 }
 
 func (a *App) initMPV() error {
@@ -179,47 +264,93 @@ func (a *App) setupMPV() error {
 	}
 
 	desiredDevice := a.Config.LocalPlayback.AudioDeviceName
-	var desiredDeviceAvailable bool
-	for _, dev := range devs {
-		if dev.Name == desiredDevice {
-			desiredDeviceAvailable = true
-			break
-		}
-	}
-	if !desiredDeviceAvailable {
+	if !haveAudioDevice(devs, desiredDevice) {
 		// The audio device the user has configured is not available.
 		// Use the default (autoselect) device but leave the setting unchanged,
-		// in case the device is later available on a subsequent run of the app
-		// (e.g. a USB audio device that is currently unplugged)
+		// in case the device is later available (e.g. a USB audio device
+		// that is currently unplugged). See handleAudioDevicesChanged.
 		desiredDevice = "auto"
 	}
 	a.Player.SetAudioDevice(desiredDevice)
+	a.activeAudioDevice = desiredDevice
+	a.Config.LocalPlayback.ApplyDeviceEqualizerProfile(desiredDevice)
 
-	rgainOpts := []string{ReplayGainNone, ReplayGainAlbum, ReplayGainTrack}
+	rgainOpts := []string{ReplayGainNone, ReplayGainAlbum, ReplayGainTrack, ReplayGainDynamic}
 	if !sharedutil.SliceContains(rgainOpts, a.Config.ReplayGain.Mode) {
 		a.Config.ReplayGain.Mode = ReplayGainNone
 	}
-	a.Player.SetReplayGainOptions(player.ReplayGainOptions{
-		Mode:            player.ReplayGainMode(a.Config.ReplayGain.Mode),
-		PreventClipping: a.Config.ReplayGain.PreventClipping,
-		PreampGain:      a.Config.ReplayGain.PreampGainDB,
-	})
 	a.Player.SetAudioExclusive(a.Config.LocalPlayback.AudioExclusive)
+	a.Config.LocalPlayback.CrossfadeSeconds = clamp(a.Config.LocalPlayback.CrossfadeSeconds, 0, 12)
+	a.Player.SetCrossfadeDuration(float64(a.Config.LocalPlayback.CrossfadeSeconds))
 
-	eq := &player.ISO15BandEqualizer{
-		EQPreamp: a.Config.LocalPlayback.EqualizerPreamp,
-		Disabled: !a.Config.LocalPlayback.EqualizerEnabled,
+	a.Player.SetEqualizer(EqualizerFromConfig(&a.Config.LocalPlayback))
+
+	return nil
+}
+
+// Switches to the given audio device, and applies the
+// equalizer profile associated with the device, if any.
+func (a *App) SetAudioDevice(deviceName string) error {
+	if err := a.Player.SetAudioDevice(deviceName); err != nil {
+		return err
 	}
-	copy(eq.BandGains[:], a.Config.LocalPlayback.GraphicEqualizerBands)
-	a.Player.SetEqualizer(eq)
+	a.audioDeviceLock.Lock()
+	a.activeAudioDevice = deviceName
+	a.audioDeviceLock.Unlock()
+	return a.ApplyDeviceEqualizerProfile(deviceName)
+}
 
+// Applies the equalizer profile associated with the audio device, if any.
+func (a *App) ApplyDeviceEqualizerProfile(deviceName string) error {
+	if a.Config.LocalPlayback.ApplyDeviceEqualizerProfile(deviceName) {
+		return a.Player.SetEqualizer(EqualizerFromConfig(&a.Config.LocalPlayback))
+	}
 	return nil
 }
 
+// Returns a new Equalizer of the type, and with the settings, from the config.
+func EqualizerFromConfig(c *LocalPlaybackConfig) player.Equalizer {
+	if c.EqualizerType == EqualizerTypeParametric {
+		eq := &player.ParametricEqualizer{
+			Disabled: !c.EqualizerEnabled,
+			EQPreamp: c.ParametricEqualizerPreamp,
+		}
+		for _, b := range c.ParametricEqualizerBands {
+			eq.Bands = append(eq.Bands, player.ParametricEQBand{
+				Type:      player.FilterType(b.Type),
+				Frequency: b.Frequency,
+				Gain:      b.Gain,
+				Q:         b.Q,
+			})
+		}
+		return eq
+	}
+	eq := &player.ISO15BandEqualizer{
+		EQPreamp: c.EqualizerPreamp,
+		Disabled: !c.EqualizerEnabled,
+	}
+	copy(eq.BandGains[:], c.GraphicEqualizerBands)
+	return eq
+}
+
 func (a *App) setupMPRIS(mprisAppName string) {
 	a.MPRISHandler = NewMPRISHandler(mprisAppName, a.Player, a.PlaybackManager)
 	a.MPRISHandler.ArtURLLookup = a.ImageManager.GetCoverArtUrl
+	a.MPRISHandler.TrackLookup = func(trackID string) (*mediaprovider.Track, error) {
+		if a.ServerManager.Server == nil {
+			return nil, ErrNoServers
+		}
+		return a.ServerManager.Server.GetTrack(trackID)
+	}
+	a.MPRISHandler.PlaylistsLookup = func() ([]*mediaprovider.Playlist, error) {
+		if a.ServerManager.Server == nil {
+			return nil, nil
+		}
+		return a.ServerManager.Server.GetPlaylists()
+	}
+	a.ServerManager.OnLogout(a.MPRISHandler.clearPlaylistsCache)
 	a.MPRISHandler.OnRaise = func() error { a.callOnReactivate(); return nil }
+	a.MPRISHandler.OnOpenURI = a.OpenURI
 	a.MPRISHandler.OnQuit = func() error {
 		if a.OnExit == nil {
 			return errors.New("no quit handler registered")
@@ -264,13 +395,19 @@ func (a *App) DeleteServerCacheDir(serverID uuid.UUID) error {
 
 func (a *App) Shutdown() {
 	a.MPRISHandler.Shutdown()
+	a.RemoteControl.Stop()
 	a.PlaybackManager.DisableCallbacks()
+	// restores the original volume if the sleep timer is fading out
+	a.PlaybackManager.CancelSleepTimer()
 	a.Player.Stop() // will trigger scrobble check
 	a.Config.LocalPlayback.Volume = a.Player.GetVolume()
 	a.cancel()
 	a.Player.Destroy()
 	a.Config.WriteConfigFile(a.configPath())
-	os.RemoveAll(configdir.LocalConfig(a.appName, sessionDir))
+	if a.ipcListener != nil {
+		// removes the socket, leaving that of any other instance in place
+		a.ipcListener.Close()
+	}
 }
 
 func (a *App) configPath() string {
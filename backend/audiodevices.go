@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"context"
+	"log"
+
+	"github.com/dweymouth/supersonic/player"
+)
+
+// Registers a callback which is invoked when the list of available
+// audio devices changes, after any resulting device switch has been made.
+// The callback is invoked from a background goroutine.
+func (a *App) OnAudioDevicesChanged(cb func(devices []player.AudioDevice)) {
+	a.onAudioDevicesChanged = append(a.onAudioDevicesChanged, cb)
+}
+
+// Invoked on the player's event loop, so the change is
+// handled on the watchAudioDevices goroutine instead.
+func (a *App) signalAudioDevicesChanged() {
+	select {
+	case a.audioDevicesChanged <- struct{}{}:
+	default:
+		// a change is already pending
+	}
+}
+
+func (a *App) watchAudioDevices(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.audioDevicesChanged:
+			a.handleAudioDevicesChanged()
+		}
+	}
+}
+
+// Switches to the configured audio device when it becomes available,
+// and falls back to the autoselect device when the active device is removed.
+func (a *App) handleAudioDevicesChanged() {
+	devs, err := a.Player.ListAudioDevices()
+	if err != nil {
+		log.Printf("error listing audio devices: %s", err.Error())
+		return
+	}
+
+	a.audioDeviceLock.Lock()
+	active := a.activeAudioDevice
+	a.audioDeviceLock.Unlock()
+	preferred := a.Config.LocalPlayback.AudioDeviceName
+
+	switch {
+	case preferred != active && haveAudioDevice(devs, preferred):
+		log.Printf("Audio device %q is available, switching to it", preferred)
+		if err := a.SetAudioDevice(preferred); err != nil {
+			log.Printf("error setting audio device: %s", err.Error())
+		}
+	case active != "auto" && !haveAudioDevice(devs, active):
+		log.Printf("Audio device %q was removed, switching to autoselect device", active)
+		if a.Config.LocalPlayback.PauseOnAudioDeviceRemoved &&
+			a.Player.GetStatus().State == player.Playing {
+			a.Player.Pause()
+		}
+		if err := a.SetAudioDevice("auto"); err != nil {
+			log.Printf("error setting audio device: %s", err.Error())
+		}
+	}
+
+	for _, cb := range a.onAudioDevicesChanged {
+		cb(devs)
+	}
+}
+
+func haveAudioDevice(devs []player.AudioDevice, name string) bool {
+	for _, dev := range devs {
+		if dev.Name == name {
+			return true
+		}
+	}
+	return false
+}
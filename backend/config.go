@@ -3,6 +3,7 @@ package backend
 import (
 	"os"
 
+	"github.com/dweymouth/supersonic/player"
 	"github.com/google/uuid"
 	"github.com/pelletier/go-toml/v2"
 )
@@ -22,15 +23,16 @@ type ServerConfig struct {
 }
 
 type AppConfig struct {
-	WindowWidth         int
-	WindowHeight        int
-	LastCheckedVersion  string
-	EnableSystemTray    bool
-	CloseToSystemTray   bool
-	StartupPage         string
-	SettingsTab         string
-	AllowMultiInstance  bool
-	MaxImageCacheSizeMB int
+	WindowWidth                  int
+	WindowHeight                 int
+	LastCheckedVersion           string
+	EnableSystemTray             bool
+	CloseToSystemTray            bool
+	StartupPage                  string
+	SettingsTab                  string
+	AllowMultiInstance           bool
+	MaxImageCacheSizeMB          int
+	ShowTrackChangeNotifications bool
 
 	// Experimental - may be removed in future
 	FontNormalTTF string
@@ -55,8 +57,13 @@ type FavoritesPageConfig struct {
 	TracklistColumns []string
 }
 
+type HistoryPageConfig struct {
+	ShowSkipped bool
+}
+
 type NowPlayingPageConfig struct {
 	TracklistColumns []string
+	ShowVisualizer   bool
 }
 
 type PlaylistPageConfig struct {
@@ -77,8 +84,36 @@ type LocalPlaybackConfig struct {
 	InMemoryCacheSizeMB   int
 	Volume                int
 	EqualizerEnabled      bool
+	EqualizerType         string
 	EqualizerPreamp       float64
 	GraphicEqualizerBands []float64
+	// Preamp and bands for EqualizerType "Parametric"
+	ParametricEqualizerPreamp float64
+	ParametricEqualizerBands  []ParametricEQBandConfig
+	// Name of the last applied or saved preset, if unchanged since
+	EqualizerPresetName string
+	EqualizerPresets    []EqualizerPresetConfig
+	// EQ preset to apply when switching to an audio device, by device name
+	DeviceEqualizerProfiles map[string]DeviceEqualizerProfile
+	// Pause playback when the active audio device is unplugged
+	PauseOnAudioDeviceRemoved bool
+	SleepTimerFadeOut         bool
+	CrossfadeSeconds          int
+	// Playback speed by track type (music, podcast, audiobook)
+	PlaybackSpeeds map[string]float64
+}
+
+type ParametricEQBandConfig struct {
+	Type      string // peak, lowshelf, or highshelf
+	Frequency int
+	Gain      float64
+	Q         float64
+}
+
+type DeviceEqualizerProfile struct {
+	Preset string
+	// overrides the preamp of the preset
+	Preamp float64
 }
 
 type ScrobbleConfig struct {
@@ -87,10 +122,45 @@ type ScrobbleConfig struct {
 	ThresholdPercent     int
 }
 
+// The ListenBrainz user token is stored in the keyring.
+type ListenBrainzConfig struct {
+	Enabled  bool
+	Username string
+}
+
+type DiscordConfig struct {
+	// Show the playing track as the Discord Rich Presence
+	Enabled bool
+	// Overrides the Discord application built into the app, if set
+	ClientID string `toml:",omitempty"`
+}
+
+// The API token is stored in the keyring, or a file in the config dir if it is unavailable.
+type RemoteControlConfig struct {
+	// Serve the HTTP remote control API on localhost
+	Enabled bool
+	Port    int
+}
+
+// The Last.fm session key is stored in the keyring.
+type LastFMConfig struct {
+	Enabled bool
+	// Love and unlove tracks on Last.fm when they are (un)favorited
+	SyncLoved bool
+	Username  string
+	// Overrides the API account built into the app, if set
+	APIKey    string `toml:",omitempty"`
+	APISecret string `toml:",omitempty"`
+}
+
 type ReplayGainConfig struct {
 	Mode            string
 	PreampGainDB    float64
 	PreventClipping bool
+	// Gain applied to tracks without ReplayGain metadata
+	FallbackGainDB float64
+	// Target RMS level in dBFS for the dynamic normalization mode
+	TargetLevelDB float64
 }
 
 type ThemeConfig struct {
@@ -105,18 +175,29 @@ type Config struct {
 	AlbumsPage     AlbumsPageConfig
 	ArtistPage     ArtistPageConfig
 	FavoritesPage  FavoritesPageConfig
+	HistoryPage    HistoryPageConfig
 	NowPlayingPage NowPlayingPageConfig
 	PlaylistPage   PlaylistPageConfig
 	PlaylistsPage  PlaylistsPageConfig
 	TracksPage     TracksPageConfig
 	LocalPlayback  LocalPlaybackConfig
 	Scrobbling     ScrobbleConfig
+	ListenBrainz   ListenBrainzConfig
+	LastFM         LastFMConfig
+	Discord        DiscordConfig
+	RemoteControl  RemoteControlConfig
 	ReplayGain     ReplayGainConfig
 	Theme          ThemeConfig
 }
 
 var SupportedStartupPages = []string{"Albums", "Favorites", "Playlists"}
 
+// Values of LocalPlaybackConfig.EqualizerType
+const (
+	EqualizerTypeGraphic    = "ISO15Band"
+	EqualizerTypeParametric = "Parametric"
+)
+
 func DefaultConfig(appVersionTag string) *Config {
 	return &Config{
 		Application: AppConfig{
@@ -146,6 +227,7 @@ func DefaultConfig(appVersionTag string) *Config {
 		},
 		NowPlayingPage: NowPlayingPageConfig{
 			TracklistColumns: []string{"Artist", "Album", "Time", "Plays"},
+			ShowVisualizer:   false,
 		},
 		PlaylistPage: PlaylistPageConfig{
 			TracklistColumns: []string{"Artist", "Album", "Time", "Plays"},
@@ -163,18 +245,28 @@ func DefaultConfig(appVersionTag string) *Config {
 			InMemoryCacheSizeMB:   30,
 			Volume:                100,
 			EqualizerEnabled:      false,
+			EqualizerType:         EqualizerTypeGraphic,
 			EqualizerPreamp:       0,
 			GraphicEqualizerBands: make([]float64, 15),
+			SleepTimerFadeOut:     true,
+			CrossfadeSeconds:      0,
 		},
 		Scrobbling: ScrobbleConfig{
 			Enabled:              true,
 			ThresholdTimeSeconds: 240,
 			ThresholdPercent:     50,
 		},
+		LastFM: LastFMConfig{
+			SyncLoved: true,
+		},
+		RemoteControl: RemoteControlConfig{
+			Port: remoteControlDefaultPort,
+		},
 		ReplayGain: ReplayGainConfig{
 			Mode:            ReplayGainNone,
 			PreampGainDB:    0.0,
 			PreventClipping: true,
+			TargetLevelDB:   player.DefaultTargetLevel,
 		},
 		Theme: ThemeConfig{
 			Appearance: "Dark",
@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URL scheme of the links to items in the library, eg.
+// supersonic://album/<id> or supersonic://play/track/<id>
+const DeepLinkScheme = "supersonic"
+
+type DeepLinkKind string
+
+const (
+	DeepLinkAlbum    DeepLinkKind = "album"
+	DeepLinkArtist   DeepLinkKind = "artist"
+	DeepLinkPlaylist DeepLinkKind = "playlist"
+	DeepLinkTrack    DeepLinkKind = "track"
+)
+
+var errInvalidDeepLink = errors.New("invalid " + DeepLinkScheme + ":// link")
+
+// A link to an item in the library, which either shows
+// the item's page or, if Play is set, starts playing it.
+type DeepLink struct {
+	Kind DeepLinkKind
+	ID   string
+	Play bool
+}
+
+// Parses a link of the form supersonic://<kind>/<id> (for albums,
+// artists and playlists) or supersonic://play/<kind>/<id> (for albums,
+// playlists and tracks).
+func ParseDeepLink(uri string) (DeepLink, error) {
+	prefix := DeepLinkScheme + "://"
+	if len(uri) < len(prefix) || !strings.EqualFold(uri[:len(prefix)], prefix) {
+		return DeepLink{}, errInvalidDeepLink
+	}
+	parts := strings.Split(strings.TrimSuffix(uri[len(prefix):], "/"), "/")
+	var link DeepLink
+	if parts[0] == "play" {
+		link.Play = true
+		parts = parts[1:]
+	}
+	if len(parts) != 2 || parts[1] == "" {
+		return DeepLink{}, errInvalidDeepLink
+	}
+	id, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return DeepLink{}, errInvalidDeepLink
+	}
+	link.Kind, link.ID = DeepLinkKind(parts[0]), id
+	switch link.Kind {
+	case DeepLinkAlbum, DeepLinkPlaylist:
+	case DeepLinkArtist:
+		if link.Play {
+			return DeepLink{}, fmt.Errorf("unsupported link: %s", uri)
+		}
+	case DeepLinkTrack:
+		if !link.Play {
+			return DeepLink{}, fmt.Errorf("unsupported link: %s", uri)
+		}
+	default:
+		return DeepLink{}, errInvalidDeepLink
+	}
+	return link, nil
+}
+
+func (l DeepLink) String() string {
+	s := DeepLinkScheme + "://"
+	if l.Play {
+		s += "play/"
+	}
+	return s + string(l.Kind) + "/" + url.PathEscape(l.ID)
+}
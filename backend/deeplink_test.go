@@ -0,0 +1,40 @@
+package backend
+
+import "testing"
+
+func Test_ParseDeepLink(t *testing.T) {
+	for _, tt := range []struct {
+		uri  string
+		want DeepLink
+	}{
+		{"supersonic://album/al-1", DeepLink{Kind: DeepLinkAlbum, ID: "al-1"}},
+		{"supersonic://artist/ar-1/", DeepLink{Kind: DeepLinkArtist, ID: "ar-1"}},
+		{"Supersonic://playlist/a%2Fb", DeepLink{Kind: DeepLinkPlaylist, ID: "a/b"}},
+		{"supersonic://play/track/tr-1", DeepLink{Kind: DeepLinkTrack, ID: "tr-1", Play: true}},
+		{"supersonic://play/album/al-1", DeepLink{Kind: DeepLinkAlbum, ID: "al-1", Play: true}},
+	} {
+		link, err := ParseDeepLink(tt.uri)
+		if err != nil {
+			t.Errorf("ParseDeepLink(%q) failed: %v", tt.uri, err)
+		} else if link != tt.want {
+			t.Errorf("ParseDeepLink(%q) = %+v, want %+v", tt.uri, link, tt.want)
+		}
+	}
+
+	for _, uri := range []string{
+		"", "http://album/1", "supersonic://", "supersonic://album/", "supersonic://album/1/2",
+		"supersonic://genre/1", "supersonic://track/1", "supersonic://play/artist/1",
+	} {
+		if _, err := ParseDeepLink(uri); err == nil {
+			t.Errorf("ParseDeepLink(%q) succeeded, want error", uri)
+		}
+	}
+
+	link := DeepLink{Kind: DeepLinkPlaylist, ID: "a/b c", Play: true}
+	if s := link.String(); s != "supersonic://play/playlist/a%2Fb%20c" {
+		t.Errorf("String() = %q", s)
+	}
+	if parsed, err := ParseDeepLink(link.String()); err != nil || parsed != link {
+		t.Errorf("round trip of %q = %+v, %v", link.String(), parsed, err)
+	}
+}
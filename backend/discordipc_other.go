@@ -0,0 +1,37 @@
+//go:build !windows
+
+package backend
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// Connects to the Discord client's IPC socket, which is in the
+// runtime or temp dir, or a subdirectory of it for sandboxed clients.
+func dialDiscordIPC() (io.ReadWriteCloser, error) {
+	var dirs []string
+	for _, env := range []string{"XDG_RUNTIME_DIR", "TMPDIR", "TMP", "TEMP"} {
+		if dir := os.Getenv(env); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	dirs = append(dirs, "/tmp")
+	var lastErr error
+	for _, dir := range dirs {
+		for _, sub := range []string{"", "app/com.discordapp.Discord", "snap.discord"} {
+			for i := 0; i < 10; i++ {
+				name := filepath.Join(dir, sub, fmt.Sprintf("discord-ipc-%d", i))
+				conn, err := net.Dial("unix", name)
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package backend
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Connects to the Discord client's IPC named pipe.
+func dialDiscordIPC() (io.ReadWriteCloser, error) {
+	var lastErr error
+	for i := 0; i < 10; i++ {
+		f, err := os.OpenFile(fmt.Sprintf(`\\.\pipe\discord-ipc-%d`, i), os.O_RDWR, 0)
+		if err == nil {
+			return f, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
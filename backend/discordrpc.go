@@ -0,0 +1,314 @@
+package backend
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/player"
+	"github.com/google/uuid"
+)
+
+// The Discord application under which the presence is shown, which can be set at build time with
+// -ldflags "-X github.com/dweymouth/supersonic/backend.DiscordClientID=<id>"
+// May be overridden by DiscordConfig, in which the user enters their own
+// application ID in the settings if the build doesn't include one.
+var DiscordClientID string
+
+const (
+	// opcodes of the Discord IPC frames
+	discordOpHandshake = 0
+	discordOpFrame     = 1
+	discordOpClose     = 2
+
+	// Discord activity type shown as "Listening to ..."
+	discordActivityListening = 2
+	// key of the app icon among the Discord application's art assets
+	discordLargeImageKey = "supersonic"
+
+	// time to wait for Discord to reply to a frame
+	discordReplyTimeout = 5 * time.Second
+	// don't try to reconnect to Discord more often than this
+	discordReconnectInterval = 30 * time.Second
+	// re-send the presence if the play position drifts by more
+	// than this from its elapsed time, eg. after seeking
+	discordMaxDrift = 2 * time.Second
+)
+
+var (
+	errDiscordClosed      = errors.New("Discord closed the IPC connection")
+	errDiscordUnavailable = errors.New("Discord not available")
+)
+
+// Shows the currently playing track as the user's Discord
+// Rich Presence, through the local Discord client's IPC socket.
+// If Discord is not running, updates are silently dropped.
+type DiscordRichPresence struct {
+	ctx    context.Context
+	config *DiscordConfig
+	p      player.BasePlayer
+	// opens the IPC connection to the Discord client
+	dial func() (io.ReadWriteCloser, error)
+
+	mutex sync.Mutex
+	track *mediaprovider.Track
+	// start time of the activity last sent, or zero if none is shown
+	shownStart time.Time
+	// latest activity to be sent, nil to clear the presence
+	pending     *discordActivity
+	havePending bool
+	wake        chan struct{}
+
+	// accessed only by the run goroutine
+	conn          io.ReadWriteCloser
+	connClientID  string
+	lastDialFail  time.Time
+	activityShown bool
+}
+
+type discordActivity struct {
+	Type       int                    `json:"type"`
+	Details    string                 `json:"details,omitempty"`
+	State      string                 `json:"state,omitempty"`
+	Timestamps *discordActivityTimes  `json:"timestamps,omitempty"`
+	Assets     *discordActivityAssets `json:"assets,omitempty"`
+}
+
+type discordActivityTimes struct {
+	Start int64 `json:"start,omitempty"`
+	End   int64 `json:"end,omitempty"`
+}
+
+type discordActivityAssets struct {
+	LargeImage string `json:"large_image,omitempty"`
+	LargeText  string `json:"large_text,omitempty"`
+}
+
+func NewDiscordRichPresence(ctx context.Context, config *DiscordConfig, pm *PlaybackManager, p player.BasePlayer) *DiscordRichPresence {
+	d := &DiscordRichPresence{
+		ctx:    ctx,
+		config: config,
+		p:      p,
+		dial:   dialDiscordIPC,
+		wake:   make(chan struct{}, 1),
+	}
+	pm.OnSongChange(func(track, _ *mediaprovider.Track) {
+		d.mutex.Lock()
+		d.track = track
+		d.mutex.Unlock()
+		d.update(0)
+	})
+	pm.OnPlayTimeUpdate(func(pos, _ float64) {
+		d.update(pos)
+	})
+	p.OnPaused(d.clear)
+	p.OnStopped(d.clear)
+	go d.run()
+	return d
+}
+
+// Updates the presence for the current track playing at the given position,
+// if it is not already shown with the same elapsed time.
+func (d *DiscordRichPresence) update(pos float64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.config.Enabled || d.clientID() == "" || d.track == nil ||
+		d.p.GetStatus().State != player.Playing {
+		d.clearLocked()
+		return
+	}
+	start := time.Now().Add(-time.Duration(pos * float64(time.Second)))
+	if !d.shownStart.IsZero() && math.Abs(float64(start.Sub(d.shownStart))) < float64(discordMaxDrift) {
+		return
+	}
+	d.shownStart = start
+	d.setPending(newDiscordActivity(d.track, start))
+}
+
+func (d *DiscordRichPresence) clear() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.clearLocked()
+}
+
+// must be called with the mutex held
+func (d *DiscordRichPresence) clearLocked() {
+	if d.shownStart.IsZero() {
+		return
+	}
+	d.shownStart = time.Time{}
+	d.setPending(nil)
+}
+
+// must be called with the mutex held
+func (d *DiscordRichPresence) setPending(a *discordActivity) {
+	d.pending, d.havePending = a, true
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *DiscordRichPresence) clientID() string {
+	if d.config.ClientID != "" {
+		return d.config.ClientID
+	}
+	return DiscordClientID
+}
+
+func newDiscordActivity(track *mediaprovider.Track, start time.Time) *discordActivity {
+	a := &discordActivity{
+		Type:       discordActivityListening,
+		Details:    track.Name,
+		Timestamps: &discordActivityTimes{Start: start.UnixMilli()},
+		Assets:     &discordActivityAssets{LargeImage: discordLargeImageKey},
+	}
+	if len(track.ArtistNames) > 0 {
+		a.State = "by " + strings.Join(track.ArtistNames, ", ")
+	}
+	if track.Duration > 0 {
+		a.Timestamps.End = start.Add(time.Duration(track.Duration) * time.Second).UnixMilli()
+	}
+	if track.Album != "" {
+		a.Assets.LargeText = track.Album
+	}
+	return a
+}
+
+// Sends the pending activity updates to Discord, until the context is done.
+func (d *DiscordRichPresence) run() {
+	for {
+		select {
+		case <-d.ctx.Done():
+			d.disconnect()
+			return
+		case <-d.wake:
+		}
+		d.mutex.Lock()
+		a, ok := d.pending, d.havePending
+		d.pending, d.havePending = nil, false
+		enabled := d.config.Enabled
+		clientID := d.clientID()
+		d.mutex.Unlock()
+		if !ok {
+			continue
+		}
+		if !enabled || clientID == "" {
+			d.disconnect()
+			continue
+		}
+		if a == nil && !d.activityShown {
+			continue
+		}
+		if err := d.setActivity(clientID, a); err != nil {
+			// Discord is most likely not running;
+			// try again at the next play time update
+			d.disconnect()
+			d.mutex.Lock()
+			d.shownStart = time.Time{}
+			d.mutex.Unlock()
+			continue
+		}
+		d.activityShown = a != nil
+	}
+}
+
+func (d *DiscordRichPresence) setActivity(clientID string, a *discordActivity) error {
+	if d.conn != nil && d.connClientID != clientID {
+		// the application ID was changed in the settings
+		d.disconnect()
+	}
+	if d.conn == nil {
+		if time.Since(d.lastDialFail) < discordReconnectInterval {
+			return errDiscordUnavailable
+		}
+		if err := d.connect(clientID); err != nil {
+			d.lastDialFail = time.Now()
+			return err
+		}
+	}
+	args := map[string]interface{}{"pid": os.Getpid()}
+	if a != nil {
+		args["activity"] = a
+	}
+	return d.call(discordOpFrame, map[string]interface{}{
+		"cmd":   "SET_ACTIVITY",
+		"args":  args,
+		"nonce": uuid.NewString(),
+	})
+}
+
+func (d *DiscordRichPresence) connect(clientID string) error {
+	conn, err := d.dial()
+	if err != nil {
+		return err
+	}
+	d.conn, d.connClientID = conn, clientID
+	return d.call(discordOpHandshake, map[string]interface{}{"v": 1, "client_id": clientID})
+}
+
+func (d *DiscordRichPresence) disconnect() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+	d.activityShown = false
+}
+
+// Writes a frame to Discord and reads its reply.
+func (d *DiscordRichPresence) call(opcode uint32, payload interface{}) error {
+	if c, ok := d.conn.(interface{ SetDeadline(time.Time) error }); ok {
+		c.SetDeadline(time.Now().Add(discordReplyTimeout))
+	}
+	if err := writeDiscordFrame(d.conn, opcode, payload); err != nil {
+		return err
+	}
+	op, _, err := readDiscordFrame(d.conn)
+	if err != nil {
+		return err
+	}
+	if op == discordOpClose {
+		return errDiscordClosed
+	}
+	return nil
+}
+
+// A Discord IPC frame is the opcode and payload length,
+// as little-endian uint32s, followed by the JSON payload.
+func writeDiscordFrame(w io.Writer, opcode uint32, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 8, 8+len(b))
+	binary.LittleEndian.PutUint32(frame[0:4], opcode)
+	binary.LittleEndian.PutUint32(frame[4:8], uint32(len(b)))
+	_, err = w.Write(append(frame, b...))
+	return err
+}
+
+func readDiscordFrame(r io.Reader) (uint32, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := binary.LittleEndian.Uint32(header[0:4])
+	length := binary.LittleEndian.Uint32(header[4:8])
+	if length > 1<<20 {
+		return 0, nil, fmt.Errorf("Discord IPC frame too large: %d bytes", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return opcode, payload, nil
+}
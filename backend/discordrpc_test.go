@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+func Test_DiscordRichPresence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, server := net.Pipe()
+	defer server.Close()
+	d := &DiscordRichPresence{
+		ctx:    ctx,
+		config: &DiscordConfig{Enabled: true, ClientID: "1234"},
+		dial:   func() (io.ReadWriteCloser, error) { return client, nil },
+		wake:   make(chan struct{}, 1),
+	}
+	go d.run()
+
+	type frame struct {
+		ClientID string `json:"client_id"`
+		Cmd      string `json:"cmd"`
+		Args     struct {
+			Activity *discordActivity `json:"activity"`
+		} `json:"args"`
+	}
+	readFrame := func(wantOp uint32) frame {
+		t.Helper()
+		op, b, err := readDiscordFrame(server)
+		if err != nil {
+			t.Fatalf("error reading frame: %v", err)
+		}
+		if op != wantOp {
+			t.Fatalf("got opcode %d, want %d", op, wantOp)
+		}
+		var f frame
+		if err := json.Unmarshal(b, &f); err != nil {
+			t.Fatalf("error decoding frame: %v", err)
+		}
+		if err := writeDiscordFrame(server, discordOpFrame, map[string]string{"evt": "READY"}); err != nil {
+			t.Fatalf("error writing reply: %v", err)
+		}
+		return f
+	}
+
+	track := &mediaprovider.Track{Name: "Song", ArtistNames: []string{"A", "B"}, Album: "Album", Duration: 100}
+	start := time.Unix(1000, 0)
+	d.mutex.Lock()
+	d.setPending(newDiscordActivity(track, start))
+	d.mutex.Unlock()
+
+	if f := readFrame(discordOpHandshake); f.ClientID != "1234" {
+		t.Errorf("got client ID %q, want 1234", f.ClientID)
+	}
+	f := readFrame(discordOpFrame)
+	if f.Cmd != "SET_ACTIVITY" || f.Args.Activity == nil {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+	a := f.Args.Activity
+	if a.Details != "Song" || a.State != "by A, B" || a.Assets.LargeText != "Album" ||
+		a.Timestamps.Start != 1_000_000 || a.Timestamps.End != 1_100_000 {
+		t.Errorf("unexpected activity: %+v", a)
+	}
+
+	// clearing the presence sends an empty activity
+	d.mutex.Lock()
+	d.setPending(nil)
+	d.mutex.Unlock()
+	if f := readFrame(discordOpFrame); f.Cmd != "SET_ACTIVITY" || f.Args.Activity != nil {
+		t.Errorf("unexpected frame: %+v", f)
+	}
+}
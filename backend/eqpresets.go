@@ -0,0 +1,201 @@
+package backend
+
+import (
+	"strings"
+
+	"github.com/dweymouth/supersonic/player"
+)
+
+// A named equalizer preset, holding the settings for one equalizer type.
+type EqualizerPresetConfig struct {
+	Name            string
+	Type            string
+	Preamp          float64
+	GraphicBands    []float64                `toml:",omitempty"`
+	ParametricBands []ParametricEQBandConfig `toml:",omitempty"`
+}
+
+// Presets which are always available, in addition to those saved by the user.
+var BuiltinEqualizerPresets = []EqualizerPresetConfig{
+	{
+		Name:         "Flat",
+		Type:         EqualizerTypeGraphic,
+		GraphicBands: make([]float64, 15),
+	},
+	{
+		Name:         "Rock",
+		Type:         EqualizerTypeGraphic,
+		Preamp:       -4,
+		GraphicBands: []float64{5, 4.5, 4, 3, 1.5, -0.5, -1.5, -1.5, -0.5, 1, 2.5, 3.5, 4, 4.5, 4.5},
+	},
+	{
+		Name:         "Vocal",
+		Type:         EqualizerTypeGraphic,
+		Preamp:       -3,
+		GraphicBands: []float64{-3, -3, -2.5, -2, -1, 0, 1.5, 3, 3.5, 3.5, 3, 1.5, 0, -1, -1.5},
+	},
+	{
+		Name:         "Bass boost",
+		Type:         EqualizerTypeGraphic,
+		Preamp:       -5,
+		GraphicBands: []float64{7, 6.5, 6, 5, 3.5, 2, 0.5, 0, 0, 0, 0, 0, 0, 0, 0},
+	},
+	{
+		Name:   "Loudness",
+		Type:   EqualizerTypeParametric,
+		Preamp: -4,
+		ParametricBands: []ParametricEQBandConfig{
+			{Type: string(player.FilterTypeLowShelf), Frequency: 105, Gain: 4, Q: 0.7},
+			{Type: string(player.FilterTypeHighShelf), Frequency: 10000, Gain: 3, Q: 0.7},
+		},
+	},
+}
+
+// Returns the built-in and user equalizer presets, with user presets
+// replacing built-in presets of the same name.
+func (c *LocalPlaybackConfig) AllEqualizerPresets() []EqualizerPresetConfig {
+	presets := make([]EqualizerPresetConfig, 0, len(BuiltinEqualizerPresets)+len(c.EqualizerPresets))
+	for _, p := range BuiltinEqualizerPresets {
+		if c.findEqualizerPreset(p.Name) < 0 {
+			presets = append(presets, p)
+		}
+	}
+	return append(presets, c.EqualizerPresets...)
+}
+
+// Returns the equalizer preset with the given name, if any.
+func (c *LocalPlaybackConfig) EqualizerPreset(name string) (EqualizerPresetConfig, bool) {
+	for _, p := range c.AllEqualizerPresets() {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return EqualizerPresetConfig{}, false
+}
+
+// Saves the current equalizer settings as a preset with the given name,
+// replacing any user preset of the same name.
+func (c *LocalPlaybackConfig) SaveEqualizerPreset(name string) {
+	p := EqualizerPresetConfig{Name: name, Type: c.EqualizerType}
+	if c.EqualizerType == EqualizerTypeParametric {
+		p.Preamp = c.ParametricEqualizerPreamp
+		p.ParametricBands = append([]ParametricEQBandConfig(nil), c.ParametricEqualizerBands...)
+	} else {
+		p.Preamp = c.EqualizerPreamp
+		p.GraphicBands = append([]float64(nil), c.GraphicEqualizerBands...)
+	}
+	if i := c.findEqualizerPreset(name); i >= 0 {
+		c.EqualizerPresets[i] = p
+	} else {
+		c.EqualizerPresets = append(c.EqualizerPresets, p)
+	}
+	c.EqualizerPresetName = name
+}
+
+// Deletes the user preset with the given name.
+// Returns false if there is no such preset.
+func (c *LocalPlaybackConfig) DeleteEqualizerPreset(name string) bool {
+	i := c.findEqualizerPreset(name)
+	if i < 0 {
+		return false
+	}
+	c.EqualizerPresets = append(c.EqualizerPresets[:i], c.EqualizerPresets[i+1:]...)
+	if strings.EqualFold(c.EqualizerPresetName, name) {
+		c.EqualizerPresetName = ""
+	}
+	return true
+}
+
+// Sets the current equalizer type and settings from the preset.
+func (c *LocalPlaybackConfig) ApplyEqualizerPreset(p EqualizerPresetConfig) {
+	if p.Type == EqualizerTypeParametric {
+		c.EqualizerType = EqualizerTypeParametric
+		c.ParametricEqualizerPreamp = p.Preamp
+		c.ParametricEqualizerBands = append([]ParametricEQBandConfig(nil), p.ParametricBands...)
+	} else {
+		c.EqualizerType = EqualizerTypeGraphic
+		c.EqualizerPreamp = p.Preamp
+		c.GraphicEqualizerBands = make([]float64, 15)
+		copy(c.GraphicEqualizerBands, p.GraphicBands)
+	}
+	c.EqualizerPresetName = p.Name
+}
+
+// Applies the equalizer profile associated with the audio device, if any.
+// Returns false if there is no profile for the device, or its preset no longer exists.
+func (c *LocalPlaybackConfig) ApplyDeviceEqualizerProfile(deviceName string) bool {
+	prof, ok := c.DeviceEqualizerProfiles[deviceName]
+	if !ok || prof.Preset == "" {
+		return false
+	}
+	p, ok := c.EqualizerPreset(prof.Preset)
+	if !ok {
+		return false
+	}
+	p.Preamp = prof.Preamp
+	c.ApplyEqualizerPreset(p)
+	c.EqualizerEnabled = true
+	return true
+}
+
+// Imports equalizer settings in the EqualizerAPO parametric (AutoEQ ParametricEQ.txt)
+// or GraphicEQ formats, mapped onto the current equalizer type.
+func (c *LocalPlaybackConfig) ImportEqualizer(text string) error {
+	var preamp float64
+	var response func(float64) float64
+	var parametric *player.ParametricEqualizer
+	if geq, err := player.ParseGraphicEQ(text); err == nil {
+		response = geq.Gain
+	} else if err != player.ErrNoEqualizerFilters {
+		return err
+	} else {
+		peq, err := player.ParseEqualizerAPO(text)
+		if err != nil {
+			return err
+		}
+		parametric = peq
+		preamp = peq.Preamp()
+		response = peq.Curve().Response
+	}
+
+	if c.EqualizerType == EqualizerTypeParametric {
+		if parametric == nil {
+			parametric = player.NewParametricEqualizerFromResponse(preamp, response)
+		}
+		c.ParametricEqualizerPreamp = parametric.EQPreamp
+		c.ParametricEqualizerBands = make([]ParametricEQBandConfig, len(parametric.Bands))
+		for i, b := range parametric.Bands {
+			c.ParametricEqualizerBands[i] = ParametricEQBandConfig{
+				Type:      string(b.Type),
+				Frequency: b.Frequency,
+				Gain:      b.Gain,
+				Q:         b.Q,
+			}
+		}
+	} else {
+		geq := player.NewISO15BandEqualizerFromResponse(preamp, response)
+		c.EqualizerPreamp = geq.EQPreamp
+		c.GraphicEqualizerBands = geq.BandGains[:]
+	}
+	c.EqualizerPresetName = ""
+	return nil
+}
+
+// Exports the current equalizer settings in the EqualizerAPO
+// parametric format, or the GraphicEQ format if graphicEQ is true.
+func (c *LocalPlaybackConfig) ExportEqualizer(graphicEQ bool) string {
+	eq := EqualizerFromConfig(c)
+	if graphicEQ {
+		return player.FormatGraphicEQ(eq)
+	}
+	return player.FormatEqualizerAPO(eq)
+}
+
+func (c *LocalPlaybackConfig) findEqualizerPreset(name string) int {
+	for i, p := range c.EqualizerPresets {
+		if strings.EqualFold(p.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_EqualizerPresets(t *testing.T) {
+	c := DefaultConfig("").LocalPlayback
+	rock, ok := c.EqualizerPreset("rock")
+	if !ok {
+		t.Fatal("expected built-in Rock preset")
+	}
+	c.ApplyEqualizerPreset(rock)
+	if c.EqualizerType != EqualizerTypeGraphic || c.EqualizerPreamp != rock.Preamp || c.GraphicEqualizerBands[0] != rock.GraphicBands[0] {
+		t.Errorf("preset not applied: %+v", c)
+	}
+
+	// a user preset replaces the built-in one of the same name
+	c.GraphicEqualizerBands[0] = 1
+	c.SaveEqualizerPreset("Rock")
+	if n := len(c.AllEqualizerPresets()); n != len(BuiltinEqualizerPresets) {
+		t.Errorf("expected %d presets, got %d", len(BuiltinEqualizerPresets), n)
+	}
+	if p, _ := c.EqualizerPreset("Rock"); p.GraphicBands[0] != 1 {
+		t.Error("expected user preset to replace built-in")
+	}
+	if !c.DeleteEqualizerPreset("rock") || c.EqualizerPresetName != "" {
+		t.Error("expected user preset to be deleted")
+	}
+	if p, _ := c.EqualizerPreset("Rock"); p.GraphicBands[0] != rock.GraphicBands[0] {
+		t.Error("expected built-in preset after deleting user preset")
+	}
+}
+
+func Test_ImportEqualizer(t *testing.T) {
+	const parametric = "Preamp: -4.0 dB\nFilter 1: ON PK Fc 1000 Hz Gain 4.0 dB Q 1.41\n"
+
+	c := DefaultConfig("").LocalPlayback
+	c.EqualizerType = EqualizerTypeParametric
+	if err := c.ImportEqualizer(parametric); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.ParametricEqualizerPreamp != -4 || len(c.ParametricEqualizerBands) != 1 || c.ParametricEqualizerBands[0].Frequency != 1000 {
+		t.Errorf("unexpected parametric import: %+v", c.ParametricEqualizerBands)
+	}
+
+	// mapped onto the graphic equalizer bands
+	c.EqualizerType = EqualizerTypeGraphic
+	if err := c.ImportEqualizer(parametric); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.EqualizerPreamp != -4 || math.Abs(c.GraphicEqualizerBands[8]-4) > 0.1 || math.Abs(c.GraphicEqualizerBands[0]) > 0.1 {
+		t.Errorf("unexpected graphic import: %v", c.GraphicEqualizerBands)
+	}
+
+	if err := c.ImportEqualizer(c.ExportEqualizer(true)); err != nil {
+		t.Fatalf("unexpected error importing GraphicEQ: %v", err)
+	}
+	// exported GraphicEQ includes the preamp in its gains, and the
+	// response of the graphic EQ is affected by overlap of adjacent bands
+	if math.Abs(c.GraphicEqualizerBands[8]) > 1 || math.Abs(c.GraphicEqualizerBands[0]+4) > 0.1 {
+		t.Errorf("unexpected GraphicEQ import: %v", c.GraphicEqualizerBands)
+	}
+}
+
+func Test_ApplyDeviceEqualizerProfile(t *testing.T) {
+	c := DefaultConfig("").LocalPlayback
+	c.DeviceEqualizerProfiles = map[string]DeviceEqualizerProfile{
+		"usb":     {Preset: "Bass boost", Preamp: -7},
+		"missing": {Preset: "No such preset"},
+	}
+	if c.ApplyDeviceEqualizerProfile("auto") || c.ApplyDeviceEqualizerProfile("missing") {
+		t.Error("expected no profile to be applied")
+	}
+	if c.EqualizerEnabled || c.EqualizerPresetName != "" {
+		t.Error("expected equalizer settings to be unchanged")
+	}
+	if !c.ApplyDeviceEqualizerProfile("usb") {
+		t.Fatal("expected profile to be applied")
+	}
+	if !c.EqualizerEnabled || c.EqualizerPresetName != "Bass boost" || c.EqualizerPreamp != -7 || c.GraphicEqualizerBands[0] != 7 {
+		t.Errorf("unexpected equalizer settings: %+v", c)
+	}
+}
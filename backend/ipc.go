@@ -0,0 +1,244 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/20after4/configdir"
+)
+
+// Commands which can be sent to the running instance over IPC.
+const (
+	// raises the window, and opens the supersonic:// link given as argument, if any
+	IPCActivate   = "activate"
+	IPCPlayPause  = "play-pause"
+	IPCNext       = "next"
+	IPCPrevious   = "prev"
+	IPCVolume     = "volume"     // argument: volume 0-100, or +N/-N to change it
+	IPCPlayAlbum  = "play-album" // argument: album ID
+	IPCNowPlaying = "now-playing"
+)
+
+const (
+	// the Unix domain socket in the session dir on which the running instance listens
+	sessionSocketFile = "ipc.sock"
+
+	ipcDialTimeout = 1 * time.Second
+	// allows time for loading an album from the server
+	ipcRequestTimeout = 10 * time.Second
+)
+
+var (
+	ErrNotRunning = errors.New("no running instance")
+	// the running instance accepted the connection but did not reply in time
+	ErrNoResponse = errors.New("the running instance did not respond")
+
+	errIPCSocketInUse = errors.New("another instance is listening on the IPC socket")
+)
+
+// An IPC request or response is a single line of JSON.
+type IPCRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+type ipcResponse struct {
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Sends a command to the running instance of the app,
+// returning the JSON result, if the command has one.
+func SendIPCCommand(appName string, req IPCRequest) (json.RawMessage, error) {
+	return sendIPCRequest(ipcSocketPath(appName), req)
+}
+
+func sendIPCRequest(socketPath string, req IPCRequest) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", socketPath, ipcDialTimeout)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ipcRequestTimeout))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoResponse, err.Error())
+	}
+	var resp ipcResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoResponse, err.Error())
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Result, nil
+}
+
+func ipcSocketPath(appName string) string {
+	return path.Join(configdir.LocalConfig(appName, sessionDir), sessionSocketFile)
+}
+
+// Hands off to the running instance, unless multiple instances are allowed,
+// returning ErrAnotherInstance if it was reactivated. Otherwise listens on
+// the IPC socket, if no other instance is, and sets a.ipcListener.
+func (a *App) startIPC(openURI string) error {
+	activate := IPCRequest{Command: IPCActivate}
+	if openURI != "" {
+		activate.Args = []string{openURI}
+	}
+	handOff := func() error {
+		_, err := SendIPCCommand(a.appName, activate)
+		if err == nil {
+			log.Println("Another instance is running. Reactivated it.")
+			return ErrAnotherInstance
+		} else if err != ErrNotRunning && !errors.Is(err, ErrNoResponse) {
+			// the running instance was reactivated but failed to open the link
+			log.Printf("error reactivating running instance: %s", err.Error())
+			return ErrAnotherInstance
+		}
+		return err
+	}
+
+	multiInstance := a.Config.Application.AllowMultiInstance
+	takeOver := false
+	if !multiInstance {
+		if err := handOff(); err == ErrAnotherInstance {
+			return err
+		} else if errors.Is(err, ErrNoResponse) {
+			log.Printf("%s. Starting as normal...", err.Error())
+			takeOver = true
+		}
+	}
+
+	log.Println("Creating session IPC socket")
+	os.MkdirAll(configdir.LocalConfig(a.appName, sessionDir), 0770)
+	l, err := listenIPC(ipcSocketPath(a.appName), takeOver)
+	if err == errIPCSocketInUse {
+		if multiInstance {
+			log.Println("Another instance has the session IPC socket")
+			return nil
+		}
+		// another instance started at the same time as this one
+		if err := handOff(); err == ErrAnotherInstance {
+			return err
+		}
+	}
+	if err != nil {
+		log.Printf("error creating session IPC socket: %s", err.Error())
+		return nil
+	}
+	a.ipcListener = l
+	return nil
+}
+
+// Listens on the IPC socket, replacing one left behind by a session which
+// crashed or, if takeOver is set, one whose instance is not responding.
+// Returns errIPCSocketInUse if another instance is listening on it.
+func listenIPC(socketPath string, takeOver bool) (net.Listener, error) {
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		if !takeOver {
+			if conn, err := net.DialTimeout("unix", socketPath, ipcDialTimeout); err == nil {
+				conn.Close()
+				return nil, errIPCSocketInUse
+			}
+		}
+		os.Remove(socketPath)
+		if l, err = net.Listen("unix", socketPath); err != nil {
+			return nil, err
+		}
+	}
+	// only the user may control the app
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serves IPC requests on the listener until the context is done.
+func serveIPC(ctx context.Context, l net.Listener, handle func(IPCRequest) (interface{}, error)) {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("error accepting IPC connection: %s", err.Error())
+			}
+			return
+		}
+		go serveIPCConn(conn, handle)
+	}
+}
+
+func serveIPCConn(conn net.Conn, handle func(IPCRequest) (interface{}, error)) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ipcRequestTimeout))
+	var req IPCRequest
+	var resp ipcResponse
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	var result interface{}
+	if err == nil {
+		result, err = handle(req)
+	}
+	if err == nil && result != nil {
+		resp.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func (a *App) handleIPCRequest(req IPCRequest) (interface{}, error) {
+	switch req.Command {
+	case IPCVolume, IPCPlayAlbum:
+		if len(req.Args) != 1 {
+			return nil, fmt.Errorf("%s: expected 1 argument", req.Command)
+		}
+	}
+	switch req.Command {
+	case IPCActivate:
+		a.callOnReactivate()
+		if len(req.Args) > 0 && req.Args[0] != "" {
+			return nil, a.OpenURI(req.Args[0])
+		}
+		return nil, nil
+	case IPCPlayPause:
+		return nil, a.Player.PlayPause()
+	case IPCNext:
+		return nil, a.Player.SeekNext()
+	case IPCPrevious:
+		return nil, a.Player.SeekBackOrPrevious()
+	case IPCVolume:
+		arg := req.Args[0]
+		vol, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volume: %s", arg)
+		}
+		if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+			vol += a.PlaybackManager.Volume()
+		}
+		return nil, a.PlaybackManager.SetVolume(vol)
+	case IPCPlayAlbum:
+		return nil, a.OpenURI(DeepLink{Kind: DeepLinkAlbum, ID: req.Args[0], Play: true}.String())
+	case IPCNowPlaying:
+		return currentRemoteState(a.PlaybackManager, a.Player), nil
+	}
+	return nil, fmt.Errorf("unknown command: %s", req.Command)
+}
@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_IPC(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), sessionSocketFile)
+	if _, err := sendIPCRequest(socketPath, IPCRequest{Command: IPCNext}); err != ErrNotRunning {
+		t.Errorf("request with no listener: err = %v, want ErrNotRunning", err)
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serveIPC(ctx, l, func(req IPCRequest) (interface{}, error) {
+		switch req.Command {
+		case IPCNowPlaying:
+			return map[string]string{"state": "playing"}, nil
+		case IPCVolume:
+			return nil, errors.New("invalid volume: " + req.Args[0])
+		}
+		return nil, nil
+	})
+
+	if result, err := sendIPCRequest(socketPath, IPCRequest{Command: IPCNext}); err != nil || result != nil {
+		t.Errorf("next: result %s, err %v", result, err)
+	}
+	if result, err := sendIPCRequest(socketPath, IPCRequest{Command: IPCNowPlaying}); err != nil || string(result) != `{"state":"playing"}` {
+		t.Errorf("now-playing: result %s, err %v", result, err)
+	}
+	_, err = sendIPCRequest(socketPath, IPCRequest{Command: IPCVolume, Args: []string{"x"}})
+	if err == nil || err.Error() != "invalid volume: x" {
+		t.Errorf("volume: err = %v", err)
+	}
+}
+
+func Test_ListenIPC(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), sessionSocketFile)
+	l, err := listenIPC(socketPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(socketPath); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, %v, want 0600", fi.Mode().Perm(), err)
+	}
+
+	// a socket which is listened on is left in place,
+	// unless its instance didn't respond to the handoff
+	if _, err := listenIPC(socketPath, false); err != errIPCSocketInUse {
+		t.Errorf("listening on a live socket: err = %v, want errIPCSocketInUse", err)
+	}
+	go func() {
+		// an instance which closes the connection without replying
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	if _, err := sendIPCRequest(socketPath, IPCRequest{Command: IPCNext}); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("request to hung instance: err = %v, want ErrNoResponse", err)
+	}
+	l2, err := listenIPC(socketPath, true)
+	if err != nil {
+		t.Fatalf("taking over the socket: %v", err)
+	}
+	l2.Close()
+	l.Close()
+
+	// a socket left behind by a crash is replaced
+	stale, _ := net.Listen("unix", socketPath)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	l, err = listenIPC(socketPath, false)
+	if err != nil {
+		t.Fatalf("replacing a stale socket: %v", err)
+	}
+	l.Close()
+}
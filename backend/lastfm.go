@@ -0,0 +1,294 @@
+package backend
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	lastFMAPIURL  = "https://ws.audioscrobbler.com/2.0/"
+	lastFMAuthURL = "https://www.last.fm/api/auth/"
+	// keyring user name under which the Last.fm session key is stored
+	lastFMKeyringUser = "lastfm"
+	// Last.fm does not accept scrobbles of tracks shorter than this
+	lastFMMinScrobbleSecs = 30
+)
+
+// The Last.fm API account of the app, which can be set at build time with
+// -ldflags "-X github.com/dweymouth/supersonic/backend.LastFMAPIKey=<key> ..."
+// May be overridden by LastFMConfig, in which the user enters their own
+// API account in the settings if the build doesn't include one.
+var (
+	LastFMAPIKey    string
+	LastFMAPISecret string
+)
+
+var (
+	ErrNoLastFMAPIKey   = errors.New("no Last.fm API key configured")
+	ErrLastFMAuthNeeded = errors.New("Last.fm authorization not started")
+)
+
+// A Last.fm API error.
+type LastFMError struct {
+	Code    int    `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *LastFMError) Error() string {
+	return fmt.Sprintf("Last.fm error %d: %s", e.Code, e.Message)
+}
+
+// A Scrobbler which submits plays to Last.fm, and keeps
+// the user's loved tracks in sync with their favorites.
+type LastFMScrobbler struct {
+	appName string
+	config  *LastFMConfig
+	sm      *ServerManager
+	baseURL string
+	client  http.Client
+
+	mutex         sync.Mutex
+	sessionKey    string
+	sessionLoaded bool
+	// request token of the desktop auth flow in progress
+	authToken string
+}
+
+func NewLastFMScrobbler(appName string, config *LastFMConfig, sm *ServerManager) *LastFMScrobbler {
+	return &LastFMScrobbler{
+		appName: appName,
+		config:  config,
+		sm:      sm,
+		baseURL: lastFMAPIURL,
+		client:  http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Returns true if there is an API account with which to connect to Last.fm.
+func (l *LastFMScrobbler) HaveAPIKey() bool {
+	key, secret := l.apiKey()
+	return key != "" && secret != ""
+}
+
+// Begins the desktop authentication flow, returning the URL
+// at which the user must approve access to their account
+// before calling CompleteAuth.
+func (l *LastFMScrobbler) BeginAuth() (*url.URL, error) {
+	key, _ := l.apiKey()
+	if !l.HaveAPIKey() {
+		return nil, ErrNoLastFMAPIKey
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := l.call("auth.getToken", url.Values{}, &resp); err != nil {
+		return nil, err
+	}
+	l.mutex.Lock()
+	l.authToken = resp.Token
+	l.mutex.Unlock()
+	u, _ := url.Parse(lastFMAuthURL)
+	u.RawQuery = url.Values{"api_key": {key}, "token": {resp.Token}}.Encode()
+	return u, nil
+}
+
+// Completes the desktop authentication flow once the user has approved
+// access in the browser, saving the session key to the keyring.
+// Returns the Last.fm user name.
+func (l *LastFMScrobbler) CompleteAuth() (string, error) {
+	l.mutex.Lock()
+	token := l.authToken
+	l.mutex.Unlock()
+	if token == "" {
+		return "", ErrLastFMAuthNeeded
+	}
+	var resp struct {
+		Session struct {
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		} `json:"session"`
+	}
+	if err := l.call("auth.getSession", url.Values{"token": {token}}, &resp); err != nil {
+		return "", err
+	}
+	if err := keyring.Set(l.appName, lastFMKeyringUser, resp.Session.Key); err != nil {
+		// keep using the session key in memory for this session
+		log.Printf("error setting keyring credentials: %s", err.Error())
+	}
+	l.mutex.Lock()
+	l.sessionKey, l.sessionLoaded = resp.Session.Key, true
+	l.authToken = ""
+	l.mutex.Unlock()
+	l.config.Username = resp.Session.Name
+	return resp.Session.Name, nil
+}
+
+// Removes the session key from the keyring, and disables scrobbling to Last.fm.
+func (l *LastFMScrobbler) Logout() {
+	keyring.Delete(l.appName, lastFMKeyringUser)
+	l.mutex.Lock()
+	l.sessionKey, l.sessionLoaded = "", true
+	l.mutex.Unlock()
+	l.config.Username = ""
+	l.config.Enabled = false
+}
+
+func (l *LastFMScrobbler) SendNowPlaying(track *mediaprovider.Track) error {
+	sk := l.getSessionKey()
+	if !l.config.Enabled || sk == "" || track.Type != mediaprovider.TrackTypeMusic {
+		return nil
+	}
+	params := trackParams(track)
+	params.Set("sk", sk)
+	return l.call("track.updateNowPlaying", params, nil)
+}
+
+func (l *LastFMScrobbler) Scrobble(track *mediaprovider.Track, startTime time.Time) error {
+	sk := l.getSessionKey()
+	if !l.config.Enabled || sk == "" || track.Type != mediaprovider.TrackTypeMusic ||
+		(track.Duration > 0 && track.Duration < lastFMMinScrobbleSecs) {
+		return nil
+	}
+	params := trackParams(track)
+	params.Set("timestamp", strconv.FormatInt(startTime.Unix(), 10))
+	params.Set("sk", sk)
+	return l.call("track.scrobble", params, nil)
+}
+
+// Loves or unloves the tracks with the given IDs on Last.fm,
+// if enabled and syncing loved tracks.
+func (l *LastFMScrobbler) SetTracksLoved(trackIDs []string, loved bool) {
+	sk := l.getSessionKey()
+	if !l.config.Enabled || !l.config.SyncLoved || sk == "" || l.sm.Server == nil {
+		return
+	}
+	method := "track.love"
+	if !loved {
+		method = "track.unlove"
+	}
+	for _, id := range trackIDs {
+		tr, err := l.sm.Server.GetTrack(id)
+		if err != nil {
+			log.Printf("error getting track: %s", err.Error())
+			continue
+		}
+		params := url.Values{
+			"artist": {firstArtistName(tr)},
+			"track":  {tr.Name},
+			"sk":     {sk},
+		}
+		if err := l.call(method, params, nil); err != nil {
+			log.Printf("error syncing Last.fm loved track: %s", err.Error())
+		}
+	}
+}
+
+func trackParams(track *mediaprovider.Track) url.Values {
+	params := url.Values{
+		"artist": {firstArtistName(track)},
+		"track":  {track.Name},
+	}
+	if track.Album != "" {
+		params.Set("album", track.Album)
+	}
+	if track.Duration > 0 {
+		params.Set("duration", strconv.Itoa(track.Duration))
+	}
+	if track.TrackNumber > 0 {
+		params.Set("trackNumber", strconv.Itoa(track.TrackNumber))
+	}
+	return params
+}
+
+// Last.fm expects a single artist name per track
+func firstArtistName(track *mediaprovider.Track) string {
+	if len(track.ArtistNames) == 0 {
+		return ""
+	}
+	return track.ArtistNames[0]
+}
+
+func (l *LastFMScrobbler) apiKey() (key, secret string) {
+	if l.config.APIKey != "" {
+		return l.config.APIKey, l.config.APISecret
+	}
+	return LastFMAPIKey, LastFMAPISecret
+}
+
+func (l *LastFMScrobbler) getSessionKey() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.sessionLoaded {
+		l.sessionLoaded = true
+		if sk, err := keyring.Get(l.appName, lastFMKeyringUser); err == nil {
+			l.sessionKey = sk
+		} else if err != keyring.ErrNotFound {
+			log.Printf("error reading keyring credentials: %s", err.Error())
+		}
+	}
+	return l.sessionKey
+}
+
+// Calls a signed Last.fm API method, and decodes the JSON response into result, if not nil.
+func (l *LastFMScrobbler) call(method string, params url.Values, result interface{}) error {
+	key, secret := l.apiKey()
+	params.Set("method", method)
+	params.Set("api_key", key)
+	params.Set("api_sig", lastFMSignature(params, secret))
+	params.Set("format", "json")
+
+	resp, err := l.client.PostForm(l.baseURL, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("Last.fm %s failed: %s", method, resp.Status)
+	}
+	var lfmErr LastFMError
+	if json.Unmarshal(body, &lfmErr) == nil && lfmErr.Code != 0 {
+		return &lfmErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Last.fm %s failed: %s", method, resp.Status)
+	}
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+// Returns the API method signature: the MD5 hash of the parameters,
+// sorted by name and concatenated as <name><value>, followed by the secret.
+func lastFMSignature(params url.Values, secret string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if name != "format" && name != "callback" && name != "api_sig" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteString(params.Get(name))
+	}
+	sb.WriteString(secret)
+	sum := md5.Sum([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
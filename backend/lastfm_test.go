@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+func Test_LastFMSignature(t *testing.T) {
+	params := url.Values{
+		"method":  {"auth.getSession"},
+		"api_key": {"key"},
+		"token":   {"tok"},
+		"format":  {"json"},
+	}
+	// md5("api_keykeymethodauth.getSessiontokentoksecret")
+	if got, want := lastFMSignature(params, "secret"), "04e870be4bb79756721b7bc1937fe83d"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if lastFMSignature(params, "secret") != lastFMSignature(url.Values{
+		"token": {"tok"}, "api_key": {"key"}, "method": {"auth.getSession"},
+	}, "secret") {
+		t.Error("signature should not depend on parameter order or format")
+	}
+}
+
+func Test_LastFMScrobble(t *testing.T) {
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r.PostForm
+		if got.Get("sk") == "bad" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": 9, "message": "Invalid session key"}`))
+			return
+		}
+		w.Write([]byte(`{"scrobbles": {}}`))
+	}))
+	defer srv.Close()
+
+	cfg := &LastFMConfig{Enabled: true, APIKey: "key", APISecret: "secret"}
+	l := NewLastFMScrobbler("supersonic", cfg, nil)
+	l.baseURL = srv.URL
+	l.sessionKey, l.sessionLoaded = "session", true
+
+	track := &mediaprovider.Track{
+		Name:        "Song",
+		ArtistNames: []string{"Artist", "Featured"},
+		Album:       "Album",
+		Duration:    180,
+		Type:        mediaprovider.TrackTypeMusic,
+	}
+	start := time.Unix(1700000000, 0)
+	if err := l.Scrobble(track, start); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for k, want := range map[string]string{
+		"method":    "track.scrobble",
+		"artist":    "Artist",
+		"track":     "Song",
+		"album":     "Album",
+		"duration":  "180",
+		"timestamp": "1700000000",
+		"sk":        "session",
+		"api_key":   "key",
+		"format":    "json",
+	} {
+		if got.Get(k) != want {
+			t.Errorf("got %s=%q, want %q", k, got.Get(k), want)
+		}
+	}
+	if sig := got.Get("api_sig"); sig != lastFMSignature(got, "secret") {
+		t.Errorf("bad signature %q", sig)
+	}
+
+	// too short for Last.fm
+	got = nil
+	track.Duration = 20
+	l.Scrobble(track, start)
+	if got != nil {
+		t.Error("short track should not be scrobbled")
+	}
+
+	l.sessionKey = "bad"
+	err := l.SendNowPlaying(track)
+	if lfmErr, ok := err.(*LastFMError); !ok || lfmErr.Code != 9 {
+		t.Errorf("got error %v, want Last.fm error 9", err)
+	}
+}
@@ -0,0 +1,238 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	listenBrainzAPIURL = "https://api.listenbrainz.org/1/"
+	// keyring user name under which the ListenBrainz user token is stored
+	listenBrainzKeyringUser = "listenbrainz"
+)
+
+var ErrInvalidListenBrainzToken = errors.New("invalid ListenBrainz user token")
+
+// A Scrobbler which submits listens to ListenBrainz.
+type ListenBrainzScrobbler struct {
+	appName    string
+	appVersion string
+	config     *ListenBrainzConfig
+	sm         *ServerManager
+	baseURL    string
+	client     http.Client
+
+	mutex       sync.Mutex
+	token       string
+	tokenLoaded bool
+	// MusicBrainz IDs of the most recently looked up track
+	mbidsTrackID string
+	mbids        *mediaprovider.MusicBrainzIDs
+}
+
+func NewListenBrainzScrobbler(appName, appVersion string, config *ListenBrainzConfig, sm *ServerManager) *ListenBrainzScrobbler {
+	return &ListenBrainzScrobbler{
+		appName:    appName,
+		appVersion: appVersion,
+		config:     config,
+		sm:         sm,
+		baseURL:    listenBrainzAPIURL,
+		client:     http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Validates the user token with ListenBrainz and, if valid,
+// saves it to the keyring and returns the ListenBrainz user name.
+func (l *ListenBrainzScrobbler) SetToken(token string) (string, error) {
+	var resp struct {
+		Valid    bool   `json:"valid"`
+		UserName string `json:"user_name"`
+	}
+	if err := l.request("GET", "validate-token", token, nil, &resp); err != nil {
+		return "", err
+	}
+	if !resp.Valid {
+		return "", ErrInvalidListenBrainzToken
+	}
+	if err := keyring.Set(l.appName, listenBrainzKeyringUser, token); err != nil {
+		// keep using the token in memory for this session
+		log.Printf("error setting keyring credentials: %s", err.Error())
+	}
+	l.mutex.Lock()
+	l.token, l.tokenLoaded = token, true
+	l.mutex.Unlock()
+	l.config.Username = resp.UserName
+	return resp.UserName, nil
+}
+
+// Removes the user token from the keyring, and disables submitting listens.
+func (l *ListenBrainzScrobbler) ClearToken() {
+	keyring.Delete(l.appName, listenBrainzKeyringUser)
+	l.mutex.Lock()
+	l.token, l.tokenLoaded = "", true
+	l.mutex.Unlock()
+	l.config.Username = ""
+	l.config.Enabled = false
+}
+
+func (l *ListenBrainzScrobbler) SendNowPlaying(track *mediaprovider.Track) error {
+	return l.submit("playing_now", track, time.Time{})
+}
+
+func (l *ListenBrainzScrobbler) Scrobble(track *mediaprovider.Track, startTime time.Time) error {
+	return l.submit("single", track, startTime)
+}
+
+type listenBrainzListen struct {
+	ListenedAt    int64                     `json:"listened_at,omitempty"`
+	TrackMetadata listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName     string                 `json:"artist_name"`
+	TrackName      string                 `json:"track_name"`
+	ReleaseName    string                 `json:"release_name,omitempty"`
+	AdditionalInfo map[string]interface{} `json:"additional_info"`
+}
+
+func (l *ListenBrainzScrobbler) submit(listenType string, track *mediaprovider.Track, listenedAt time.Time) error {
+	token := l.getToken()
+	if !l.config.Enabled || token == "" || track.Type != mediaprovider.TrackTypeMusic {
+		return nil
+	}
+	listen := l.newListen(track)
+	if !listenedAt.IsZero() {
+		listen.ListenedAt = listenedAt.Unix()
+	}
+	payload := map[string]interface{}{
+		"listen_type": listenType,
+		"payload":     []listenBrainzListen{listen},
+	}
+	return l.request("POST", "submit-listens", token, payload, nil)
+}
+
+func (l *ListenBrainzScrobbler) newListen(track *mediaprovider.Track) listenBrainzListen {
+	info := map[string]interface{}{
+		"media_player":              l.appName,
+		"submission_client":         l.appName,
+		"submission_client_version": l.appVersion,
+	}
+	if track.Duration > 0 {
+		info["duration_ms"] = track.Duration * 1000
+	}
+	if track.TrackNumber > 0 {
+		info["tracknumber"] = track.TrackNumber
+	}
+	if len(track.ArtistNames) > 1 {
+		info["artist_names"] = track.ArtistNames
+	}
+	if ids := l.musicBrainzIDs(track); ids != nil {
+		if ids.Recording != "" {
+			info["recording_mbid"] = ids.Recording
+		}
+		if ids.Release != "" {
+			info["release_mbid"] = ids.Release
+		}
+		if len(ids.Artists) > 0 {
+			info["artist_mbids"] = ids.Artists
+		}
+	}
+	return listenBrainzListen{
+		TrackMetadata: listenBrainzTrackMetadata{
+			ArtistName:     strings.Join(track.ArtistNames, ", "),
+			TrackName:      track.Name,
+			ReleaseName:    track.Album,
+			AdditionalInfo: info,
+		},
+	}
+}
+
+// Returns the MusicBrainz IDs of the track, if the server can provide them.
+// The IDs of the last track are cached, since a track's now playing
+// notification and listen are usually submitted consecutively.
+func (l *ListenBrainzScrobbler) musicBrainzIDs(track *mediaprovider.Track) *mediaprovider.MusicBrainzIDs {
+	l.mutex.Lock()
+	if l.mbidsTrackID == track.ID {
+		defer l.mutex.Unlock()
+		return l.mbids
+	}
+	l.mutex.Unlock()
+
+	if l.sm == nil {
+		return nil
+	}
+	mbp, ok := l.sm.Server.(mediaprovider.MusicBrainzIDProvider)
+	if !ok {
+		return nil
+	}
+	ids, err := mbp.GetMusicBrainzIDs(track.ID)
+	if err != nil {
+		log.Printf("error getting MusicBrainz IDs: %s", err.Error())
+		return nil
+	}
+	l.mutex.Lock()
+	l.mbidsTrackID, l.mbids = track.ID, ids
+	l.mutex.Unlock()
+	return ids
+}
+
+func (l *ListenBrainzScrobbler) getToken() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.tokenLoaded {
+		l.tokenLoaded = true
+		if t, err := keyring.Get(l.appName, listenBrainzKeyringUser); err == nil {
+			l.token = t
+		} else if err != keyring.ErrNotFound {
+			log.Printf("error reading keyring credentials: %s", err.Error())
+		}
+	}
+	return l.token
+}
+
+// Makes a request to the ListenBrainz API, and decodes the JSON response into result, if not nil.
+func (l *ListenBrainzScrobbler) request(method, endpoint, token string, body, result interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, l.baseURL+endpoint, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrInvalidListenBrainzToken
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("ListenBrainz %s failed: %s %s", endpoint, resp.Status, errResp.Error)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
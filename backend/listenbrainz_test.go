@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+func Test_ListenBrainzSubmit(t *testing.T) {
+	var gotAuth string
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/submit-listens" {
+			t.Errorf("unexpected request path %q", r.URL.Path)
+		}
+		gotAuth = r.Header.Get("Authorization")
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer srv.Close()
+
+	cfg := &ListenBrainzConfig{Enabled: true}
+	l := NewListenBrainzScrobbler("supersonic", "v1.0.0", cfg, nil)
+	l.baseURL = srv.URL + "/"
+	l.token, l.tokenLoaded = "secret", true
+	l.mbidsTrackID = "1"
+	l.mbids = &mediaprovider.MusicBrainzIDs{Recording: "rec-id"}
+
+	track := &mediaprovider.Track{
+		ID:          "1",
+		Name:        "Song",
+		ArtistNames: []string{"Artist"},
+		Album:       "Album",
+		Duration:    180,
+		Type:        mediaprovider.TrackTypeMusic,
+	}
+	start := time.Unix(1700000000, 0)
+	if err := l.Scrobble(track, start); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAuth != "Token secret" {
+		t.Errorf("got Authorization %q", gotAuth)
+	}
+	if got["listen_type"] != "single" {
+		t.Errorf("got listen_type %v, want single", got["listen_type"])
+	}
+	listen := got["payload"].([]interface{})[0].(map[string]interface{})
+	if listen["listened_at"] != float64(start.Unix()) {
+		t.Errorf("got listened_at %v", listen["listened_at"])
+	}
+	meta := listen["track_metadata"].(map[string]interface{})
+	info := meta["additional_info"].(map[string]interface{})
+	if meta["artist_name"] != "Artist" || meta["track_name"] != "Song" || meta["release_name"] != "Album" ||
+		info["duration_ms"] != float64(180000) || info["recording_mbid"] != "rec-id" {
+		t.Errorf("unexpected track metadata: %v", meta)
+	}
+
+	if err := l.SendNowPlaying(track); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["listen_type"] != "playing_now" {
+		t.Errorf("got listen_type %v, want playing_now", got["listen_type"])
+	}
+	if _, ok := got["payload"].([]interface{})[0].(map[string]interface{})["listened_at"]; ok {
+		t.Error("playing_now listen should not have listened_at")
+	}
+
+	got = nil
+	cfg.Enabled = false
+	l.Scrobble(track, start)
+	if got != nil {
+		t.Error("listen submitted while disabled")
+	}
+}
@@ -0,0 +1,244 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+const historyFileName = "history.jsonl"
+
+// A single entry in the local listening history.
+// Stores enough track metadata to display and re-play the track
+// without needing to look it up on the server.
+type HistoryEntry struct {
+	Time        time.Time `json:"time"`
+	ServerID    string    `json:"serverId"`
+	TrackID     string    `json:"trackId"`
+	Title       string    `json:"title"`
+	ArtistIDs   []string  `json:"artistIds,omitempty"`
+	ArtistNames []string  `json:"artistNames,omitempty"`
+	AlbumID     string    `json:"albumId,omitempty"`
+	Album       string    `json:"album,omitempty"`
+	Genre       string    `json:"genre,omitempty"`
+	CoverArtID  string    `json:"coverArtId,omitempty"`
+	// Length of the track, in seconds
+	Duration int `json:"duration"`
+	// Time the track was actually played for, in seconds
+	PlayTime float64 `json:"playTime"`
+	Skipped  bool    `json:"skipped,omitempty"`
+}
+
+// Returns a Track model for the entry, suitable for loading into the play queue.
+func (h *HistoryEntry) Track() *mediaprovider.Track {
+	return &mediaprovider.Track{
+		ID:          h.TrackID,
+		CoverArtID:  h.CoverArtID,
+		Name:        h.Title,
+		Duration:    h.Duration,
+		Genre:       h.Genre,
+		ArtistIDs:   h.ArtistIDs,
+		ArtistNames: h.ArtistNames,
+		Album:       h.Album,
+		AlbumID:     h.AlbumID,
+	}
+}
+
+// An append-only, on-disk log of the tracks the user has played and skipped.
+// Entries for all servers are kept in the same file, tagged with the server ID.
+type ListeningHistory struct {
+	filePath string
+	// held while writing the file, which is done off the player event path
+	fileMutex sync.Mutex
+
+	mutex   sync.RWMutex
+	entries []*HistoryEntry // in order of play
+	// entries not yet appended to the file
+	unwritten []*HistoryEntry
+}
+
+// Creates a ListeningHistory backed by the given file,
+// loading any entries already recorded in it.
+func NewListeningHistory(filePath string) *ListeningHistory {
+	h := &ListeningHistory{filePath: filePath}
+	if err := h.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("error loading listening history: %s", err.Error())
+	}
+	return h
+}
+
+// Records the given play in the history, writing it to the file in the background.
+func (h *ListeningHistory) AddPlay(serverID string, play TrackPlay) {
+	tr := play.Track
+	e := &HistoryEntry{
+		Time:        play.StartTime,
+		ServerID:    serverID,
+		TrackID:     tr.ID,
+		Title:       tr.Name,
+		ArtistIDs:   tr.ArtistIDs,
+		ArtistNames: tr.ArtistNames,
+		AlbumID:     tr.AlbumID,
+		Album:       tr.Album,
+		Genre:       tr.Genre,
+		CoverArtID:  tr.CoverArtID,
+		Duration:    tr.Duration,
+		PlayTime:    play.PlayTime.Seconds(),
+		Skipped:     play.Skipped,
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().Add(-play.PlayTime)
+	}
+
+	h.mutex.Lock()
+	h.entries = append(h.entries, e)
+	h.unwritten = append(h.unwritten, e)
+	h.mutex.Unlock()
+	go h.writeUnwritten()
+}
+
+// Returns the history entries for the given server, most recent first.
+// If includeSkipped is false, plays which were skipped are omitted.
+func (h *ListeningHistory) Entries(serverID string, includeSkipped bool) []*HistoryEntry {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var entries []*HistoryEntry
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := h.entries[i]
+		if e.ServerID == serverID && (includeSkipped || !e.Skipped) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Removes all history entries for the given server.
+func (h *ListeningHistory) Clear(serverID string) error {
+	h.fileMutex.Lock()
+	defer h.fileMutex.Unlock()
+	h.mutex.Lock()
+	keep := make([]*HistoryEntry, 0, len(h.entries))
+	for _, e := range h.entries {
+		if e.ServerID != serverID {
+			keep = append(keep, e)
+		}
+	}
+	h.entries = keep
+	// written along with the rest by rewriteFile
+	h.unwritten = nil
+	h.mutex.Unlock()
+	return h.rewriteFile(keep)
+}
+
+// Writes the history entries for the given server as CSV, most recent first.
+func (h *ListeningHistory) ExportCSV(w io.Writer, serverID string) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"Time", "Title", "Artist", "Album", "Genre", "Duration", "Play time", "Skipped", "Track ID"})
+	for _, e := range h.Entries(serverID, true /*includeSkipped*/) {
+		c.Write([]string{
+			e.Time.Format(time.RFC3339),
+			e.Title,
+			strings.Join(e.ArtistNames, ", "),
+			e.Album,
+			e.Genre,
+			strconv.Itoa(e.Duration),
+			strconv.Itoa(int(e.PlayTime)),
+			strconv.FormatBool(e.Skipped),
+			e.TrackID,
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+func (h *ListeningHistory) load() error {
+	f, err := os.Open(h.filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// skip a malformed line, eg. a partial write if the app crashed
+			continue
+		}
+		h.entries = append(h.entries, &e)
+	}
+	return scanner.Err()
+}
+
+// Appends the entries added since the last write to the file, in order of play.
+func (h *ListeningHistory) writeUnwritten() {
+	h.fileMutex.Lock()
+	defer h.fileMutex.Unlock()
+	h.mutex.Lock()
+	entries := h.unwritten
+	h.unwritten = nil
+	h.mutex.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+	if err := h.appendToFile(entries); err != nil {
+		log.Printf("error writing listening history: %s", err.Error())
+	}
+}
+
+// must be called with the file mutex held
+func (h *ListeningHistory) appendToFile(entries []*HistoryEntry) error {
+	f, err := os.OpenFile(h.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, e := range entries {
+		if err := writeHistoryEntry(f, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// must be called with the file mutex held
+func (h *ListeningHistory) rewriteFile(entries []*HistoryEntry) error {
+	tmpPath := h.filePath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		if err := writeHistoryEntry(w, e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, h.filePath)
+}
+
+func writeHistoryEntry(w io.Writer, e *HistoryEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
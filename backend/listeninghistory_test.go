@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+func newListeningHistoryTest(t *testing.T) (*ListeningHistory, string) {
+	filePath := filepath.Join(t.TempDir(), historyFileName)
+	return NewListeningHistory(filePath), filePath
+}
+
+func addHistoryPlay(h *ListeningHistory, serverID, trackID string, start time.Time, skipped bool) {
+	h.AddPlay(serverID, TrackPlay{
+		Track: &mediaprovider.Track{
+			ID:          trackID,
+			Name:        "Track " + trackID,
+			ArtistNames: []string{"Artist 1", "Artist 2"},
+			Album:       "Album",
+			Duration:    200,
+		},
+		StartTime: start,
+		PlayTime:  90 * time.Second,
+		Skipped:   skipped,
+	})
+	// wait for the write rather than racing with it
+	h.writeUnwritten()
+}
+
+func Test_ListeningHistory_Reload(t *testing.T) {
+	h, filePath := newListeningHistoryTest(t)
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	addHistoryPlay(h, "server", "a", start, false)
+	addHistoryPlay(h, "other", "x", start.Add(time.Minute), false)
+	addHistoryPlay(h, "server", "b", start.Add(2*time.Minute), true)
+
+	h = NewListeningHistory(filePath)
+	entries := h.Entries("server", true /*includeSkipped*/)
+	if len(entries) != 2 || entries[0].TrackID != "b" || entries[1].TrackID != "a" {
+		t.Fatalf("reloaded entries = %v, want b, a", entries)
+	}
+	if e := entries[1]; e.Title != "Track a" || len(e.ArtistNames) != 2 ||
+		!e.Time.Equal(start) || e.PlayTime != 90 || e.Skipped {
+		t.Errorf("reloaded entry = %+v", e)
+	}
+	if entries := h.Entries("server", false); len(entries) != 1 || entries[0].TrackID != "a" {
+		t.Errorf("entries without skipped = %v, want a", entries)
+	}
+}
+
+func Test_ListeningHistory_SkipsMalformedLines(t *testing.T) {
+	h, filePath := newListeningHistoryTest(t)
+	addHistoryPlay(h, "server", "a", time.Now(), false)
+	// as if the app crashed partway through writing a line
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("not json\n{\"time\":\"2026-10-14T12:00:00Z\",\"serverId\":\"ser")
+	f.Close()
+
+	h = NewListeningHistory(filePath)
+	if entries := h.Entries("server", true); len(entries) != 1 || entries[0].TrackID != "a" {
+		t.Errorf("entries = %v, want only a", entries)
+	}
+}
+
+func Test_ListeningHistory_Clear(t *testing.T) {
+	h, filePath := newListeningHistoryTest(t)
+	addHistoryPlay(h, "server", "a", time.Now(), false)
+	addHistoryPlay(h, "other", "x", time.Now(), false)
+	if err := h.Clear("server"); err != nil {
+		t.Fatal(err)
+	}
+	if entries := h.Entries("server", true); len(entries) != 0 {
+		t.Errorf("entries after clear = %v, want none", entries)
+	}
+
+	h = NewListeningHistory(filePath)
+	if entries := h.Entries("server", true); len(entries) != 0 {
+		t.Errorf("reloaded entries after clear = %v, want none", entries)
+	}
+	if entries := h.Entries("other", true); len(entries) != 1 || entries[0].TrackID != "x" {
+		t.Errorf("entries of other server = %v, want x", entries)
+	}
+}
+
+func Test_ListeningHistory_ExportCSV(t *testing.T) {
+	h, _ := newListeningHistoryTest(t)
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	addHistoryPlay(h, "server", "a", start, false)
+	addHistoryPlay(h, "server", "b", start.Add(time.Minute), true)
+	addHistoryPlay(h, "other", "x", start, false)
+
+	var buf bytes.Buffer
+	if err := h.ExportCSV(&buf, "server"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want header and 2 entries", len(rows))
+	}
+	want := []string{"2026-10-14T12:00:00Z", "Track a", "Artist 1, Artist 2", "Album", "", "200", "90", "false", "a"}
+	if got := rows[2]; len(got) != len(want) {
+		t.Errorf("row = %v, want %v", got, want)
+	} else {
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("column %s = %q, want %q", rows[0][i], got[i], want[i])
+			}
+		}
+	}
+	if rows[1][8] != "b" || rows[1][7] != "true" {
+		t.Errorf("first row = %v, want skipped track b", rows[1])
+	}
+}
@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// The time period to compute listening statistics over.
+type StatsPeriod int
+
+const (
+	StatsPeriodWeek StatsPeriod = iota
+	StatsPeriodMonth
+	StatsPeriodYear
+	StatsPeriodAllTime
+)
+
+// An artist, album, track or genre ranked by number of plays.
+type StatsItem struct {
+	// ID of the artist, album or track. Empty for genres.
+	ID   string
+	Name string
+	// For tracks and albums, the (first) artist.
+	ArtistID   string
+	ArtistName string
+	// For tracks, the album the track is from.
+	AlbumID string
+
+	Plays    int
+	PlayTime time.Duration
+}
+
+// Time listened on a given day.
+type DailyListening struct {
+	Day      time.Time
+	PlayTime time.Duration
+}
+
+// Listening statistics computed from the local listening history.
+type ListeningStats struct {
+	TopArtists []StatsItem
+	TopAlbums  []StatsItem
+	TopTracks  []StatsItem
+	TopGenres  []StatsItem
+
+	TotalPlays    int
+	TotalPlayTime time.Duration
+
+	// Time listened per day, for every day in the period, oldest first.
+	Daily []DailyListening
+
+	// Time listened by day of week (indexed by time.Weekday) and hour of day.
+	HourOfDay [7][24]time.Duration
+}
+
+// Start of the given period, in local time, or the zero time for StatsPeriodAllTime.
+// Weeks begin on Monday.
+func (p StatsPeriod) Start(now time.Time) time.Time {
+	today := startOfDay(now)
+	switch p {
+	case StatsPeriodWeek:
+		daysSinceMonday := (int(today.Weekday()) + 6) % 7
+		return today.AddDate(0, 0, -daysSinceMonday)
+	case StatsPeriodMonth:
+		return time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
+	case StatsPeriodYear:
+		return time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.Local)
+	}
+	return time.Time{}
+}
+
+// Computes listening statistics for the given server and period.
+// The top lists are limited to topN items each.
+// Skipped plays count towards listening time, but not towards the top lists.
+func (h *ListeningHistory) Stats(serverID string, period StatsPeriod, topN int) ListeningStats {
+	return h.stats(serverID, period, topN, time.Now())
+}
+
+func (h *ListeningHistory) stats(serverID string, period StatsPeriod, topN int, now time.Time) ListeningStats {
+	start := period.Start(now)
+	entries := h.Entries(serverID, true /*includeSkipped*/)
+
+	var stats ListeningStats
+	artists := make(map[string]*StatsItem)
+	albums := make(map[string]*StatsItem)
+	tracks := make(map[string]*StatsItem)
+	genres := make(map[string]*StatsItem)
+	daily := make(map[time.Time]time.Duration)
+	firstDay := startOfDay(now)
+
+	for _, e := range entries {
+		// entries are in the order the plays ended, which need not
+		// be the order of their start times, so check every entry
+		t := e.Time.Local()
+		if t.Before(start) || t.After(now) {
+			continue
+		}
+		playTime := time.Duration(e.PlayTime * float64(time.Second))
+		day := startOfDay(t)
+		if day.Before(firstDay) {
+			firstDay = day
+		}
+		daily[day] += playTime
+		stats.HourOfDay[t.Weekday()][t.Hour()] += playTime
+		stats.TotalPlayTime += playTime
+		if e.Skipped {
+			continue
+		}
+		stats.TotalPlays++
+
+		var artistID, artistName string
+		if len(e.ArtistNames) > 0 {
+			artistName = e.ArtistNames[0]
+		}
+		if len(e.ArtistIDs) > 0 {
+			artistID = e.ArtistIDs[0]
+		}
+		for i, name := range e.ArtistNames {
+			id := ""
+			if i < len(e.ArtistIDs) {
+				id = e.ArtistIDs[i]
+			}
+			addStatsPlay(artists, statsKey(id, name), StatsItem{ID: id, Name: name}, playTime)
+		}
+		if e.Album != "" {
+			addStatsPlay(albums, statsKey(e.AlbumID, e.Album), StatsItem{
+				ID: e.AlbumID, Name: e.Album, ArtistID: artistID, ArtistName: artistName,
+			}, playTime)
+		}
+		addStatsPlay(tracks, statsKey(e.TrackID, e.Title), StatsItem{
+			ID: e.TrackID, Name: e.Title, ArtistID: artistID, ArtistName: artistName, AlbumID: e.AlbumID,
+		}, playTime)
+		if e.Genre != "" {
+			addStatsPlay(genres, strings.ToLower(e.Genre), StatsItem{Name: e.Genre}, playTime)
+		}
+	}
+
+	stats.TopArtists = topStatsItems(artists, topN)
+	stats.TopAlbums = topStatsItems(albums, topN)
+	stats.TopTracks = topStatsItems(tracks, topN)
+	stats.TopGenres = topStatsItems(genres, topN)
+
+	if !start.IsZero() {
+		firstDay = start
+	}
+	for day := firstDay; !day.After(now); day = day.AddDate(0, 0, 1) {
+		stats.Daily = append(stats.Daily, DailyListening{Day: day, PlayTime: daily[day]})
+	}
+	return stats
+}
+
+func statsKey(id, name string) string {
+	if id != "" {
+		return id
+	}
+	return strings.ToLower(name)
+}
+
+func addStatsPlay(m map[string]*StatsItem, key string, item StatsItem, playTime time.Duration) {
+	existing, ok := m[key]
+	if !ok {
+		existing = &item
+		m[key] = existing
+	}
+	existing.Plays++
+	existing.PlayTime += playTime
+}
+
+func topStatsItems(m map[string]*StatsItem, n int) []StatsItem {
+	items := make([]StatsItem, 0, len(m))
+	for _, it := range m {
+		items = append(items, *it)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Plays != items[j].Plays {
+			return items[i].Plays > items[j].Plays
+		}
+		if items[i].PlayTime != items[j].PlayTime {
+			return items[i].PlayTime > items[j].PlayTime
+		}
+		return items[i].Name < items[j].Name
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ListeningStats(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.Local)
+	entry := func(daysAgo int, trackID, artist, genre string, skipped bool) *HistoryEntry {
+		return &HistoryEntry{
+			Time:        now.AddDate(0, 0, -daysAgo),
+			ServerID:    "server",
+			TrackID:     trackID,
+			Title:       "Track " + trackID,
+			ArtistIDs:   []string{"ar-" + artist},
+			ArtistNames: []string{artist},
+			AlbumID:     "al-" + artist,
+			Album:       "Album " + artist,
+			Genre:       genre,
+			PlayTime:    60,
+			Skipped:     skipped,
+		}
+	}
+	h := &ListeningHistory{entries: []*HistoryEntry{
+		entry(1, "a", "A", "Rock", false),
+		// out of order, and before the start of the week
+		entry(10, "old", "Old", "Jazz", false),
+		entry(0, "b", "B", "rock", false),
+		entry(2, "a", "A", "Rock", false),
+		entry(0, "c", "B", "Pop", true),
+		{Time: now, ServerID: "other", TrackID: "x", Title: "Other server", PlayTime: 60},
+	}}
+
+	stats := h.stats("server", StatsPeriodWeek, 10, now)
+	if stats.TotalPlays != 3 {
+		t.Errorf("total plays = %d, want 3", stats.TotalPlays)
+	}
+	// skipped plays count towards listening time
+	if stats.TotalPlayTime != 4*time.Minute {
+		t.Errorf("total play time = %v, want 4m", stats.TotalPlayTime)
+	}
+	if len(stats.TopTracks) != 2 || stats.TopTracks[0].ID != "a" || stats.TopTracks[0].Plays != 2 {
+		t.Errorf("top tracks = %+v, want a (2 plays), b", stats.TopTracks)
+	}
+	if len(stats.TopArtists) != 2 || stats.TopArtists[0].ID != "ar-A" {
+		t.Errorf("top artists = %+v, want A, B", stats.TopArtists)
+	}
+	// genres are grouped case-insensitively
+	if len(stats.TopGenres) != 1 || stats.TopGenres[0].Plays != 3 {
+		t.Errorf("top genres = %+v, want Rock (3 plays)", stats.TopGenres)
+	}
+	// Monday to Wednesday
+	if len(stats.Daily) != 3 || !stats.Daily[0].Day.Equal(time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("daily = %+v, want 3 days from Monday", stats.Daily)
+	}
+	if stats.Daily[2].PlayTime != 2*time.Minute {
+		t.Errorf("play time today = %v, want 2m", stats.Daily[2].PlayTime)
+	}
+
+	all := h.stats("server", StatsPeriodAllTime, 1, now)
+	if all.TotalPlays != 4 || len(all.TopTracks) != 1 {
+		t.Errorf("all time: %d plays, top tracks %+v; want 4 plays, 1 top track", all.TotalPlays, all.TopTracks)
+	}
+	if len(all.Daily) != 11 {
+		t.Errorf("all time: %d days, want 11", len(all.Daily))
+	}
+}
+
+func Test_StatsPeriodStart(t *testing.T) {
+	sunday := time.Date(2026, 10, 18, 23, 0, 0, 0, time.Local)
+	tests := []struct {
+		period StatsPeriod
+		want   time.Time
+	}{
+		{StatsPeriodWeek, time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local)},
+		{StatsPeriodMonth, time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)},
+		{StatsPeriodYear, time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)},
+		{StatsPeriodAllTime, time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := tt.period.Start(sunday); !got.Equal(tt.want) {
+			t.Errorf("start of period %d = %v, want %v", tt.period, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package mediaprovider
 import (
 	"image"
 	"io"
+	"time"
 )
 
 type AlbumFilter struct {
@@ -47,6 +48,8 @@ type MediaProvider interface {
 
 	GetPlaylist(playlistID string) (*PlaylistWithTracks, error)
 
+	GetTrack(trackID string) (*Track, error)
+
 	GetCoverArt(coverArtID string, size int) (image.Image, error)
 
 	AlbumSortOrders() []string
@@ -87,9 +90,32 @@ type MediaProvider interface {
 
 	DeletePlaylist(id string) error
 
-	Scrobble(trackID string, submission bool) error
+	// Submits a play of the track at the given time, or a "now playing"
+	// notification if submission is false.
+	Scrobble(trackID string, submission bool, playTime time.Time) error
 
 	DownloadTrack(trackID string) (io.Reader, error)
 
 	RescanLibrary() error
 }
+
+// Optionally implemented by MediaProviders which can look up server-side
+// ReplayGain metadata for a track that wasn't included in the Track model.
+type ReplayGainProvider interface {
+	// Returns nil, nil if the server has no ReplayGain metadata for the track.
+	GetReplayGain(trackID string) (*ReplayGain, error)
+}
+
+// Optionally implemented by MediaProviders which can look up
+// the MusicBrainz IDs of a track, for submitting to external services.
+type MusicBrainzIDProvider interface {
+	// Returns the IDs that are known. Any or all may be empty.
+	GetMusicBrainzIDs(trackID string) (*MusicBrainzIDs, error)
+}
+
+// Optionally implemented by MediaProviders which can search
+// artists, albums and tracks with a single request.
+type SearchProvider interface {
+	// Returns up to maxResults of each kind of item matching the query.
+	Search(searchQuery string, maxResults int) (*SearchResults, error)
+}
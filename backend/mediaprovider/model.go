@@ -70,8 +70,43 @@ type Track struct {
 	PlayCount   int
 	FilePath    string
 	BitRate     int
+	Type        TrackType
+	// nil if not (yet) known
+	ReplayGain *ReplayGain
 }
 
+// ReplayGain metadata for a track. Gains are in dB,
+// and peaks are linear amplitudes (0 if unknown).
+type ReplayGain struct {
+	TrackGain float64
+	AlbumGain float64
+	TrackPeak float64
+	AlbumPeak float64
+}
+
+// The MusicBrainz IDs associated with a track.
+type MusicBrainzIDs struct {
+	Recording string
+	Release   string
+	Artists   []string
+}
+
+// Items matching a search query, as returned by SearchProvider.
+type SearchResults struct {
+	Artists []*Artist
+	Albums  []*Album
+	Tracks  []*Track
+}
+
+// The kind of media a track is. Music, unless the server says otherwise.
+type TrackType string
+
+const (
+	TrackTypeMusic     TrackType = "music"
+	TrackTypePodcast   TrackType = "podcast"
+	TrackTypeAudiobook TrackType = "audiobook"
+)
+
 type Playlist struct {
 	ID          string
 	CoverArtID  string
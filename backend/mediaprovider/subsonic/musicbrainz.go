@@ -0,0 +1,100 @@
+package subsonic
+
+import (
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/url"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+var _ mediaprovider.MusicBrainzIDProvider = (*subsonicMediaProvider)(nil)
+
+// The OpenSubsonic MusicBrainz IDs of a song and its artists, which go-subsonic doesn't parse.
+type musicBrainzIDResponse struct {
+	Error *struct {
+		Message string `xml:"message,attr"`
+	} `xml:"error"`
+	Song struct {
+		AlbumID       string `xml:"albumId,attr"`
+		MusicBrainzID string `xml:"musicBrainzId,attr"`
+		Artists       []struct {
+			MusicBrainzID string `xml:"musicBrainzId,attr"`
+		} `xml:"artists"`
+	} `xml:"song"`
+}
+
+// Maximum number of tracks and albums whose MusicBrainz IDs are cached.
+const maxCachedMBIDs = 500
+
+// Results are cached, since a track is usually scrobbled to several services
+// and most tracks played in a session are from the same few albums.
+func (s *subsonicMediaProvider) GetMusicBrainzIDs(trackID string) (*mediaprovider.MusicBrainzIDs, error) {
+	s.mbidMutex.Lock()
+	ids, ok := s.trackMBIDs[trackID]
+	s.mbidMutex.Unlock()
+	if ok {
+		return ids, nil
+	}
+
+	resp, err := s.client.Request("GET", "getSong", url.Values{"id": {trackID}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var parsed musicBrainzIDResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	if parsed.Error != nil {
+		return nil, errors.New(parsed.Error.Message)
+	}
+	ids = parseMusicBrainzIDs(parsed)
+	if albumID := parsed.Song.AlbumID; albumID != "" {
+		ids.Release = s.albumReleaseMBID(albumID)
+	}
+
+	s.mbidMutex.Lock()
+	if s.trackMBIDs == nil || len(s.trackMBIDs) >= maxCachedMBIDs {
+		s.trackMBIDs = make(map[string]*mediaprovider.MusicBrainzIDs)
+	}
+	s.trackMBIDs[trackID] = ids
+	s.mbidMutex.Unlock()
+	return ids, nil
+}
+
+// Returns the MusicBrainz release ID of the album, which
+// is only available from the album info, or "" if unknown.
+func (s *subsonicMediaProvider) albumReleaseMBID(albumID string) string {
+	s.mbidMutex.Lock()
+	release, ok := s.albumReleases[albumID]
+	s.mbidMutex.Unlock()
+	if ok {
+		return release
+	}
+
+	info, err := s.GetAlbumInfo(albumID)
+	if err != nil {
+		// not cached, so it's retried for the album's next track
+		log.Printf("error getting album info: %s", err.Error())
+		return ""
+	}
+	s.mbidMutex.Lock()
+	if s.albumReleases == nil || len(s.albumReleases) >= maxCachedMBIDs {
+		s.albumReleases = make(map[string]string)
+	}
+	s.albumReleases[albumID] = info.MusicBrainzID
+	s.mbidMutex.Unlock()
+	return info.MusicBrainzID
+}
+
+func parseMusicBrainzIDs(parsed musicBrainzIDResponse) *mediaprovider.MusicBrainzIDs {
+	ids := &mediaprovider.MusicBrainzIDs{Recording: parsed.Song.MusicBrainzID}
+	for _, a := range parsed.Song.Artists {
+		if a.MusicBrainzID != "" {
+			ids.Artists = append(ids.Artists, a.MusicBrainzID)
+		}
+	}
+	return ids
+}
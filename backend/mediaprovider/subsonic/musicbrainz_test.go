@@ -0,0 +1,63 @@
+package subsonic
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/dweymouth/go-subsonic/subsonic"
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+func Test_ParseMusicBrainzIDs(t *testing.T) {
+	resp := `<subsonic-response status="ok"><song id="1" albumId="2" musicBrainzId="rec-id">` +
+		`<artists id="3" name="A" musicBrainzId="artist-1" /><artists id="4" name="B" />` +
+		`<artists id="5" name="C" musicBrainzId="artist-2" /></song></subsonic-response>`
+	var parsed musicBrainzIDResponse
+	if err := xml.Unmarshal([]byte(resp), &parsed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &mediaprovider.MusicBrainzIDs{Recording: "rec-id", Artists: []string{"artist-1", "artist-2"}}
+	if got := parseMusicBrainzIDs(parsed); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if parsed.Song.AlbumID != "2" {
+		t.Errorf("got album ID %q, want %q", parsed.Song.AlbumID, "2")
+	}
+}
+
+func Test_GetMusicBrainzIDs_Cached(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := path.Base(r.URL.Path)
+		requests[endpoint]++
+		switch endpoint {
+		case "getSong":
+			fmt.Fprintf(w, `<subsonic-response status="ok"><song id="%s" albumId="al" musicBrainzId="rec-%s" /></subsonic-response>`,
+				r.URL.Query().Get("id"), r.URL.Query().Get("id"))
+		case "getAlbumInfo":
+			fmt.Fprint(w, `<subsonic-response status="ok"><albumInfo><musicBrainzId>rel-id</musicBrainzId></albumInfo></subsonic-response>`)
+		}
+	}))
+	defer server.Close()
+	s := &subsonicMediaProvider{client: &subsonic.Client{Client: server.Client(), BaseUrl: server.URL}}
+
+	for _, id := range []string{"1", "2", "1"} {
+		ids, err := s.GetMusicBrainzIDs(id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := &mediaprovider.MusicBrainzIDs{Recording: "rec-" + id, Release: "rel-id"}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("got %+v, want %+v", ids, want)
+		}
+	}
+	if requests["getSong"] != 2 || requests["getAlbumInfo"] != 1 {
+		t.Errorf("got %d getSong and %d getAlbumInfo requests, want 2 and 1",
+			requests["getSong"], requests["getAlbumInfo"])
+	}
+}
@@ -0,0 +1,81 @@
+package subsonic
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+var _ mediaprovider.ReplayGainProvider = (*subsonicMediaProvider)(nil)
+
+// TODO: the go-subsonic version in use doesn't decode the OpenSubsonic replayGain
+// element of songs. Once it does, set Track.ReplayGain in toTrack and remove this
+// lookup, along with the PlaybackManager's lookup and prefetch of it.
+
+// The OpenSubsonic replayGain element of a song, which go-subsonic doesn't
+// parse. Attributes are strings to distinguish missing values from zero.
+type replayGainResponse struct {
+	Error *struct {
+		Message string `xml:"message,attr"`
+	} `xml:"error"`
+	Song struct {
+		ReplayGain *struct {
+			TrackGain string `xml:"trackGain,attr"`
+			AlbumGain string `xml:"albumGain,attr"`
+			TrackPeak string `xml:"trackPeak,attr"`
+			AlbumPeak string `xml:"albumPeak,attr"`
+		} `xml:"replayGain"`
+	} `xml:"song"`
+}
+
+func (s *subsonicMediaProvider) GetReplayGain(trackID string) (*mediaprovider.ReplayGain, error) {
+	resp, err := s.client.Request("GET", "getSong", url.Values{"id": {trackID}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var parsed replayGainResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	if parsed.Error != nil {
+		return nil, errors.New(parsed.Error.Message)
+	}
+	return parseReplayGain(parsed)
+}
+
+func parseReplayGain(parsed replayGainResponse) (*mediaprovider.ReplayGain, error) {
+	r := parsed.Song.ReplayGain
+	if r == nil || (r.TrackGain == "" && r.AlbumGain == "") {
+		return nil, nil
+	}
+	var rg mediaprovider.ReplayGain
+	for _, f := range []struct {
+		s string
+		v *float64
+	}{
+		{r.TrackGain, &rg.TrackGain},
+		{r.AlbumGain, &rg.AlbumGain},
+		{r.TrackPeak, &rg.TrackPeak},
+		{r.AlbumPeak, &rg.AlbumPeak},
+	} {
+		if f.s == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(f.s, 64)
+		if err != nil {
+			return nil, err
+		}
+		*f.v = v
+	}
+	// servers may report only one of the gains
+	if r.TrackGain == "" {
+		rg.TrackGain, rg.TrackPeak = rg.AlbumGain, rg.AlbumPeak
+	} else if r.AlbumGain == "" {
+		rg.AlbumGain, rg.AlbumPeak = rg.TrackGain, rg.TrackPeak
+	}
+	return &rg, nil
+}
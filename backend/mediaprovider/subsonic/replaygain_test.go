@@ -0,0 +1,43 @@
+package subsonic
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+func Test_ParseReplayGain(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want *mediaprovider.ReplayGain
+	}{
+		{
+			name: "track and album",
+			xml:  `<song id="1"><replayGain trackGain="-7.5" albumGain="-8" trackPeak="0.98" albumPeak="1" /></song>`,
+			want: &mediaprovider.ReplayGain{TrackGain: -7.5, AlbumGain: -8, TrackPeak: 0.98, AlbumPeak: 1},
+		},
+		{
+			name: "album only",
+			xml:  `<song id="1"><replayGain albumGain="-8" albumPeak="0.9" /></song>`,
+			want: &mediaprovider.ReplayGain{TrackGain: -8, AlbumGain: -8, TrackPeak: 0.9, AlbumPeak: 0.9},
+		},
+		{
+			name: "no replayGain",
+			xml:  `<song id="1"></song>`,
+		},
+	}
+	for _, tt := range tests {
+		var parsed replayGainResponse
+		if err := xml.Unmarshal([]byte(`<subsonic-response status="ok">`+tt.xml+`</subsonic-response>`), &parsed); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		got, err := parseReplayGain(parsed)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
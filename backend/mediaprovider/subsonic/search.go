@@ -0,0 +1,30 @@
+package subsonic
+
+import (
+	"strconv"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/sharedutil"
+)
+
+var _ mediaprovider.SearchProvider = (*subsonicMediaProvider)(nil)
+
+func (s *subsonicMediaProvider) Search(searchQuery string, maxResults int) (*mediaprovider.SearchResults, error) {
+	count := strconv.Itoa(maxResults)
+	results, err := s.client.Search3(searchQuery, map[string]string{
+		"artistCount": count,
+		"albumCount":  count,
+		"songCount":   count,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		return &mediaprovider.SearchResults{}, nil
+	}
+	return &mediaprovider.SearchResults{
+		Artists: sharedutil.MapSlice(results.Artist, toArtistFromID3),
+		Albums:  sharedutil.MapSlice(results.Album, toAlbum),
+		Tracks:  sharedutil.MapSlice(results.Song, toTrack),
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"math"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +18,12 @@ import (
 type subsonicMediaProvider struct {
 	client          *subsonic.Client
 	prefetchCoverCB func(coverArtID string)
+
+	// MusicBrainz IDs looked up for scrobbling, by track ID,
+	// and MusicBrainz release IDs by album ID
+	mbidMutex     sync.Mutex
+	trackMBIDs    map[string]*mediaprovider.MusicBrainzIDs
+	albumReleases map[string]string
 }
 
 func SubsonicMediaProvider(subsonicClient *subsonic.Client) mediaprovider.MediaProvider {
@@ -152,6 +159,14 @@ func (s *subsonicMediaProvider) GetGenres() ([]*mediaprovider.Genre, error) {
 	}), nil
 }
 
+func (s *subsonicMediaProvider) GetTrack(trackID string) (*mediaprovider.Track, error) {
+	tr, err := s.client.GetSong(trackID)
+	if err != nil {
+		return nil, err
+	}
+	return toTrack(tr), nil
+}
+
 func (s *subsonicMediaProvider) GetPlaylist(playlistID string) (*mediaprovider.PlaylistWithTracks, error) {
 	pl, err := s.client.GetPlaylist(playlistID)
 	if err != nil {
@@ -216,9 +231,9 @@ func (s *subsonicMediaProvider) ReplacePlaylistTracks(playlistID string, trackID
 	return s.client.CreatePlaylistWithTracks(trackIDs, map[string]string{"playlistId": playlistID})
 }
 
-func (s *subsonicMediaProvider) Scrobble(trackID string, submission bool) error {
+func (s *subsonicMediaProvider) Scrobble(trackID string, submission bool, playTime time.Time) error {
 	return s.client.Scrobble(trackID, map[string]string{
-		"time":       strconv.FormatInt(time.Now().UnixMilli(), 10),
+		"time":       strconv.FormatInt(playTime.UnixMilli(), 10),
 		"submission": strconv.FormatBool(submission)})
 }
 
@@ -296,7 +311,21 @@ func toTrack(ch *subsonic.Child) *mediaprovider.Track {
 		FilePath:    ch.Path,
 		Size:        ch.Size,
 		BitRate:     ch.BitRate,
+		Type:        toTrackType(ch.Type, ch.Genre),
+	}
+}
+
+// Many servers report every track as "music", so also
+// recognize podcasts and audiobooks by genre.
+func toTrackType(typ, genre string) mediaprovider.TrackType {
+	genre = strings.TrimSuffix(strings.ToLower(genre), "s")
+	switch {
+	case typ == "podcast" || genre == "podcast":
+		return mediaprovider.TrackTypePodcast
+	case typ == "audiobook" || genre == "audiobook":
+		return mediaprovider.TrackTypeAudiobook
 	}
+	return mediaprovider.TrackTypeMusic
 }
 
 func toAlbum(al *subsonic.AlbumID3) *mediaprovider.Album {
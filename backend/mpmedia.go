@@ -6,7 +6,7 @@ import (
 
 // MPMediaHandler is the handler for MacOS media controls and system events.
 type MPMediaHandler struct {
-	player          *player.Player
+	player          player.BasePlayer
 	playbackManager *PlaybackManager
 	ArtURLLookup    func(trackID string) (string, error)
 }
@@ -54,7 +54,7 @@ var mpMediaEventRecipient *MPMediaHandler
 
 // NewMPMediaHandler creates a new MPMediaHandler instances and sets it as the current recipient
 // for incoming system events.
-func NewMPMediaHandler(player *player.Player, playbackManager *PlaybackManager) *MPMediaHandler {
+func NewMPMediaHandler(player player.BasePlayer, playbackManager *PlaybackManager) *MPMediaHandler {
 	mp := &MPMediaHandler{
 		player:          player,
 		playbackManager: playbackManager,
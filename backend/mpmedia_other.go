@@ -4,7 +4,7 @@ package backend
 
 import "github.com/dweymouth/supersonic/player"
 
-func NewMPMediaHandler(player *player.Player, playbackManager *PlaybackManager) *MPMediaHandler {
+func NewMPMediaHandler(player player.BasePlayer, playbackManager *PlaybackManager) *MPMediaHandler {
 	// MPMediaHandler only supports macOS.
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/dweymouth/supersonic/backend/mediaprovider"
 	"github.com/dweymouth/supersonic/player"
@@ -37,19 +39,39 @@ type MPRISHandler struct {
 	// Function called if the player is requested to bring its UI to the front.
 	OnRaise func() error
 
+	// Function called to open a supersonic:// link.
+	OnOpenURI func(uri string) error
+
 	// Function to look up the artwork URL for a given track ID
 	ArtURLLookup func(trackID string) (string, error)
 
+	// Function to look up a track by ID, to add to the queue through the
+	// TrackList interface. The track list can only be edited if this is set.
+	TrackLookup func(trackID string) (*mediaprovider.Track, error)
+
+	// Function to look up the playlists offered through the Playlists interface.
+	PlaylistsLookup func() ([]*mediaprovider.Playlist, error)
+
 	connErr      error
 	playerName   string
 	curTrackPath string // empty for no track
-	p            *player.Player
+	p            player.BasePlayer
 	pm           *PlaybackManager
 	s            *server.Server
 	evt          *events.EventHandler
-}
-
-func NewMPRISHandler(playerName string, p *player.Player, pm *PlaybackManager) *MPRISHandler {
+	props        map[string]map[string]mprisProperty
+	// object paths of the tracks last reported through the TrackList interface
+	trackListPaths []dbus.ObjectPath
+	entryIDs       queueEntryIDs
+	// ID of the active playlist last reported through the Playlists interface
+	activePlaylistID string
+	// cache of the playlists offered through the Playlists interface
+	playlistsMutex   sync.Mutex
+	playlists        []*mediaprovider.Playlist
+	playlistsFetched time.Time
+}
+
+func NewMPRISHandler(playerName string, p player.BasePlayer, pm *PlaybackManager) *MPRISHandler {
 	m := &MPRISHandler{playerName: playerName, p: p, pm: pm, connErr: errors.New("not started")}
 	m.s = server.NewServer(playerName, m, m)
 	m.evt = events.NewEventHandler(m.s)
@@ -67,7 +89,7 @@ func NewMPRISHandler(playerName string, p *player.Player, pm *PlaybackManager) *
 		if tr == nil {
 			m.curTrackPath = ""
 		} else {
-			m.curTrackPath = dbusTrackIDPrefix + encodeTrackId(tr.ID)
+			m.curTrackPath = string(m.entryObjectPath(tr))
 		}
 	})
 	m.pm.OnVolumeChange(func(vol int) {
@@ -75,6 +97,11 @@ func NewMPRISHandler(playerName string, p *player.Player, pm *PlaybackManager) *
 			m.evt.Player.OnVolume()
 		}
 	})
+	m.pm.OnSpeedChange(func(float64) {
+		if m.connErr == nil {
+			m.evt.Player.OnPlayback() // includes Rate
+		}
+	})
 	emitPlayStatus := func() {
 		if m.connErr == nil {
 			m.evt.Player.OnPlayPause()
@@ -83,6 +110,10 @@ func NewMPRISHandler(playerName string, p *player.Player, pm *PlaybackManager) *
 	m.p.OnStopped(emitPlayStatus)
 	m.p.OnPlaying(emitPlayStatus)
 	m.p.OnPaused(emitPlayStatus)
+	m.pm.OnQueueChange(func() {
+		m.emitTrackListChanges()
+		m.emitActivePlaylistChange()
+	})
 
 	return m
 }
@@ -91,8 +122,9 @@ func NewMPRISHandler(playerName string, p *player.Player, pm *PlaybackManager) *
 func (m *MPRISHandler) Start() {
 	m.connErr = nil
 	go func() {
-		// exits early with err if unable to establish D-Bus connection
-		m.connErr = m.s.Listen()
+		if err := m.listen(); err != nil {
+			m.connErr = err
+		}
 	}()
 }
 
@@ -133,11 +165,14 @@ func (m *MPRISHandler) Raise() error {
 }
 
 func (m *MPRISHandler) HasTrackList() (bool, error) {
-	return false, nil
+	return true, nil
 }
 
 func (m *MPRISHandler) SupportedUriSchemes() ([]string, error) {
-	return nil, nil
+	if m.OnOpenURI == nil {
+		return nil, nil
+	}
+	return []string{DeepLinkScheme}, nil
 }
 
 func (m *MPRISHandler) SupportedMimeTypes() ([]string, error) {
@@ -191,7 +226,10 @@ func (m *MPRISHandler) SetPosition(trackId string, position types.Microseconds)
 }
 
 func (m *MPRISHandler) OpenUri(uri string) error {
-	return errNotSupported
+	if m.OnOpenURI == nil {
+		return errNotSupported
+	}
+	return m.OnOpenURI(uri)
 }
 
 func (m *MPRISHandler) PlaybackStatus() (types.PlaybackStatus, error) {
@@ -231,11 +269,15 @@ func (m *MPRISHandler) SetLoopStatus(status types.LoopStatus) error {
 }
 
 func (m *MPRISHandler) Rate() (float64, error) {
-	return 1, nil
+	return m.pm.Speed(), nil
 }
 
-func (m *MPRISHandler) SetRate(float64) error {
-	return errNotSupported
+func (m *MPRISHandler) SetRate(rate float64) error {
+	// per the MPRIS spec, a rate of 0 should act as a pause
+	if rate <= 0 {
+		return m.Pause()
+	}
+	return m.pm.SetSpeed(rate)
 }
 
 func (m *MPRISHandler) Metadata() (types.Metadata, error) {
@@ -248,6 +290,14 @@ func (m *MPRISHandler) Metadata() (types.Metadata, error) {
 	if np := m.pm.NowPlaying(); np != nil && status.State != player.Stopped {
 		tr = *np
 	}
+	meta := m.trackMetadata(&tr, status.Duration)
+	meta.TrackId = dbus.ObjectPath(trackObjPath)
+	return meta, nil
+}
+
+// Returns the metadata of the track, except for the TrackId,
+// which depends on the track's entry in the play queue.
+func (m *MPRISHandler) trackMetadata(tr *mediaprovider.Track, duration float64) types.Metadata {
 	var artURL string
 	if tr.ID != "" && m.ArtURLLookup != nil {
 		if u, err := m.ArtURLLookup(tr.CoverArtID); err == nil {
@@ -255,8 +305,7 @@ func (m *MPRISHandler) Metadata() (types.Metadata, error) {
 		}
 	}
 	return types.Metadata{
-		TrackId:        dbus.ObjectPath(trackObjPath),
-		Length:         secondsToMicroseconds(status.Duration),
+		Length:         secondsToMicroseconds(duration),
 		Title:          tr.Name,
 		Album:          tr.Album,
 		Artist:         tr.ArtistNames,
@@ -267,7 +316,7 @@ func (m *MPRISHandler) Metadata() (types.Metadata, error) {
 		ContentCreated: strconv.Itoa(tr.Year),
 		UseCount:       tr.PlayCount,
 		ArtUrl:         artURL,
-	}, nil
+	}
 }
 
 func (m *MPRISHandler) Volume() (float64, error) {
@@ -283,11 +332,11 @@ func (m *MPRISHandler) Position() (int64, error) {
 }
 
 func (m *MPRISHandler) MinimumRate() (float64, error) {
-	return 1, nil
+	return player.MinSpeed, nil
 }
 
 func (m *MPRISHandler) MaximumRate() (float64, error) {
-	return 1, nil
+	return player.MaxSpeed, nil
 }
 
 func (m *MPRISHandler) CanGoNext() (bool, error) {
@@ -326,4 +375,3 @@ func encodeTrackId(id string) string {
 	data := []byte(id)
 	return base32.StdEncoding.WithPadding('0').EncodeToString(data)
 }
-
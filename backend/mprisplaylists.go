@@ -0,0 +1,179 @@
+package backend
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	dbusPlaylistIDPrefix = "/Supersonic/Playlist/"
+
+	mprisOrderAlphabetical = "Alphabetical"
+	mprisOrderUserDefined  = "UserDefined"
+
+	// how long the server's playlists are cached for, since MPRIS
+	// clients may read the playlist properties frequently
+	mprisPlaylistsCacheTime = time.Minute
+)
+
+var errUnknownPlaylist = errors.New("unknown playlist")
+
+// An MPRIS playlist, of D-Bus signature (oss)
+type mprisPlaylist struct {
+	ID   dbus.ObjectPath
+	Name string
+	Icon string
+}
+
+// The MPRIS active playlist, of D-Bus signature (b(oss)).
+// If not Valid, the playlist has the ID "/".
+type mprisMaybePlaylist struct {
+	Valid    bool
+	Playlist mprisPlaylist
+}
+
+// org.mpris.MediaPlayer2.Playlists implementation, backed by the server playlists.
+
+func (m *MPRISHandler) GetPlaylists(index, maxCount uint32, order string, reverseOrder bool) ([]mprisPlaylist, error) {
+	playlists, err := m.getPlaylists()
+	if err != nil {
+		return nil, err
+	}
+	if order == mprisOrderAlphabetical {
+		sort.SliceStable(playlists, func(i, j int) bool {
+			return strings.ToLower(playlists[i].Name) < strings.ToLower(playlists[j].Name)
+		})
+	}
+	if reverseOrder {
+		for i, j := 0, len(playlists)-1; i < j; i, j = i+1, j-1 {
+			playlists[i], playlists[j] = playlists[j], playlists[i]
+		}
+	}
+	if int(index) >= len(playlists) {
+		return []mprisPlaylist{}, nil
+	}
+	playlists = playlists[index:]
+	if int(maxCount) < len(playlists) {
+		playlists = playlists[:maxCount]
+	}
+	result := make([]mprisPlaylist, len(playlists))
+	for i, pl := range playlists {
+		result[i] = m.toMPRISPlaylist(pl)
+	}
+	return result, nil
+}
+
+func (m *MPRISHandler) ActivatePlaylist(playlistID dbus.ObjectPath) error {
+	playlists, err := m.getPlaylists()
+	if err != nil {
+		return err
+	}
+	for _, pl := range playlists {
+		if playlistObjectPath(pl.ID) == playlistID {
+			return m.pm.PlayPlaylist(pl.ID, 0, false)
+		}
+	}
+	return errUnknownPlaylist
+}
+
+func (m *MPRISHandler) PlaylistCount() (uint32, error) {
+	playlists, err := m.getPlaylists()
+	return uint32(len(playlists)), err
+}
+
+func (m *MPRISHandler) Orderings() ([]string, error) {
+	return []string{mprisOrderAlphabetical, mprisOrderUserDefined}, nil
+}
+
+func (m *MPRISHandler) ActivePlaylist() (mprisMaybePlaylist, error) {
+	return m.activePlaylist(m.pm.PlaylistID())
+}
+
+func (m *MPRISHandler) activePlaylist(id string) (mprisMaybePlaylist, error) {
+	if id == "" {
+		return mprisMaybePlaylist{Playlist: mprisPlaylist{ID: "/"}}, nil
+	}
+	playlists, err := m.getPlaylists()
+	if err != nil {
+		return mprisMaybePlaylist{}, err
+	}
+	for _, pl := range playlists {
+		if pl.ID == id {
+			return mprisMaybePlaylist{Valid: true, Playlist: m.toMPRISPlaylist(pl)}, nil
+		}
+	}
+	return mprisMaybePlaylist{Playlist: mprisPlaylist{ID: "/"}}, nil
+}
+
+// Emits a change of the ActivePlaylist property, if the play queue
+// has been loaded from a different playlist since the last call.
+func (m *MPRISHandler) emitActivePlaylistChange() {
+	id := m.pm.PlaylistID()
+	if id == m.activePlaylistID {
+		return
+	}
+	m.activePlaylistID = id
+	if m.connErr != nil || m.s.Conn == nil {
+		return
+	}
+	// looking up the playlist may need a server request,
+	// so don't block the caller changing the play queue
+	go func() {
+		active, err := m.activePlaylist(id)
+		if err == nil {
+			err = m.emitPropertiesChanged(mprisPlaylistsIface,
+				map[string]dbus.Variant{"ActivePlaylist": dbus.MakeVariant(active)}, nil)
+		}
+		if err != nil {
+			log.Printf("error emitting MPRIS active playlist change: %s", err.Error())
+		}
+	}()
+}
+
+// Returns the server's playlists, which are cached for mprisPlaylistsCacheTime.
+// The returned slice may be modified by the caller.
+func (m *MPRISHandler) getPlaylists() ([]*mediaprovider.Playlist, error) {
+	if m.PlaylistsLookup == nil {
+		return nil, nil
+	}
+	m.playlistsMutex.Lock()
+	defer m.playlistsMutex.Unlock()
+	if m.playlists == nil || time.Since(m.playlistsFetched) > mprisPlaylistsCacheTime {
+		playlists, err := m.PlaylistsLookup()
+		if err != nil {
+			return nil, err
+		}
+		if playlists == nil {
+			playlists = []*mediaprovider.Playlist{}
+		}
+		m.playlists, m.playlistsFetched = playlists, time.Now()
+	}
+	return append([]*mediaprovider.Playlist(nil), m.playlists...), nil
+}
+
+// Forgets the cached playlists, eg. after logging out of the server.
+func (m *MPRISHandler) clearPlaylistsCache() {
+	m.playlistsMutex.Lock()
+	m.playlists = nil
+	m.playlistsMutex.Unlock()
+}
+
+func (m *MPRISHandler) toMPRISPlaylist(pl *mediaprovider.Playlist) mprisPlaylist {
+	var icon string
+	if pl.CoverArtID != "" && m.ArtURLLookup != nil {
+		if u, err := m.ArtURLLookup(pl.CoverArtID); err == nil {
+			icon = u
+		}
+	}
+	return mprisPlaylist{ID: playlistObjectPath(pl.ID), Name: pl.Name, Icon: icon}
+}
+
+func playlistObjectPath(id string) dbus.ObjectPath {
+	return dbus.ObjectPath(dbusPlaylistIDPrefix + encodeTrackId(id))
+}
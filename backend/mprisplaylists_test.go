@@ -0,0 +1,45 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/sharedutil"
+)
+
+func Test_MPRISGetPlaylists(t *testing.T) {
+	lookups := 0
+	m := &MPRISHandler{PlaylistsLookup: func() ([]*mediaprovider.Playlist, error) {
+		lookups++
+		return []*mediaprovider.Playlist{
+			{ID: "1", Name: "b"}, {ID: "2", Name: "C"}, {ID: "3", Name: "a"},
+		}, nil
+	}}
+	for _, tt := range []struct {
+		index, maxCount uint32
+		order           string
+		reverse         bool
+		want            []string
+	}{
+		{0, 10, mprisOrderUserDefined, false, []string{"b", "C", "a"}},
+		{0, 10, mprisOrderAlphabetical, false, []string{"a", "b", "C"}},
+		{0, 2, mprisOrderAlphabetical, true, []string{"C", "b"}},
+		{1, 10, mprisOrderUserDefined, false, []string{"C", "a"}},
+		{5, 10, mprisOrderUserDefined, false, nil},
+	} {
+		playlists, err := m.GetPlaylists(tt.index, tt.maxCount, tt.order, tt.reverse)
+		if err != nil {
+			t.Fatalf("GetPlaylists failed: %v", err)
+		}
+		var names []string
+		for _, pl := range playlists {
+			names = append(names, pl.Name)
+		}
+		if !sharedutil.SliceEqual(names, tt.want) {
+			t.Errorf("GetPlaylists(%d, %d, %s, %v) = %v, want %v", tt.index, tt.maxCount, tt.order, tt.reverse, names, tt.want)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("playlists looked up %d times, want 1", lookups)
+	}
+}
@@ -0,0 +1,327 @@
+package backend
+
+import (
+	"errors"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/quarckster/go-mpris-server/pkg/types"
+)
+
+const (
+	mprisObjectPath     = "/org/mpris/MediaPlayer2"
+	mprisRootIface      = "org.mpris.MediaPlayer2"
+	mprisPlayerIface    = "org.mpris.MediaPlayer2.Player"
+	mprisTrackListIface = "org.mpris.MediaPlayer2.TrackList"
+	mprisPlaylistsIface = "org.mpris.MediaPlayer2.Playlists"
+	dbusPropertiesIface = "org.freedesktop.DBus.Properties"
+)
+
+// A property of an exported MPRIS interface. Set is nil for read-only properties.
+type mprisProperty struct {
+	Get func() (interface{}, error)
+	Set func(dbus.Variant) error
+}
+
+func readOnlyProp[T any](get func() (T, error)) mprisProperty {
+	return mprisProperty{Get: func() (interface{}, error) {
+		v, err := get()
+		return v, err
+	}}
+}
+
+func readWriteProp[T any](get func() (T, error), set func(T) error) mprisProperty {
+	p := readOnlyProp(get)
+	p.Set = func(v dbus.Variant) error {
+		t, ok := v.Value().(T)
+		if !ok {
+			return prop.ErrInvalidArg
+		}
+		return set(t)
+	}
+	return p
+}
+
+// Claims the MPRIS bus name and exports the MPRIS interfaces.
+// go-mpris-server only serves the root and Player interfaces,
+// so all interfaces and their properties are exported here.
+func (m *MPRISHandler) listen() error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	m.s.Conn = conn
+	name := "org.mpris.MediaPlayer2." + m.playerName
+	reply, err := conn.RequestName(name, dbus.NameFlagReplaceExisting)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		return errors.New("unable to claim " + name)
+	}
+	m.props = m.properties()
+	if err := m.exportMethods(conn); err != nil {
+		conn.ReleaseName(name)
+		return err
+	}
+	return nil
+}
+
+func (m *MPRISHandler) exportMethods(conn *dbus.Conn) error {
+	tables := map[string]map[string]interface{}{
+		mprisRootIface: {
+			"Raise": func() *dbus.Error { return dbusError(m.Raise()) },
+			"Quit":  func() *dbus.Error { return dbusError(m.Quit()) },
+		},
+		mprisPlayerIface: {
+			"Next":      func() *dbus.Error { return dbusError(m.Next()) },
+			"Previous":  func() *dbus.Error { return dbusError(m.Previous()) },
+			"Pause":     func() *dbus.Error { return dbusError(m.Pause()) },
+			"PlayPause": func() *dbus.Error { return dbusError(m.PlayPause()) },
+			"Stop":      func() *dbus.Error { return dbusError(m.Stop()) },
+			"Play":      func() *dbus.Error { return dbusError(m.Play()) },
+			"Seek": func(offset int64) *dbus.Error {
+				return dbusError(m.Seek(types.Microseconds(offset)))
+			},
+			"SetPosition": func(trackID dbus.ObjectPath, pos int64) *dbus.Error {
+				return dbusError(m.SetPosition(string(trackID), types.Microseconds(pos)))
+			},
+			"OpenUri": func(uri string) *dbus.Error { return dbusError(m.OpenUri(uri)) },
+		},
+		mprisTrackListIface: {
+			"GetTracksMetadata": func(ids []dbus.ObjectPath) ([]map[string]dbus.Variant, *dbus.Error) {
+				meta, err := m.GetTracksMetadata(ids)
+				return meta, dbusError(err)
+			},
+			"AddTrack": func(uri string, after dbus.ObjectPath, setAsCurrent bool) *dbus.Error {
+				return dbusError(m.AddTrack(uri, after, setAsCurrent))
+			},
+			"RemoveTrack": func(id dbus.ObjectPath) *dbus.Error { return dbusError(m.RemoveTrack(id)) },
+			"GoTo":        func(id dbus.ObjectPath) *dbus.Error { return dbusError(m.GoTo(id)) },
+		},
+		mprisPlaylistsIface: {
+			"GetPlaylists": func(index, maxCount uint32, order string, reverse bool) ([]mprisPlaylist, *dbus.Error) {
+				playlists, err := m.GetPlaylists(index, maxCount, order, reverse)
+				return playlists, dbusError(err)
+			},
+			"ActivatePlaylist": func(id dbus.ObjectPath) *dbus.Error { return dbusError(m.ActivatePlaylist(id)) },
+		},
+		dbusPropertiesIface: {
+			"Get":    m.getProperty,
+			"GetAll": m.getAllProperties,
+			"Set":    m.setProperty,
+		},
+	}
+	if err := conn.Export(introspect.Introspectable(mprisIntrospection),
+		mprisObjectPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return err
+	}
+	for iface, table := range tables {
+		if err := conn.ExportSubtreeMethodTable(table, mprisObjectPath, iface); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MPRISHandler) properties() map[string]map[string]mprisProperty {
+	return map[string]map[string]mprisProperty{
+		mprisRootIface: {
+			"CanQuit":             readOnlyProp(m.CanQuit),
+			"CanRaise":            readOnlyProp(m.CanRaise),
+			"HasTrackList":        readOnlyProp(m.HasTrackList),
+			"Identity":            readOnlyProp(m.Identity),
+			"SupportedUriSchemes": readOnlyProp(m.SupportedUriSchemes),
+			"SupportedMimeTypes":  readOnlyProp(m.SupportedMimeTypes),
+		},
+		mprisPlayerIface: {
+			"PlaybackStatus": readOnlyProp(m.PlaybackStatus),
+			"LoopStatus": readWriteProp(func() (string, error) {
+				s, err := m.LoopStatus()
+				return string(s), err
+			}, func(s string) error {
+				return m.SetLoopStatus(types.LoopStatus(s))
+			}),
+			"Rate": readWriteProp(m.Rate, m.SetRate),
+			"Metadata": readOnlyProp(func() (map[string]dbus.Variant, error) {
+				meta, err := m.Metadata()
+				return meta.MakeMap(), err
+			}),
+			"Volume":        readWriteProp(m.Volume, m.SetVolume),
+			"Position":      readOnlyProp(m.Position),
+			"MinimumRate":   readOnlyProp(m.MinimumRate),
+			"MaximumRate":   readOnlyProp(m.MaximumRate),
+			"CanGoNext":     readOnlyProp(m.CanGoNext),
+			"CanGoPrevious": readOnlyProp(m.CanGoPrevious),
+			"CanPlay":       readOnlyProp(m.CanPlay),
+			"CanPause":      readOnlyProp(m.CanPause),
+			"CanSeek":       readOnlyProp(m.CanSeek),
+			"CanControl":    readOnlyProp(m.CanControl),
+		},
+		mprisTrackListIface: {
+			"Tracks":        readOnlyProp(m.Tracks),
+			"CanEditTracks": readOnlyProp(m.CanEditTracks),
+		},
+		mprisPlaylistsIface: {
+			"PlaylistCount":  readOnlyProp(m.PlaylistCount),
+			"Orderings":      readOnlyProp(m.Orderings),
+			"ActivePlaylist": readOnlyProp(m.ActivePlaylist),
+		},
+	}
+}
+
+func (m *MPRISHandler) getProperty(iface, name string) (dbus.Variant, *dbus.Error) {
+	props, ok := m.props[iface]
+	if !ok {
+		return dbus.Variant{}, prop.ErrIfaceNotFound
+	}
+	p, ok := props[name]
+	if !ok {
+		return dbus.Variant{}, prop.ErrPropNotFound
+	}
+	v, err := p.Get()
+	if err != nil {
+		return dbus.Variant{}, dbus.MakeFailedError(err)
+	}
+	return dbus.MakeVariant(v), nil
+}
+
+func (m *MPRISHandler) getAllProperties(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	props, ok := m.props[iface]
+	if !ok {
+		return nil, prop.ErrIfaceNotFound
+	}
+	all := make(map[string]dbus.Variant, len(props))
+	for name, p := range props {
+		v, err := p.Get()
+		if err != nil {
+			return nil, dbus.MakeFailedError(err)
+		}
+		all[name] = dbus.MakeVariant(v)
+	}
+	return all, nil
+}
+
+func (m *MPRISHandler) setProperty(iface, name string, v dbus.Variant) *dbus.Error {
+	props, ok := m.props[iface]
+	if !ok {
+		return prop.ErrIfaceNotFound
+	}
+	p, ok := props[name]
+	if !ok {
+		return prop.ErrPropNotFound
+	}
+	if p.Set == nil {
+		return prop.ErrReadOnly
+	}
+	if err := p.Set(v); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return dbusError(m.emitPropertiesChanged(iface, map[string]dbus.Variant{name: v}, nil))
+}
+
+func (m *MPRISHandler) emitPropertiesChanged(iface string, changed map[string]dbus.Variant, invalidated []string) error {
+	if invalidated == nil {
+		invalidated = []string{}
+	}
+	return m.s.Conn.Emit(mprisObjectPath, dbusPropertiesIface+".PropertiesChanged",
+		iface, changed, invalidated)
+}
+
+func dbusError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	return dbus.MakeFailedError(err)
+}
+
+// Introspection data of the exported MPRIS object.
+const mprisIntrospection = `<node name="` + mprisObjectPath + `">
+  <interface name="org.mpris.MediaPlayer2">
+    <method name="Raise"/>
+    <method name="Quit"/>
+    <property name="CanQuit" type="b" access="read"/>
+    <property name="CanRaise" type="b" access="read"/>
+    <property name="HasTrackList" type="b" access="read"/>
+    <property name="Identity" type="s" access="read"/>
+    <property name="SupportedUriSchemes" type="as" access="read"/>
+    <property name="SupportedMimeTypes" type="as" access="read"/>
+  </interface>
+  <interface name="org.mpris.MediaPlayer2.Player">
+    <method name="Next"/>
+    <method name="Previous"/>
+    <method name="Pause"/>
+    <method name="PlayPause"/>
+    <method name="Stop"/>
+    <method name="Play"/>
+    <method name="Seek">
+      <arg direction="in" type="x" name="Offset"/>
+    </method>
+    <method name="SetPosition">
+      <arg direction="in" type="o" name="TrackId"/>
+      <arg direction="in" type="x" name="Position"/>
+    </method>
+    <method name="OpenUri">
+      <arg direction="in" type="s" name="Uri"/>
+    </method>
+    <property name="PlaybackStatus" type="s" access="read"/>
+    <property name="LoopStatus" type="s" access="readwrite"/>
+    <property name="Rate" type="d" access="readwrite"/>
+    <property name="Metadata" type="a{sv}" access="read"/>
+    <property name="Volume" type="d" access="readwrite"/>
+    <property name="Position" type="x" access="read"/>
+    <property name="MinimumRate" type="d" access="read"/>
+    <property name="MaximumRate" type="d" access="read"/>
+    <property name="CanGoNext" type="b" access="read"/>
+    <property name="CanGoPrevious" type="b" access="read"/>
+    <property name="CanPlay" type="b" access="read"/>
+    <property name="CanPause" type="b" access="read"/>
+    <property name="CanSeek" type="b" access="read"/>
+    <property name="CanControl" type="b" access="read"/>
+    <signal name="Seeked">
+      <arg name="Position" type="x"/>
+    </signal>
+  </interface>
+  <interface name="org.mpris.MediaPlayer2.TrackList">
+    <method name="GetTracksMetadata">
+      <arg direction="in" type="ao" name="TrackIds"/>
+      <arg direction="out" type="aa{sv}" name="Metadata"/>
+    </method>
+    <method name="AddTrack">
+      <arg direction="in" type="s" name="Uri"/>
+      <arg direction="in" type="o" name="AfterTrack"/>
+      <arg direction="in" type="b" name="SetAsCurrent"/>
+    </method>
+    <method name="RemoveTrack">
+      <arg direction="in" type="o" name="TrackId"/>
+    </method>
+    <method name="GoTo">
+      <arg direction="in" type="o" name="TrackId"/>
+    </method>
+    <property name="Tracks" type="ao" access="read"/>
+    <property name="CanEditTracks" type="b" access="read"/>
+    <signal name="TrackListReplaced">
+      <arg type="ao" name="Tracks"/>
+      <arg type="o" name="CurrentTrack"/>
+    </signal>
+    <signal name="TrackAdded">
+      <arg type="a{sv}" name="Metadata"/>
+      <arg type="o" name="AfterTrack"/>
+    </signal>
+    <signal name="TrackRemoved">
+      <arg type="o" name="TrackId"/>
+    </signal>
+  </interface>
+  <interface name="org.mpris.MediaPlayer2.Playlists">
+    <method name="ActivatePlaylist">
+      <arg direction="in" type="o" name="PlaylistId"/>
+    </method>
+    <method name="GetPlaylists">
+      <arg direction="in" type="u" name="Index"/>
+      <arg direction="in" type="u" name="MaxCount"/>
+      <arg direction="in" type="s" name="Order"/>
+      <arg direction="in" type="b" name="ReverseOrder"/>
+      <arg direction="out" type="a(oss)" name="Playlists"/>
+    </method>
+    <property name="PlaylistCount" type="u" access="read"/>
+    <property name="Orderings" type="as" access="read"/>
+    <property name="ActivePlaylist" type="(b(oss))" access="read"/>
+  </interface>` + introspect.IntrospectDataString + prop.IntrospectDataString + `</node>`
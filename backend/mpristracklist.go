@@ -0,0 +1,230 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/sharedutil"
+	"github.com/godbus/dbus/v5"
+)
+
+var errTrackNotInQueue = errors.New("track is not in the play queue")
+
+// org.mpris.MediaPlayer2.TrackList implementation, backed by the play queue.
+// Each queue entry has its own track ID, so that duplicate tracks in the
+// queue can be told apart. The IDs are assigned on first use to the
+// PlaybackManager's queue entries, which are distinct copies of the tracks.
+
+type queueEntryIDs struct {
+	mutex  sync.Mutex
+	nextID uint64
+	ids    map[*mediaprovider.Track]uint64
+}
+
+func (m *MPRISHandler) Tracks() ([]dbus.ObjectPath, error) {
+	return m.queueObjectPaths(m.pm.queueEntries(), false), nil
+}
+
+func (m *MPRISHandler) CanEditTracks() (bool, error) {
+	return m.TrackLookup != nil, nil
+}
+
+func (m *MPRISHandler) GetTracksMetadata(trackIDs []dbus.ObjectPath) ([]map[string]dbus.Variant, error) {
+	queue := m.pm.queueEntries()
+	paths := m.queueObjectPaths(queue, false)
+	meta := make([]map[string]dbus.Variant, 0, len(trackIDs))
+	for _, id := range trackIDs {
+		// per the spec, unknown track IDs are skipped
+		if idx := indexOfPath(paths, id); idx >= 0 {
+			md := m.trackMetadata(queue[idx], float64(queue[idx].Duration))
+			md.TrackId = id
+			meta = append(meta, md.MakeMap())
+		}
+	}
+	return meta, nil
+}
+
+// Adds the track linked by a supersonic://play/track/<id> URI.
+func (m *MPRISHandler) AddTrack(uri string, afterTrack dbus.ObjectPath, setAsCurrent bool) error {
+	if m.TrackLookup == nil {
+		return errNotSupported
+	}
+	link, err := ParseDeepLink(uri)
+	if err != nil || link.Kind != DeepLinkTrack {
+		return fmt.Errorf("unsupported track URI: %s", uri)
+	}
+	tr, err := m.TrackLookup(link.ID)
+	if err != nil {
+		return err
+	}
+	idx := 0
+	if afterTrack != noTrackObjectPath {
+		if idx = m.queueIndexOf(afterTrack); idx < 0 {
+			return errTrackNotInQueue
+		}
+		idx++
+	}
+	if err := m.pm.InsertTracks([]*mediaprovider.Track{tr}, idx); err != nil {
+		return err
+	}
+	if setAsCurrent {
+		return m.pm.PlayTrackAt(idx)
+	}
+	return nil
+}
+
+func (m *MPRISHandler) RemoveTrack(trackID dbus.ObjectPath) error {
+	idx := m.queueIndexOf(trackID)
+	if idx < 0 {
+		return errTrackNotInQueue
+	}
+	m.pm.RemoveTrackAt(idx)
+	return nil
+}
+
+func (m *MPRISHandler) GoTo(trackID dbus.ObjectPath) error {
+	idx := m.queueIndexOf(trackID)
+	if idx < 0 {
+		return errTrackNotInQueue
+	}
+	return m.pm.PlayTrackAt(idx)
+}
+
+// Emits the TrackList signals for the change from the previously
+// reported track list: TrackAdded if a single track was inserted,
+// TrackRemoved if tracks were removed, or else TrackListReplaced.
+func (m *MPRISHandler) emitTrackListChanges() {
+	old := m.trackListPaths
+	queue := m.pm.queueEntries()
+	paths := m.queueObjectPaths(queue, true)
+	m.trackListPaths = paths
+	if m.connErr != nil || m.s.Conn == nil || sharedutil.SliceEqual(old, paths) {
+		return
+	}
+	var err error
+	if idx := insertedIndex(old, paths); idx >= 0 {
+		after := dbus.ObjectPath(noTrackObjectPath)
+		if idx > 0 {
+			after = paths[idx-1]
+		}
+		meta := m.trackMetadata(queue[idx], float64(queue[idx].Duration))
+		meta.TrackId = paths[idx]
+		err = m.s.Conn.Emit(mprisObjectPath, mprisTrackListIface+".TrackAdded", meta.MakeMap(), after)
+	} else if removed, ok := removedPaths(old, paths); ok && len(paths) > 0 {
+		for _, path := range removed {
+			if err = m.s.Conn.Emit(mprisObjectPath, mprisTrackListIface+".TrackRemoved", path); err != nil {
+				break
+			}
+		}
+	} else {
+		current := dbus.ObjectPath(noTrackObjectPath)
+		if m.curTrackPath != "" {
+			current = dbus.ObjectPath(m.curTrackPath)
+		}
+		err = m.s.Conn.Emit(mprisObjectPath, mprisTrackListIface+".TrackListReplaced", paths, current)
+	}
+	if err == nil {
+		err = m.emitPropertiesChanged(mprisTrackListIface, map[string]dbus.Variant{}, []string{"Tracks"})
+	}
+	if err != nil {
+		log.Printf("error emitting MPRIS track list change: %s", err.Error())
+	}
+}
+
+// Returns the track IDs of the queue entries. If prune is set,
+// the IDs of entries no longer in the queue are forgotten.
+func (m *MPRISHandler) queueObjectPaths(queue []*mediaprovider.Track, prune bool) []dbus.ObjectPath {
+	m.entryIDs.mutex.Lock()
+	defer m.entryIDs.mutex.Unlock()
+	paths := make([]dbus.ObjectPath, len(queue))
+	for i, tr := range queue {
+		paths[i] = m.entryObjectPathLocked(tr)
+	}
+	if prune {
+		inQueue := make(map[*mediaprovider.Track]bool, len(queue))
+		for _, tr := range queue {
+			inQueue[tr] = true
+		}
+		for tr := range m.entryIDs.ids {
+			if !inQueue[tr] {
+				delete(m.entryIDs.ids, tr)
+			}
+		}
+	}
+	return paths
+}
+
+// Returns the track ID of the play queue entry.
+func (m *MPRISHandler) entryObjectPath(tr *mediaprovider.Track) dbus.ObjectPath {
+	m.entryIDs.mutex.Lock()
+	defer m.entryIDs.mutex.Unlock()
+	return m.entryObjectPathLocked(tr)
+}
+
+func (m *MPRISHandler) entryObjectPathLocked(tr *mediaprovider.Track) dbus.ObjectPath {
+	if tr == nil {
+		return noTrackObjectPath
+	}
+	id, ok := m.entryIDs.ids[tr]
+	if !ok {
+		if m.entryIDs.ids == nil {
+			m.entryIDs.ids = make(map[*mediaprovider.Track]uint64)
+		}
+		m.entryIDs.nextID++
+		id = m.entryIDs.nextID
+		m.entryIDs.ids[tr] = id
+	}
+	return dbus.ObjectPath(dbusTrackIDPrefix + strconv.FormatUint(id, 10))
+}
+
+// Returns the index in the play queue of the entry with the track ID, or -1.
+func (m *MPRISHandler) queueIndexOf(path dbus.ObjectPath) int {
+	return indexOfPath(m.queueObjectPaths(m.pm.queueEntries(), false), path)
+}
+
+func indexOfPath(paths []dbus.ObjectPath, path dbus.ObjectPath) int {
+	for i, p := range paths {
+		if p == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the index of the single path inserted into old to give new, or -1.
+func insertedIndex(old, new []dbus.ObjectPath) int {
+	if len(new) != len(old)+1 {
+		return -1
+	}
+	i := 0
+	for i < len(old) && old[i] == new[i] {
+		i++
+	}
+	for j := i; j < len(old); j++ {
+		if old[j] != new[j+1] {
+			return -1
+		}
+	}
+	return i
+}
+
+// Returns the paths removed from old to give new, if new is old with some paths removed.
+func removedPaths(old, new []dbus.ObjectPath) ([]dbus.ObjectPath, bool) {
+	if len(new) >= len(old) {
+		return nil, false
+	}
+	var removed []dbus.ObjectPath
+	j := 0
+	for _, path := range old {
+		if j < len(new) && new[j] == path {
+			j++
+		} else {
+			removed = append(removed, path)
+		}
+	}
+	return removed, j == len(new)
+}
@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/godbus/dbus/v5"
+)
+
+func Test_TrackListChanges(t *testing.T) {
+	paths := func(ids ...string) []dbus.ObjectPath {
+		p := make([]dbus.ObjectPath, len(ids))
+		for i, id := range ids {
+			p[i] = dbus.ObjectPath(dbusTrackIDPrefix + id)
+		}
+		return p
+	}
+	old := paths("a", "b", "c")
+
+	for _, tt := range []struct {
+		new          []dbus.ObjectPath
+		wantInserted int
+		wantRemoved  []dbus.ObjectPath
+		wantOK       bool
+	}{
+		{new: paths("x", "a", "b", "c"), wantInserted: 0},
+		{new: paths("a", "b", "x", "c"), wantInserted: 2},
+		{new: paths("a", "b", "c", "x"), wantInserted: 3},
+		{new: paths("a", "x", "y", "b", "c"), wantInserted: -1},
+		{new: paths("a", "c"), wantInserted: -1, wantRemoved: paths("b"), wantOK: true},
+		{new: paths("b"), wantInserted: -1, wantRemoved: paths("a", "c"), wantOK: true},
+		{new: paths("c", "a"), wantInserted: -1},
+	} {
+		if got := insertedIndex(old, tt.new); got != tt.wantInserted {
+			t.Errorf("insertedIndex(%v) = %d, want %d", tt.new, got, tt.wantInserted)
+		}
+		removed, ok := removedPaths(old, tt.new)
+		if ok != tt.wantOK || (ok && fmt.Sprint(removed) != fmt.Sprint(tt.wantRemoved)) {
+			t.Errorf("removedPaths(%v) = %v, %v, want %v, %v", tt.new, removed, ok, tt.wantRemoved, tt.wantOK)
+		}
+	}
+}
+
+func Test_TrackListDuplicateTracks(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	m := NewMPRISHandler("test", pt.player, pt.pm)
+	m.TrackLookup = func(trackID string) (*mediaprovider.Track, error) {
+		return &mediaprovider.Track{ID: trackID, Duration: 100}, nil
+	}
+	tracks := makeTracks(100, 100)
+	pt.loadTracks(append(tracks, tracks[0]), false, false)
+
+	paths, _ := m.Tracks()
+	if len(paths) != 3 || paths[0] == paths[2] {
+		t.Fatalf("duplicate tracks have the same track ID: %v", paths)
+	}
+	if err := m.RemoveTrack(paths[2]); err != nil {
+		t.Fatalf("RemoveTrack failed: %v", err)
+	}
+	pt.checkQueue(t, []string{"a", "b"})
+	if newPaths, _ := m.Tracks(); fmt.Sprint(newPaths) != fmt.Sprint(paths[:2]) {
+		t.Errorf("got track IDs %v after removal, want %v", newPaths, paths[:2])
+	}
+
+	if err := m.AddTrack("a", paths[0], false); err == nil {
+		t.Error("AddTrack accepted a bare track ID")
+	}
+	if err := m.AddTrack("supersonic://play/track/c", paths[0], false); err != nil {
+		t.Fatalf("AddTrack failed: %v", err)
+	}
+	pt.checkQueue(t, []string{"a", "c", "b"})
+}
@@ -2,7 +2,10 @@ package backend
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/dweymouth/supersonic/backend/mediaprovider"
@@ -12,9 +15,10 @@ import (
 )
 
 const (
-	ReplayGainNone  = string(player.ReplayGainNone)
-	ReplayGainAlbum = string(player.ReplayGainAlbum)
-	ReplayGainTrack = string(player.ReplayGainTrack)
+	ReplayGainNone    = string(player.ReplayGainNone)
+	ReplayGainAlbum   = string(player.ReplayGainAlbum)
+	ReplayGainTrack   = string(player.ReplayGainTrack)
+	ReplayGainDynamic = string(player.ReplayGainDynamic)
 )
 
 type LoopMode int
@@ -25,6 +29,19 @@ const (
 	LoopModeOne  LoopMode = LoopMode(player.LoopOne)
 )
 
+// A play of a track which has ended, either because the track finished playing,
+// or the user moved to a different track or stopped playback.
+// Passed to OnPlayEnded callbacks.
+type TrackPlay struct {
+	Track     *mediaprovider.Track
+	StartTime time.Time
+	// Time spent actually playing the track, excluding time paused.
+	PlayTime time.Duration
+	// Whether the track was played for too short of a time
+	// to count as a listen, according to the scrobble thresholds.
+	Skipped bool
+}
+
 // A high-level Subsonic-aware playback backend.
 // Manages loading tracks into the Player queue,
 // sending callbacks on play time updates and track changes.
@@ -33,30 +50,53 @@ type PlaybackManager struct {
 	cancelPollPos context.CancelFunc
 	pollingTick   *time.Ticker
 	sm            *ServerManager
-	player        *player.Player
+	player        player.BasePlayer
 
 	playTimeStopwatch util.Stopwatch
 	curTrackTime      float64
+	curTrackStartTime time.Time
 	callbacksDisabled bool
 
 	playQueue     []*mediaprovider.Track
 	nowPlayingIdx int64
+	// ID of the playlist loaded as the play queue, if any
+	playlistID string
 
 	// to pass to onSongChange listeners; clear once listeners have been called
 	lastScrobbled *mediaprovider.Track
 	scrobbleCfg   *ScrobbleConfig
-
-	onSongChange     []func(nowPlaying, justScrobbledIfAny *mediaprovider.Track)
-	onPlayTimeUpdate []func(float64, float64)
-	onLoopModeChange []func(LoopMode)
-	onVolumeChange   []func(int)
+	playbackCfg   *LocalPlaybackConfig
+
+	// guards sleepTimer, which is updated from the UI, player callbacks and its ticker
+	sleepTimerMutex sync.Mutex
+	sleepTimer      sleepTimer
+	sleepTimerSeq   int
+	replayGain      replayGainState
+	scrobblers      []Scrobbler
+	scrobbleQueue   *ScrobbleQueue
+
+	undo *UndoManager
+	// position to seek to once the next track is loaded, if > 0
+	pendingSeek float64
+
+	onSongChange       []func(nowPlaying, justScrobbledIfAny *mediaprovider.Track)
+	onPlayTimeUpdate   []func(float64, float64)
+	onLoopModeChange   []func(LoopMode)
+	onVolumeChange     []func(int)
+	onSleepTimerUpdate []func(SleepTimerStatus)
+	onPlayEnded        []func(TrackPlay)
+	onSpeedChange      []func(float64)
+	onABLoopChange     []func(a, b float64)
+	onQueueChange      []func()
 }
 
 func NewPlaybackManager(
 	ctx context.Context,
 	s *ServerManager,
-	p *player.Player,
+	p player.BasePlayer,
 	scrobbleCfg *ScrobbleConfig,
+	playbackCfg *LocalPlaybackConfig,
+	undo *UndoManager,
 ) *PlaybackManager {
 	// clamp to 99% to avoid any possible rounding issues
 	scrobbleCfg.ThresholdPercent = clamp(scrobbleCfg.ThresholdPercent, 0, 99)
@@ -65,7 +105,10 @@ func NewPlaybackManager(
 		sm:          s,
 		player:      p,
 		scrobbleCfg: scrobbleCfg,
+		playbackCfg: playbackCfg,
+		undo:        undo,
 	}
+	p.SetCrossfadeFilter(pm.shouldCrossfade)
 	p.OnTrackChange(func(tracknum int64) {
 		if tracknum >= int64(len(pm.playQueue)) {
 			return
@@ -76,9 +119,18 @@ func NewPlaybackManager(
 		}
 		pm.nowPlayingIdx = tracknum
 		pm.curTrackTime = float64(pm.playQueue[pm.nowPlayingIdx].Duration)
+		pm.curTrackStartTime = time.Now()
+		pm.applySpeedForTrack(pm.playQueue[pm.nowPlayingIdx])
+		pm.applyReplayGain(pm.playQueue[pm.nowPlayingIdx])
+		pm.clearABLoopIfSet()
+		if pm.pendingSeek > 0 {
+			pm.player.Seek(strconv.FormatFloat(pm.pendingSeek, 'f', 3, 64), player.SeekAbsolute)
+			pm.pendingSeek = 0
+		}
 		pm.invokeOnSongChangeCallbacks()
 		pm.doUpdateTimePos()
 		pm.sendNowPlayingScrobble()
+		pm.sleepTimerOnTrackChange()
 	})
 	p.OnSeek(func() {
 		pm.doUpdateTimePos()
@@ -89,6 +141,8 @@ func NewPlaybackManager(
 		pm.stopPollTimePos()
 		pm.doUpdateTimePos()
 		pm.invokeOnSongChangeCallbacks()
+		pm.sleepTimerOnStopped()
+		pm.clearABLoopIfSet()
 	})
 	p.OnPaused(func() {
 		pm.playTimeStopwatch.Stop()
@@ -100,7 +154,10 @@ func NewPlaybackManager(
 	})
 
 	s.OnLogout(func() {
-		pm.StopAndClearPlayQueue()
+		pm.stopAndClearPlayQueue()
+		pm.clearReplayGainLookups()
+		// the tracks of any recorded actions belong to the old server
+		pm.undo.Clear()
 	})
 
 	return pm
@@ -148,6 +205,30 @@ func (p *PlaybackManager) OnVolumeChange(cb func(int)) {
 	p.onVolumeChange = append(p.onVolumeChange, cb)
 }
 
+// Registers a callback that is notified whenever the play of a track ends,
+// whether it was listened to or skipped. Callbacks are invoked even after
+// DisableCallbacks, so the final play can be recorded when the app quits.
+func (p *PlaybackManager) OnPlayEnded(cb func(TrackPlay)) {
+	p.onPlayEnded = append(p.onPlayEnded, cb)
+}
+
+// Registers a callback that is notified whenever the A-B loop points change.
+// Unset points are negative.
+func (p *PlaybackManager) OnABLoopChange(cb func(a, b float64)) {
+	p.onABLoopChange = append(p.onABLoopChange, cb)
+}
+
+// Registers a callback that is notified whenever the playback speed changes.
+func (p *PlaybackManager) OnSpeedChange(cb func(float64)) {
+	p.onSpeedChange = append(p.onSpeedChange, cb)
+}
+
+// Registers a callback that is notified whenever tracks are
+// added to or removed from the play queue, or it is replaced.
+func (p *PlaybackManager) OnQueueChange(cb func()) {
+	p.onQueueChange = append(p.onQueueChange, cb)
+}
+
 // Loads the specified album into the play queue.
 func (p *PlaybackManager) LoadAlbum(albumID string, appendToQueue bool, shuffle bool) error {
 	album, err := p.sm.Server.GetAlbum(albumID)
@@ -163,10 +244,34 @@ func (p *PlaybackManager) LoadPlaylist(playlistID string, appendToQueue bool, sh
 	if err != nil {
 		return err
 	}
-	return p.LoadTracks(playlist.Tracks, appendToQueue, shuffle)
+	return p.loadQueueTracks(playlist.Tracks, appendToQueue, shuffle, playlistID)
 }
 
 func (p *PlaybackManager) LoadTracks(tracks []*mediaprovider.Track, appendToQueue, shuffle bool) error {
+	return p.loadQueueTracks(tracks, appendToQueue, shuffle, "")
+}
+
+// Returns the ID of the playlist which was loaded as the play queue,
+// or an empty string if the queue was not loaded from a playlist.
+func (p *PlaybackManager) PlaylistID() string {
+	return p.playlistID
+}
+
+// Loads the tracks into the play queue, recording an undo action if the queue is
+// replaced, and the ID of the playlist the queue is loaded from ("" if none).
+func (p *PlaybackManager) loadQueueTracks(tracks []*mediaprovider.Track, appendToQueue, shuffle bool, playlistID string) error {
+	if !appendToQueue && len(p.playQueue) > 0 {
+		p.recordQueueUndo("Replaced play queue")
+	}
+	if appendToQueue {
+		playlistID = ""
+	}
+	p.playlistID = playlistID
+	return p.loadTracks(tracks, appendToQueue, shuffle)
+}
+
+func (p *PlaybackManager) loadTracks(tracks []*mediaprovider.Track, appendToQueue, shuffle bool) error {
+	defer p.invokeOnQueueChange()
 	if !appendToQueue {
 		p.player.Stop()
 		p.nowPlayingIdx = 0
@@ -188,6 +293,41 @@ func (p *PlaybackManager) LoadTracks(tracks []*mediaprovider.Track, appendToQueu
 		tr := *tracks[i]
 		p.playQueue = append(p.playQueue, &tr)
 	}
+	if !appendToQueue {
+		p.prefetchReplayGain(0)
+	}
+	return nil
+}
+
+// Inserts the tracks into the play queue before the track at index idx,
+// or at the end if idx is the length of the queue.
+func (p *PlaybackManager) InsertTracks(tracks []*mediaprovider.Track, idx int) error {
+	if idx < 0 || idx > len(p.playQueue) {
+		return fmt.Errorf("play queue index %d out of range", idx)
+	}
+	defer p.invokeOnQueueChange()
+	for i, track := range tracks {
+		url, err := p.sm.Server.GetStreamURL(track.ID)
+		if err != nil {
+			return err
+		}
+		if err := p.player.AppendFile(url); err != nil {
+			return err
+		}
+		last := len(p.playQueue)
+		if idx+i < last {
+			if err := p.player.MoveTrack(last, idx+i); err != nil {
+				p.player.RemoveTrackAt(last)
+				return err
+			}
+		}
+		tr := *track
+		p.playQueue = append(p.playQueue[:idx+i], append([]*mediaprovider.Track{&tr}, p.playQueue[idx+i:]...)...)
+		if len(p.playQueue) > 1 && int64(idx+i) <= p.nowPlayingIdx {
+			p.nowPlayingIdx++
+		}
+	}
+	p.prefetchReplayGain(int(p.nowPlayingIdx) + 1)
 	return nil
 }
 
@@ -262,13 +402,35 @@ func (p *PlaybackManager) OnTrackRatingChanged(id string, rating int) {
 	}
 }
 
+// Returns the play queue's own track models, which distinguish
+// duplicate tracks in the queue. They must not be modified.
+func (p *PlaybackManager) queueEntries() []*mediaprovider.Track {
+	return append([]*mediaprovider.Track(nil), p.playQueue...)
+}
+
+// Removes every occurrence of the tracks from the play queue.
 func (p *PlaybackManager) RemoveTracksFromQueue(trackIDs []string) {
-	newQueue := make([]*mediaprovider.Track, 0, len(p.playQueue)-len(trackIDs))
-	rmCount := 0
 	idSet := sharedutil.ToSet(trackIDs)
+	p.removeTracksFromQueue(func(_ int, tr *mediaprovider.Track) bool {
+		_, ok := idSet[tr.ID]
+		return ok
+	})
+}
+
+// Removes the track at the given index of the play queue.
+func (p *PlaybackManager) RemoveTrackAt(idx int) {
+	p.removeTracksFromQueue(func(i int, _ *mediaprovider.Track) bool {
+		return i == idx
+	})
+}
+
+func (p *PlaybackManager) removeTracksFromQueue(remove func(idx int, tr *mediaprovider.Track) bool) {
+	snapshot := p.snapshotQueue()
+	newQueue := make([]*mediaprovider.Track, 0, len(p.playQueue))
+	rmCount := 0
 	isPlayingTrackRemoved := false
 	for i, tr := range p.playQueue {
-		if _, ok := idSet[tr.ID]; ok {
+		if remove(i, tr) {
 			// removing this track
 			if i == p.NowPlayingIndex() {
 				isPlayingTrackRemoved = true
@@ -289,6 +451,12 @@ func (p *PlaybackManager) RemoveTracksFromQueue(trackIDs []string) {
 	}
 	p.playQueue = newQueue
 	p.nowPlayingIdx = p.player.GetStatus().PlaylistPos
+	if rmCount > 0 {
+		p.invokeOnQueueChange()
+		p.undo.Record(fmt.Sprintf("Removed %s from queue", TracksCountDescription(rmCount)), func() error {
+			return p.restoreQueue(snapshot)
+		})
+	}
 	// fire on song change callbacks in case the playing track was removed
 	if isPlayingTrackRemoved {
 		p.invokeOnSongChangeCallbacks()
@@ -297,18 +465,19 @@ func (p *PlaybackManager) RemoveTracksFromQueue(trackIDs []string) {
 
 // Stop playback and clear the play queue.
 func (p *PlaybackManager) StopAndClearPlayQueue() {
+	if len(p.playQueue) > 0 {
+		p.recordQueueUndo("Cleared play queue")
+	}
+	p.stopAndClearPlayQueue()
+}
+
+func (p *PlaybackManager) stopAndClearPlayQueue() {
 	p.player.Stop()
 	p.player.ClearPlayQueue()
 	p.doUpdateTimePos()
 	p.playQueue = nil
-}
-
-func (p *PlaybackManager) SetReplayGainOptions(config ReplayGainConfig) {
-	p.player.SetReplayGainOptions(player.ReplayGainOptions{
-		Mode:            player.ReplayGainMode(config.Mode),
-		PreventClipping: config.PreventClipping,
-		PreampGain:      config.PreampGainDB,
-	})
+	p.playlistID = ""
+	p.invokeOnQueueChange()
 }
 
 // Changes the loop mode of the player to the next one.
@@ -341,6 +510,65 @@ func (p *PlaybackManager) LoopMode() LoopMode {
 	return LoopMode(p.player.GetLoopMode())
 }
 
+// Sets the start (A) point of the A-B loop to the current playback position.
+// If the end point is before the new start point, it is cleared.
+// Playback doesn't loop until the end point is set.
+func (p *PlaybackManager) SetABLoopStart() error {
+	if p.player.GetStatus().State == player.Stopped {
+		return nil
+	}
+	a := p.player.GetStatus().TimePos
+	_, b := p.player.GetABLoop()
+	if b >= 0 && b <= a {
+		b = -1
+	}
+	return p.setABLoop(a, b)
+}
+
+// Sets the end (B) point of the A-B loop to the current playback position.
+// If no start point is set, the loop starts at the beginning of the track.
+func (p *PlaybackManager) SetABLoopEnd() error {
+	if p.player.GetStatus().State == player.Stopped {
+		return nil
+	}
+	b := p.player.GetStatus().TimePos
+	a, _ := p.player.GetABLoop()
+	if a < 0 {
+		a = 0
+	}
+	if b <= a {
+		a, b = b, a
+	}
+	return p.setABLoop(a, b)
+}
+
+func (p *PlaybackManager) ClearABLoop() error {
+	return p.setABLoop(-1, -1)
+}
+
+// Returns the A-B loop points, in seconds. Unset points are negative.
+func (p *PlaybackManager) ABLoop() (a, b float64) {
+	return p.player.GetABLoop()
+}
+
+// A-B loop points only apply to the track they were set on,
+// so they are cleared when the track changes or playback stops.
+func (p *PlaybackManager) clearABLoopIfSet() {
+	if a, b := p.player.GetABLoop(); a >= 0 || b >= 0 {
+		p.ClearABLoop()
+	}
+}
+
+func (p *PlaybackManager) setABLoop(a, b float64) error {
+	if err := p.player.SetABLoop(a, b); err != nil {
+		return err
+	}
+	for _, cb := range p.onABLoopChange {
+		cb(a, b)
+	}
+	return nil
+}
+
 func (p *PlaybackManager) SetVolume(vol int) error {
 	vol = clamp(vol, 0, 100)
 	if err := p.player.SetVolume(vol); err != nil {
@@ -356,9 +584,121 @@ func (p *PlaybackManager) Volume() int {
 	return p.player.GetVolume()
 }
 
+// Sets the playback speed, and remembers it as the speed for
+// tracks of the same type (music, podcast, audiobook) as the current one.
+func (p *PlaybackManager) SetSpeed(speed float64) error {
+	if err := p.player.SetSpeed(speed); err != nil {
+		return err
+	}
+	trackType := mediaprovider.TrackTypeMusic
+	if np := p.NowPlaying(); np != nil && np.Type != "" {
+		trackType = np.Type
+	}
+	if p.playbackCfg.PlaybackSpeeds == nil {
+		p.playbackCfg.PlaybackSpeeds = make(map[string]float64)
+	}
+	p.playbackCfg.PlaybackSpeeds[string(trackType)] = p.player.GetSpeed()
+	p.invokeOnSpeedChange()
+	return nil
+}
+
+func (p *PlaybackManager) Speed() float64 {
+	return p.player.GetSpeed()
+}
+
+// Switches to the remembered playback speed for the type of the given track.
+func (p *PlaybackManager) applySpeedForTrack(tr *mediaprovider.Track) {
+	trackType := tr.Type
+	if trackType == "" {
+		trackType = mediaprovider.TrackTypeMusic
+	}
+	speed, ok := p.playbackCfg.PlaybackSpeeds[string(trackType)]
+	if !ok {
+		speed = 1
+	}
+	if speed == p.player.GetSpeed() {
+		return
+	}
+	if err := p.player.SetSpeed(speed); err != nil {
+		log.Printf("error setting playback speed: %s", err.Error())
+		return
+	}
+	p.invokeOnSpeedChange()
+}
+
+func (p *PlaybackManager) invokeOnSpeedChange() {
+	speed := p.player.GetSpeed()
+	for _, cb := range p.onSpeedChange {
+		cb(speed)
+	}
+}
+
+// The state of the play queue and playback position, to be restored on undo.
+type queueSnapshot struct {
+	tracks        []*mediaprovider.Track
+	nowPlayingIdx int
+	timePos       float64
+	state         player.State
+	playlistID    string
+}
+
+func (p *PlaybackManager) snapshotQueue() queueSnapshot {
+	status := p.player.GetStatus()
+	return queueSnapshot{
+		tracks:        p.GetPlayQueue(),
+		nowPlayingIdx: p.NowPlayingIndex(),
+		timePos:       status.TimePos,
+		state:         status.State,
+		playlistID:    p.playlistID,
+	}
+}
+
+func (p *PlaybackManager) recordQueueUndo(description string) {
+	snapshot := p.snapshotQueue()
+	p.undo.Record(description, func() error {
+		return p.restoreQueue(snapshot)
+	})
+}
+
+// Replaces the play queue with the snapshot, resuming playback
+// at the same position if it was playing or paused.
+func (p *PlaybackManager) restoreQueue(s queueSnapshot) error {
+	p.playlistID = s.playlistID
+	if err := p.loadTracks(s.tracks, false, false); err != nil {
+		return err
+	}
+	if s.state == player.Stopped || s.nowPlayingIdx < 0 || s.nowPlayingIdx >= len(p.playQueue) {
+		return nil
+	}
+	p.pendingSeek = s.timePos
+	if err := p.player.PlayTrackAt(s.nowPlayingIdx); err != nil {
+		p.pendingSeek = 0
+		return err
+	}
+	if s.state == player.Paused {
+		return p.player.Pause()
+	}
+	return nil
+}
+
+// Crossfade filter for the player. Consecutive tracks from the same album
+// are played gaplessly instead of being crossfaded.
+func (p *PlaybackManager) shouldCrossfade(fromIdx, toIdx int64) bool {
+	if fromIdx >= int64(len(p.playQueue)) || toIdx >= int64(len(p.playQueue)) || toIdx != fromIdx+1 {
+		return true
+	}
+	from, to := p.playQueue[fromIdx], p.playQueue[toIdx]
+	if from.AlbumID == "" || from.AlbumID != to.AlbumID {
+		return true
+	}
+	sameDiscNext := to.DiscNumber == from.DiscNumber && to.TrackNumber == from.TrackNumber+1
+	nextDiscFirst := to.DiscNumber == from.DiscNumber+1 && to.TrackNumber == 1
+	return !sameDiscNext && !nextDiscFirst
+}
+
 // call BEFORE updating p.nowPlayingIdx
 func (p *PlaybackManager) checkScrobble() {
-	if !p.scrobbleCfg.Enabled || len(p.playQueue) == 0 || p.nowPlayingIdx < 0 {
+	if len(p.playQueue) == 0 || p.nowPlayingIdx < 0 {
 		return
 	}
 	playDur := p.playTimeStopwatch.Elapsed()
@@ -368,22 +708,39 @@ func (p *PlaybackManager) checkScrobble() {
 	pcnt := playDur.Seconds() / p.curTrackTime * 100
 	timeThresholdMet := p.scrobbleCfg.ThresholdTimeSeconds >= 0 &&
 		playDur.Seconds() >= float64(p.scrobbleCfg.ThresholdTimeSeconds)
-	if timeThresholdMet || pcnt >= float64(p.scrobbleCfg.ThresholdPercent) {
-		song := p.playQueue[p.nowPlayingIdx]
+	song := p.playQueue[p.nowPlayingIdx]
+	listened := timeThresholdMet || pcnt >= float64(p.scrobbleCfg.ThresholdPercent)
+	if listened && p.scrobbleCfg.Enabled {
 		log.Printf("Scrobbling %q", song.Name)
 		song.PlayCount += 1
 		p.lastScrobbled = song
-		go p.sm.Server.Scrobble(song.ID, true)
+		p.submitServerScrobble(song.ID, p.curTrackStartTime)
+	}
+	if listened {
+		p.scrobbleToScrobblers(song, p.curTrackStartTime)
 	}
 	p.playTimeStopwatch.Reset()
+
+	play := TrackPlay{
+		Track:     song,
+		StartTime: p.curTrackStartTime,
+		PlayTime:  playDur,
+		Skipped:   !listened,
+	}
+	for _, cb := range p.onPlayEnded {
+		cb(play)
+	}
 }
 
 func (p *PlaybackManager) sendNowPlayingScrobble() {
-	if !p.scrobbleCfg.Enabled || len(p.playQueue) == 0 || p.nowPlayingIdx < 0 {
+	if len(p.playQueue) == 0 || p.nowPlayingIdx < 0 {
 		return
 	}
 	song := p.playQueue[p.nowPlayingIdx]
-	go p.sm.Server.Scrobble(song.ID, false)
+	if p.scrobbleCfg.Enabled {
+		go p.sm.Server.Scrobble(song.ID, false, time.Now())
+	}
+	p.sendNowPlayingToScrobblers(song)
 }
 
 func (p *PlaybackManager) invokeOnSongChangeCallbacks() {
@@ -396,20 +753,30 @@ func (p *PlaybackManager) invokeOnSongChangeCallbacks() {
 	p.lastScrobbled = nil
 }
 
+func (p *PlaybackManager) invokeOnQueueChange() {
+	if p.callbacksDisabled {
+		return
+	}
+	for _, cb := range p.onQueueChange {
+		cb()
+	}
+}
+
 func (p *PlaybackManager) startPollTimePos() {
 	ctx, cancel := context.WithCancel(p.ctx)
 	p.cancelPollPos = cancel
-	p.pollingTick = time.NewTicker(250 * time.Millisecond)
+	// the goroutine must use its own ticker, since polling may have
+	// been restarted with a new ticker by the time ctx is done
+	ticker := time.NewTicker(250 * time.Millisecond)
+	p.pollingTick = ticker
 
-	// TODO: fix occasional nil pointer dereference on app quit
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
-				p.pollingTick.Stop()
-				p.pollingTick = nil
+				ticker.Stop()
 				return
-			case <-p.pollingTick.C:
+			case <-ticker.C:
 				p.doUpdateTimePos()
 			}
 		}
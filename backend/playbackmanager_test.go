@@ -0,0 +1,495 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/player"
+)
+
+// A MediaProvider which records scrobbles. Other methods are not implemented.
+type fakeMediaProvider struct {
+	mediaprovider.MediaProvider
+
+	mutex sync.Mutex
+	// IDs of tracks submitted as scrobbles (not "now playing" notifications)
+	scrobbled []string
+	// if set, scrobbles of tracks for which it returns true fail
+	failScrobble func(trackID string) bool
+}
+
+func (f *fakeMediaProvider) GetStreamURL(trackID string) (string, error) {
+	return streamURL(trackID), nil
+}
+
+func (f *fakeMediaProvider) GetPlaylist(playlistID string) (*mediaprovider.PlaylistWithTracks, error) {
+	return &mediaprovider.PlaylistWithTracks{
+		Playlist: mediaprovider.Playlist{ID: playlistID},
+		Tracks:   makeTracks(200, 200),
+	}, nil
+}
+
+func (f *fakeMediaProvider) Scrobble(trackID string, submission bool, _ time.Time) error {
+	if submission {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if f.failScrobble != nil && f.failScrobble(trackID) {
+			return errors.New("scrobble failed")
+		}
+		f.scrobbled = append(f.scrobbled, trackID)
+	}
+	return nil
+}
+
+// Returns the scrobbled track IDs, once the expected number have been sent.
+// (PlaybackManager scrobbles asynchronously.)
+func (f *fakeMediaProvider) waitForScrobbles(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		f.mutex.Lock()
+		s := append([]string(nil), f.scrobbled...)
+		f.mutex.Unlock()
+		if len(s) >= n || time.Now().After(deadline) {
+			return s
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func streamURL(trackID string) string {
+	return "stream://" + trackID
+}
+
+type playbackManagerTest struct {
+	pm     *PlaybackManager
+	player *player.FakePlayer
+	server *fakeMediaProvider
+	now    time.Time
+	ended  []TrackPlay
+}
+
+func newPlaybackManagerTest(t *testing.T, scrobbleCfg ScrobbleConfig) *playbackManagerTest {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pt := &playbackManagerTest{
+		player: player.NewFakePlayer(),
+		server: &fakeMediaProvider{},
+		now:    time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+	sm := &ServerManager{Server: pt.server}
+	pt.pm = NewPlaybackManager(ctx, sm, pt.player, &scrobbleCfg, &LocalPlaybackConfig{}, NewUndoManager())
+	pt.pm.playTimeStopwatch.Clock = func() time.Time { return pt.now }
+	pt.pm.OnPlayEnded(func(play TrackPlay) {
+		pt.ended = append(pt.ended, play)
+	})
+	return pt
+}
+
+// Loads the tracks into the PlaybackManager, with the player
+// using the track durations from the track models.
+func (pt *playbackManagerTest) loadTracks(tracks []*mediaprovider.Track, appendToQueue, shuffle bool) {
+	for _, tr := range tracks {
+		pt.player.SetTrackDuration(streamURL(tr.ID), float64(tr.Duration))
+	}
+	pt.pm.LoadTracks(tracks, appendToQueue, shuffle)
+}
+
+// Advances both the clock used to measure play time and the player.
+func (pt *playbackManagerTest) advance(secs float64) {
+	pt.now = pt.now.Add(time.Duration(secs * float64(time.Second)))
+	pt.player.AdvanceTime(secs)
+}
+
+func (pt *playbackManagerTest) queueIDs() []string {
+	var ids []string
+	for _, tr := range pt.pm.GetPlayQueue() {
+		ids = append(ids, tr.ID)
+	}
+	return ids
+}
+
+// Checks that the play queue has the given track IDs, and that
+// the player's playlist matches it.
+func (pt *playbackManagerTest) checkQueue(t *testing.T, want []string) {
+	t.Helper()
+	if got := pt.queueIDs(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("play queue = %v, want %v", got, want)
+	}
+	var wantURLs []string
+	for _, id := range want {
+		wantURLs = append(wantURLs, streamURL(id))
+	}
+	if got := pt.player.Playlist(); fmt.Sprint(got) != fmt.Sprint(wantURLs) {
+		t.Errorf("player playlist = %v, want %v", got, wantURLs)
+	}
+}
+
+func makeTracks(durations ...int) []*mediaprovider.Track {
+	tracks := make([]*mediaprovider.Track, len(durations))
+	for i, d := range durations {
+		tracks[i] = &mediaprovider.Track{ID: string(rune('a' + i)), Name: fmt.Sprintf("Track %d", i+1), Duration: d}
+	}
+	return tracks
+}
+
+func Test_CheckScrobble(t *testing.T) {
+	defaultCfg := ScrobbleConfig{Enabled: true, ThresholdTimeSeconds: 240, ThresholdPercent: 50}
+	tests := []struct {
+		name     string
+		cfg      ScrobbleConfig
+		duration int
+		// plays the first track for playSecs, then pauses for pausedSecs
+		// and plays for playSecs2, before skipping to the next track
+		playSecs, pausedSecs, playSecs2 float64
+		wantScrobble                    bool
+		wantSkipped                     bool
+	}{
+		{name: "percent threshold met", cfg: defaultCfg, duration: 200, playSecs: 120,
+			wantScrobble: true},
+		{name: "below thresholds", cfg: defaultCfg, duration: 200, playSecs: 30,
+			wantSkipped: true},
+		{name: "time threshold met", cfg: defaultCfg, duration: 1000, playSecs: 250,
+			wantScrobble: true},
+		{name: "time threshold disabled", cfg: ScrobbleConfig{Enabled: true, ThresholdTimeSeconds: -1, ThresholdPercent: 50},
+			duration: 1000, playSecs: 250, wantSkipped: true},
+		{name: "paused time not counted", cfg: defaultCfg, duration: 200, playSecs: 60, pausedSecs: 300, playSecs2: 20,
+			wantSkipped: true},
+		{name: "play time summed across pause", cfg: defaultCfg, duration: 200, playSecs: 60, pausedSecs: 300, playSecs2: 60,
+			wantScrobble: true},
+		{name: "scrobbling disabled", cfg: ScrobbleConfig{Enabled: false, ThresholdTimeSeconds: 240, ThresholdPercent: 50},
+			duration: 200, playSecs: 120},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPlaybackManagerTest(t, tt.cfg)
+			tracks := makeTracks(tt.duration, 200)
+			pt.loadTracks(tracks, false, false)
+			pt.pm.PlayFromBeginning()
+			pt.advance(tt.playSecs)
+			if tt.pausedSecs > 0 {
+				pt.player.Pause()
+				pt.advance(tt.pausedSecs)
+				pt.player.Continue()
+				pt.advance(tt.playSecs2)
+			}
+			pt.player.SeekNext()
+			pt.player.ProcessEvents()
+
+			wantScrobbles := 0
+			if tt.wantScrobble {
+				wantScrobbles = 1
+			}
+			scrobbled := pt.server.waitForScrobbles(t, wantScrobbles)
+			if len(scrobbled) != wantScrobbles {
+				t.Fatalf("scrobbled %v, want %d scrobbles", scrobbled, wantScrobbles)
+			}
+			if tt.wantScrobble {
+				if scrobbled[0] != "a" {
+					t.Errorf("scrobbled track %q, want \"a\"", scrobbled[0])
+				}
+				if pc := pt.pm.GetPlayQueue()[0].PlayCount; pc != 1 {
+					t.Errorf("play count = %d, want 1", pc)
+				}
+			}
+
+			if len(pt.ended) != 1 {
+				t.Fatalf("got %d ended plays, want 1", len(pt.ended))
+			}
+			play := pt.ended[0]
+			if play.Track.ID != "a" {
+				t.Errorf("ended play of track %q, want \"a\"", play.Track.ID)
+			}
+			if play.Skipped != tt.wantSkipped {
+				t.Errorf("skipped = %v, want %v", play.Skipped, tt.wantSkipped)
+			}
+			wantPlayTime := time.Duration((tt.playSecs + tt.playSecs2) * float64(time.Second))
+			if play.PlayTime != wantPlayTime {
+				t.Errorf("play time = %v, want %v", play.PlayTime, wantPlayTime)
+			}
+		})
+	}
+}
+
+func Test_CheckScrobble_TrackPlayedToEnd(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{Enabled: true, ThresholdTimeSeconds: 240, ThresholdPercent: 50})
+	pt.loadTracks(makeTracks(100, 100), false, false)
+	pt.pm.PlayFromBeginning()
+	// plays through both tracks to the end of the queue
+	pt.advance(100)
+	pt.advance(100)
+
+	scrobbled := pt.server.waitForScrobbles(t, 2)
+	// scrobbles are sent concurrently, so may arrive in any order
+	sort.Strings(scrobbled)
+	if fmt.Sprint(scrobbled) != "[a b]" {
+		t.Errorf("scrobbled %v, want [a b]", scrobbled)
+	}
+	if len(pt.ended) != 2 || pt.ended[0].Skipped || pt.ended[1].Skipped {
+		t.Errorf("ended plays = %+v, want 2 unskipped plays", pt.ended)
+	}
+	if st := pt.player.GetStatus().State; st != player.Stopped {
+		t.Errorf("player state = %v, want Stopped", st)
+	}
+}
+
+func Test_RemoveTracksFromQueue(t *testing.T) {
+	cfg := ScrobbleConfig{Enabled: true, ThresholdTimeSeconds: 240, ThresholdPercent: 50}
+
+	t.Run("other tracks", func(t *testing.T) {
+		pt := newPlaybackManagerTest(t, cfg)
+		pt.loadTracks(makeTracks(200, 200, 200, 200, 200), false, false)
+		pt.pm.PlayTrackAt(2)
+		pt.advance(10)
+
+		pt.pm.RemoveTracksFromQueue([]string{"b", "d"})
+		pt.player.ProcessEvents()
+
+		pt.checkQueue(t, []string{"a", "c", "e"})
+		if idx := pt.pm.NowPlayingIndex(); idx != 1 {
+			t.Errorf("now playing index = %d, want 1", idx)
+		}
+		if np := pt.pm.NowPlaying(); np == nil || np.ID != "c" {
+			t.Errorf("now playing = %v, want track c", np)
+		}
+		if len(pt.ended) != 0 {
+			t.Errorf("got %d ended plays, want 0", len(pt.ended))
+		}
+		if !pt.pm.undo.CanUndo() {
+			t.Error("removal was not recorded for undo")
+		}
+	})
+
+	t.Run("now playing track", func(t *testing.T) {
+		pt := newPlaybackManagerTest(t, cfg)
+		pt.loadTracks(makeTracks(200, 200, 200, 200, 200), false, false)
+		pt.pm.PlayTrackAt(2)
+		pt.advance(10)
+
+		pt.pm.RemoveTracksFromQueue([]string{"c"})
+		pt.player.ProcessEvents()
+
+		pt.checkQueue(t, []string{"a", "b", "d", "e"})
+		if np := pt.pm.NowPlaying(); np == nil || np.ID != "d" {
+			t.Errorf("now playing = %v, want track d", np)
+		}
+		if len(pt.ended) != 1 || pt.ended[0].Track.ID != "c" || !pt.ended[0].Skipped {
+			t.Errorf("ended plays = %+v, want a skipped play of track c", pt.ended)
+		}
+	})
+
+	t.Run("undo", func(t *testing.T) {
+		pt := newPlaybackManagerTest(t, cfg)
+		pt.loadTracks(makeTracks(200, 200, 200), false, false)
+		pt.pm.PlayTrackAt(1)
+		pt.advance(10)
+
+		pt.pm.RemoveTracksFromQueue([]string{"a", "c"})
+		pt.player.ProcessEvents()
+		pt.checkQueue(t, []string{"b"})
+
+		if err := pt.pm.undo.Undo(); err != nil {
+			t.Fatalf("undo failed: %v", err)
+		}
+		pt.player.ProcessEvents()
+		pt.checkQueue(t, []string{"a", "b", "c"})
+		if np := pt.pm.NowPlaying(); np == nil || np.ID != "b" {
+			t.Errorf("now playing = %v, want track b", np)
+		}
+		if pos := pt.player.GetStatus().TimePos; pos != 10 {
+			t.Errorf("time pos = %v, want 10", pos)
+		}
+	})
+}
+
+func Test_InsertTracks(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	tracks := makeTracks(200, 200, 200, 200, 200)
+	pt.loadTracks(tracks[:3], false, false)
+	pt.pm.PlayTrackAt(1)
+	pt.advance(10)
+	queueChanges := 0
+	pt.pm.OnQueueChange(func() { queueChanges++ })
+
+	if err := pt.pm.InsertTracks(tracks[3:], 1); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	pt.player.ProcessEvents()
+	pt.checkQueue(t, []string{"a", "d", "e", "b", "c"})
+	if np := pt.pm.NowPlaying(); np == nil || np.ID != "b" || pt.pm.NowPlayingIndex() != 3 {
+		t.Errorf("now playing = %v at %d, want track b at 3", np, pt.pm.NowPlayingIndex())
+	}
+	if queueChanges != 1 {
+		t.Errorf("got %d queue change callbacks, want 1", queueChanges)
+	}
+
+	if err := pt.pm.InsertTracks(tracks[:1], 5); err != nil {
+		t.Fatalf("insert at end failed: %v", err)
+	}
+	pt.checkQueue(t, []string{"a", "d", "e", "b", "c", "a"})
+}
+
+func Test_PlaylistID(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	pt.pm.PlayPlaylist("p1", 0, false)
+	if id := pt.pm.PlaylistID(); id != "p1" {
+		t.Errorf("playlist ID = %q, want p1", id)
+	}
+	pt.loadTracks(makeTracks(200), true, false)
+	if id := pt.pm.PlaylistID(); id != "" {
+		t.Errorf("playlist ID after appending = %q, want none", id)
+	}
+
+	pt.pm.PlayPlaylist("p2", 0, false)
+	pt.pm.StopAndClearPlayQueue()
+	if id := pt.pm.PlaylistID(); id != "" {
+		t.Errorf("playlist ID after clearing = %q, want none", id)
+	}
+	if err := pt.pm.undo.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if id := pt.pm.PlaylistID(); id != "p2" {
+		t.Errorf("playlist ID after undo = %q, want p2", id)
+	}
+}
+
+func Test_LoadTracksShuffle(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	durations := make([]int, 26)
+	for i := range durations {
+		durations[i] = 200
+	}
+	tracks := makeTracks(durations...)
+
+	pt.loadTracks(tracks, false, true)
+	shuffled := pt.queueIDs()
+	// the player's playlist must be in the same order as the play queue
+	pt.checkQueue(t, shuffled)
+
+	seen := make(map[string]bool)
+	for _, id := range shuffled {
+		seen[id] = true
+	}
+	inOrder := true
+	for i, tr := range tracks {
+		if !seen[tr.ID] {
+			t.Errorf("track %q missing from shuffled queue", tr.ID)
+		}
+		if shuffled[i] != tr.ID {
+			inOrder = false
+		}
+	}
+	if len(shuffled) != len(tracks) {
+		t.Errorf("shuffled queue has %d tracks, want %d", len(shuffled), len(tracks))
+	}
+	if inOrder {
+		t.Error("queue was not shuffled")
+	}
+
+	// tracks are copied, so the play queue doesn't modify the caller's tracks
+	pt.pm.GetPlayQueue()[0].PlayCount = 10
+	for _, tr := range tracks {
+		if tr.PlayCount != 0 {
+			t.Error("play queue shares track models with caller")
+		}
+	}
+
+	// appending with shuffle shuffles only the appended tracks
+	pt.loadTracks(makeTracks(200, 200, 200), true, true)
+	appended := pt.queueIDs()
+	if fmt.Sprint(appended[:len(shuffled)]) != fmt.Sprint(shuffled) {
+		t.Error("appending shuffled tracks changed the existing queue")
+	}
+	pt.checkQueue(t, appended)
+}
+
+func Test_StopAfterTracks(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	pt.loadTracks(makeTracks(100, 100, 100), false, false)
+	pt.pm.PlayFromBeginning()
+	pt.player.ProcessEvents()
+	pt.pm.StopAfterTracks(2, false)
+	defer pt.pm.CancelSleepTimer()
+
+	pt.advance(100)
+	if st := pt.player.GetStatus().State; st != player.Playing {
+		t.Errorf("player state after first track = %v, want Playing", st)
+	}
+	// pauses at the end of the second track, with the third track loaded
+	pt.advance(100)
+	if st := pt.player.GetStatus().State; st != player.Paused {
+		t.Errorf("player state after second track = %v, want Paused", st)
+	}
+	if np := pt.pm.NowPlaying(); np == nil || np.ID != "c" || pt.player.GetStatus().TimePos != 0 {
+		t.Errorf("now playing = %v at %v, want track c at 0", np, pt.player.GetStatus().TimePos)
+	}
+	if mode := pt.pm.SleepTimerStatus().Mode; mode != SleepTimerOff {
+		t.Errorf("sleep timer mode = %v, want off", mode)
+	}
+}
+
+func Test_CancelSleepTimer_RestoresVolume(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	pt.pm.StartSleepTimer(time.Hour, true)
+	// as if partway through fading out
+	pt.pm.sleepTimer.fading = true
+	pt.pm.sleepTimer.origVolume = 80
+	pt.player.SetVolume(20)
+	var notified []int
+	pt.pm.OnVolumeChange(func(vol int) { notified = append(notified, vol) })
+
+	pt.pm.CancelSleepTimer()
+	if vol := pt.player.GetVolume(); vol != 80 {
+		t.Errorf("volume = %d, want 80", vol)
+	}
+	if fmt.Sprint(notified) != "[80]" {
+		t.Errorf("volume change callbacks got %v, want [80]", notified)
+	}
+}
+
+func Test_SleepTimerFade_StopsOnVolumeChange(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	pt.loadTracks(makeTracks(100), false, false)
+	pt.pm.PlayFromBeginning()
+	pt.player.ProcessEvents()
+	pt.player.SetVolume(100)
+	pt.pm.StartSleepTimer(sleepTimerFadeDuration/2, true)
+	defer pt.pm.CancelSleepTimer()
+	id := pt.pm.sleepTimer.id
+
+	pt.pm.doSleepTimerTick(id)
+	if vol := pt.player.GetVolume(); vol > 50 || vol < 45 {
+		t.Fatalf("volume = %d after fade tick, want about 50", vol)
+	}
+	// the user turns the volume up during the fade
+	pt.player.SetVolume(70)
+	pt.pm.doSleepTimerTick(id)
+	if vol := pt.player.GetVolume(); vol != 70 {
+		t.Errorf("volume = %d after user change, want 70", vol)
+	}
+	pt.pm.CancelSleepTimer()
+	if vol := pt.player.GetVolume(); vol != 70 {
+		t.Errorf("volume = %d after cancel, want 70", vol)
+	}
+}
+
+func Test_SleepTimerTick_IgnoresReplacedTimer(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	pt.pm.StartSleepTimer(0, false)
+	oldID := pt.pm.sleepTimer.id
+	pt.pm.StartSleepTimer(time.Hour, false)
+	defer pt.pm.CancelSleepTimer()
+
+	// a tick of the expired timer, racing with the new one being started
+	pt.pm.doSleepTimerTick(oldID)
+	if mode := pt.pm.SleepTimerStatus().Mode; mode != SleepTimerDuration {
+		t.Errorf("sleep timer mode = %v, want the new timer running", mode)
+	}
+}
@@ -0,0 +1,513 @@
+package backend
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/player"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	remoteControlDefaultPort = 7760
+	// max number of results of each type returned by search
+	remoteControlSearchLimit = 20
+	// events are dropped for clients which fall this far behind
+	remoteControlEventBuffer = 32
+	// keyring user name under which the API token is stored
+	remoteControlKeyringUser = "remotecontrol"
+	// file in the config dir in which the API token is
+	// stored instead, if the keyring is unavailable
+	remoteControlTokenFileName = "remotecontrol_token"
+)
+
+type remoteControlError struct {
+	status int
+	msg    string
+}
+
+func (e remoteControlError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return remoteControlError{status: http.StatusBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+var errRemoteNoServer = remoteControlError{status: http.StatusServiceUnavailable, msg: "not connected to a server"}
+var errRemoteSearchUnsupported = remoteControlError{status: http.StatusNotImplemented, msg: "the server does not support searching"}
+
+// Serves a JSON API on localhost to control playback from
+// scripts and other applications. All requests must have the
+// API token, which is stored in the keyring, as "Authorization: Bearer <token>" or,
+// for clients which can't set headers, a "token" query parameter.
+//
+//	GET  /api/state                current track, play state, position and volume
+//	GET  /api/queue                play queue and the index of the current track
+//	GET  /api/search?q=            artists, albums and tracks matching the query
+//	GET  /api/events               server-sent events stream of "song" and "time" events
+//	POST /api/play, /api/pause, /api/playpause, /api/stop, /api/next, /api/previous
+//	POST /api/seek?position=       seek to position, or by offset=, in seconds
+//	POST /api/volume?volume=       set volume (0-100), or change it by offset=
+//	POST /api/load?album=          load an album, playlist= or track= by ID,
+//	                               with optional append=true and shuffle=true
+type RemoteControlServer struct {
+	appName   string
+	tokenFile string
+	config    *RemoteControlConfig
+	pm        *PlaybackManager
+	p         player.BasePlayer
+	sm        *ServerManager
+
+	mutex       sync.Mutex
+	server      *http.Server
+	token       string
+	tokenLoaded bool
+	// channels of the connected event streams
+	subscribers map[chan remoteControlEvent]struct{}
+}
+
+type remoteControlEvent struct {
+	name string
+	data []byte
+}
+
+type remoteTrack struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Artists     []string `json:"artists"`
+	ArtistIDs   []string `json:"artistIds"`
+	Album       string   `json:"album"`
+	AlbumID     string   `json:"albumId"`
+	Duration    int      `json:"duration"`
+	TrackNumber int      `json:"trackNumber,omitempty"`
+	DiscNumber  int      `json:"discNumber,omitempty"`
+	Year        int      `json:"year,omitempty"`
+	Favorite    bool     `json:"favorite"`
+	Rating      int      `json:"rating"`
+}
+
+type remoteAlbum struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Artists  []string `json:"artists"`
+	Year     int      `json:"year,omitempty"`
+	Favorite bool     `json:"favorite"`
+}
+
+type remoteArtist struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Favorite bool   `json:"favorite"`
+}
+
+type remoteState struct {
+	State      string       `json:"state"`
+	Track      *remoteTrack `json:"track"`
+	QueueIndex int          `json:"queueIndex"`
+	Position   float64      `json:"position"`
+	Duration   float64      `json:"duration"`
+	Volume     int          `json:"volume"`
+}
+
+type remoteQueue struct {
+	Index  int            `json:"index"`
+	Tracks []*remoteTrack `json:"tracks"`
+}
+
+type remoteSearchResults struct {
+	Artists []*remoteArtist `json:"artists"`
+	Albums  []*remoteAlbum  `json:"albums"`
+	Tracks  []*remoteTrack  `json:"tracks"`
+}
+
+type remoteTimeUpdate struct {
+	Position float64 `json:"position"`
+	Duration float64 `json:"duration"`
+}
+
+func NewRemoteControlServer(appName, tokenFile string, config *RemoteControlConfig, pm *PlaybackManager, p player.BasePlayer, sm *ServerManager) *RemoteControlServer {
+	if config.Port == 0 {
+		config.Port = remoteControlDefaultPort
+	}
+	r := &RemoteControlServer{
+		appName:     appName,
+		tokenFile:   tokenFile,
+		config:      config,
+		pm:          pm,
+		p:           p,
+		sm:          sm,
+		subscribers: make(map[chan remoteControlEvent]struct{}),
+	}
+	pm.OnSongChange(func(track, _ *mediaprovider.Track) {
+		r.publish("song", toRemoteTrack(track))
+	})
+	pm.OnPlayTimeUpdate(func(pos, dur float64) {
+		r.publish("time", remoteTimeUpdate{Position: pos, Duration: dur})
+	})
+	return r
+}
+
+// Returns the API token, loading it from the keyring on first use.
+// If there is none, a new one is generated and saved to the keyring or,
+// if it is unavailable, to the token file, so clients keep working
+// across restarts.
+func (r *RemoteControlServer) Token() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.tokenLoaded {
+		return r.token
+	}
+	r.tokenLoaded = true
+	t, err := keyring.Get(r.appName, remoteControlKeyringUser)
+	if err == nil {
+		r.token = t
+		return t
+	} else if err != keyring.ErrNotFound {
+		log.Printf("error reading keyring credentials: %s", err.Error())
+	}
+	if b, err := os.ReadFile(r.tokenFile); err == nil && len(b) > 0 {
+		r.token = strings.TrimSpace(string(b))
+		return r.token
+	}
+	r.token = newRemoteControlToken()
+	if err := keyring.Set(r.appName, remoteControlKeyringUser, r.token); err != nil {
+		log.Printf("error setting keyring credentials: %s", err.Error())
+		if err := os.WriteFile(r.tokenFile, []byte(r.token), 0600); err != nil {
+			// the token is still valid until the app is restarted
+			log.Printf("error saving remote control token: %s", err.Error())
+		}
+	}
+	return r.token
+}
+
+func newRemoteControlToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("error generating remote control token: %s", err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Starts serving the API on localhost at the configured port,
+// restarting the server if it is already running.
+func (r *RemoteControlServer) Start() error {
+	r.Stop()
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(r.config.Port)))
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: r.handler()}
+	r.mutex.Lock()
+	r.server = srv
+	r.mutex.Unlock()
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("error serving remote control API: %s", err.Error())
+		}
+	}()
+	return nil
+}
+
+// Stops the server, if it is running.
+func (r *RemoteControlServer) Stop() {
+	r.mutex.Lock()
+	srv := r.server
+	r.server = nil
+	r.mutex.Unlock()
+	if srv != nil {
+		srv.Close()
+	}
+}
+
+func (r *RemoteControlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/state", r.endpoint(http.MethodGet, r.state))
+	mux.HandleFunc("/api/queue", r.endpoint(http.MethodGet, r.queue))
+	mux.HandleFunc("/api/search", r.endpoint(http.MethodGet, r.search))
+	mux.HandleFunc("/api/events", r.authorize(r.serveEvents))
+	mux.HandleFunc("/api/play", r.control(func(*http.Request) error {
+		if r.p.GetStatus().State == player.Stopped {
+			return r.p.PlayFromBeginning()
+		}
+		return r.p.Continue()
+	}))
+	mux.HandleFunc("/api/pause", r.control(func(*http.Request) error { return r.p.Pause() }))
+	mux.HandleFunc("/api/playpause", r.control(func(*http.Request) error { return r.p.PlayPause() }))
+	mux.HandleFunc("/api/stop", r.control(func(*http.Request) error { return r.p.Stop() }))
+	mux.HandleFunc("/api/next", r.control(func(*http.Request) error { return r.p.SeekNext() }))
+	mux.HandleFunc("/api/previous", r.control(func(*http.Request) error { return r.p.SeekBackOrPrevious() }))
+	mux.HandleFunc("/api/seek", r.control(r.seek))
+	mux.HandleFunc("/api/volume", r.control(r.volume))
+	mux.HandleFunc("/api/load", r.control(r.load))
+	return mux
+}
+
+func (r *RemoteControlServer) authorize(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token := req.URL.Query().Get("token")
+		if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if want := r.Token(); want == "" || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			writeRemoteError(w, remoteControlError{status: http.StatusUnauthorized, msg: "invalid token"})
+			return
+		}
+		h(w, req)
+	}
+}
+
+// Wraps a function returning a JSON response as an authorized handler for the given method.
+func (r *RemoteControlServer) endpoint(method string, f func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return r.authorize(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			writeRemoteError(w, remoteControlError{status: http.StatusMethodNotAllowed, msg: "method not allowed"})
+			return
+		}
+		resp, err := f(req)
+		if err != nil {
+			writeRemoteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// Wraps a playback control as a POST endpoint which responds with the new playback state.
+func (r *RemoteControlServer) control(f func(*http.Request) error) http.HandlerFunc {
+	return r.endpoint(http.MethodPost, func(req *http.Request) (interface{}, error) {
+		if err := f(req); err != nil {
+			return nil, err
+		}
+		return r.state(req)
+	})
+}
+
+func writeRemoteError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var rcErr remoteControlError
+	if errors.As(err, &rcErr) {
+		status = rcErr.status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func (r *RemoteControlServer) state(*http.Request) (interface{}, error) {
+	return currentRemoteState(r.pm, r.p), nil
+}
+
+func currentRemoteState(pm *PlaybackManager, p player.BasePlayer) remoteState {
+	status := p.GetStatus()
+	state := "stopped"
+	switch status.State {
+	case player.Playing:
+		state = "playing"
+	case player.Paused:
+		state = "paused"
+	}
+	return remoteState{
+		State:      state,
+		Track:      toRemoteTrack(pm.NowPlaying()),
+		QueueIndex: pm.NowPlayingIndex(),
+		Position:   status.TimePos,
+		Duration:   status.Duration,
+		Volume:     pm.Volume(),
+	}
+}
+
+func (r *RemoteControlServer) queue(*http.Request) (interface{}, error) {
+	queue := r.pm.GetPlayQueue()
+	tracks := make([]*remoteTrack, len(queue))
+	for i, tr := range queue {
+		tracks[i] = toRemoteTrack(tr)
+	}
+	return remoteQueue{Index: r.pm.NowPlayingIndex(), Tracks: tracks}, nil
+}
+
+func (r *RemoteControlServer) search(req *http.Request) (interface{}, error) {
+	query := strings.TrimSpace(req.FormValue("q"))
+	if query == "" {
+		return nil, badRequest("missing search query")
+	}
+	server := r.sm.Server
+	if server == nil {
+		return nil, errRemoteNoServer
+	}
+	results := remoteSearchResults{
+		Artists: []*remoteArtist{},
+		Albums:  []*remoteAlbum{},
+		Tracks:  []*remoteTrack{},
+	}
+	sp, ok := server.(mediaprovider.SearchProvider)
+	if !ok {
+		return nil, errRemoteSearchUnsupported
+	}
+	found, err := sp.Search(query, remoteControlSearchLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, ar := range found.Artists {
+		results.Artists = append(results.Artists, &remoteArtist{ID: ar.ID, Name: ar.Name, Favorite: ar.Favorite})
+	}
+	for _, al := range found.Albums {
+		results.Albums = append(results.Albums, &remoteAlbum{
+			ID: al.ID, Name: al.Name, Artists: al.ArtistNames, Year: al.Year, Favorite: al.Favorite,
+		})
+	}
+	for _, tr := range found.Tracks {
+		results.Tracks = append(results.Tracks, toRemoteTrack(tr))
+	}
+	return results, nil
+}
+
+func (r *RemoteControlServer) seek(req *http.Request) error {
+	if pos := req.FormValue("position"); pos != "" {
+		secs, err := strconv.ParseFloat(pos, 64)
+		if err != nil || secs < 0 {
+			return badRequest("invalid position: %s", pos)
+		}
+		return r.p.Seek(fmt.Sprintf("%0.2f", secs), player.SeekAbsolute)
+	}
+	offset, err := strconv.ParseFloat(req.FormValue("offset"), 64)
+	if err != nil {
+		return badRequest("position or offset required")
+	}
+	return r.p.Seek(fmt.Sprintf("%0.2f", offset), player.SeekRelative)
+}
+
+func (r *RemoteControlServer) volume(req *http.Request) error {
+	if vol := req.FormValue("volume"); vol != "" {
+		v, err := strconv.Atoi(vol)
+		if err != nil {
+			return badRequest("invalid volume: %s", vol)
+		}
+		return r.pm.SetVolume(v)
+	}
+	offset, err := strconv.Atoi(req.FormValue("offset"))
+	if err != nil {
+		return badRequest("volume or offset required")
+	}
+	return r.pm.SetVolume(r.pm.Volume() + offset)
+}
+
+func (r *RemoteControlServer) load(req *http.Request) error {
+	appendToQueue := req.FormValue("append") == "true"
+	shuffle := req.FormValue("shuffle") == "true"
+	if r.sm.Server == nil {
+		return errRemoteNoServer
+	}
+	if id := req.FormValue("album"); id != "" {
+		if appendToQueue {
+			return r.pm.LoadAlbum(id, true, shuffle)
+		}
+		return r.pm.PlayAlbum(id, 0, shuffle)
+	}
+	if id := req.FormValue("playlist"); id != "" {
+		if appendToQueue {
+			return r.pm.LoadPlaylist(id, true, shuffle)
+		}
+		return r.pm.PlayPlaylist(id, 0, shuffle)
+	}
+	if id := req.FormValue("track"); id != "" {
+		tr, err := r.sm.Server.GetTrack(id)
+		if err != nil {
+			return err
+		}
+		if err := r.pm.LoadTracks([]*mediaprovider.Track{tr}, appendToQueue, false); err != nil || appendToQueue {
+			return err
+		}
+		return r.pm.PlayFromBeginning()
+	}
+	return badRequest("album, playlist or track ID required")
+}
+
+func (r *RemoteControlServer) serveEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeRemoteError(w, errors.New("streaming not supported"))
+		return
+	}
+	ch := make(chan remoteControlEvent, remoteControlEventBuffer)
+	r.mutex.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		delete(r.subscribers, ch)
+		r.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// start with the current track, so clients needn't fetch the state first
+	if b, err := json.Marshal(toRemoteTrack(r.pm.NowPlaying())); err == nil {
+		fmt.Fprintf(w, "event: song\ndata: %s\n\n", b)
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case e := <-ch:
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, e.data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Sends an event to all connected event streams.
+func (r *RemoteControlServer) publish(name string, data interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.subscribers) == 0 {
+		return
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("error encoding remote control event: %s", err.Error())
+		return
+	}
+	for ch := range r.subscribers {
+		select {
+		case ch <- remoteControlEvent{name: name, data: b}:
+		default: // client is not keeping up
+		}
+	}
+}
+
+func toRemoteTrack(tr *mediaprovider.Track) *remoteTrack {
+	if tr == nil {
+		return nil
+	}
+	return &remoteTrack{
+		ID:          tr.ID,
+		Title:       tr.Name,
+		Artists:     tr.ArtistNames,
+		ArtistIDs:   tr.ArtistIDs,
+		Album:       tr.Album,
+		AlbumID:     tr.AlbumID,
+		Duration:    tr.Duration,
+		TrackNumber: tr.TrackNumber,
+		DiscNumber:  tr.DiscNumber,
+		Year:        tr.Year,
+		Favorite:    tr.Favorite,
+		Rating:      tr.Rating,
+	}
+}
@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func newRemoteControlTest(t *testing.T) (*playbackManagerTest, *RemoteControlServer, *httptest.Server) {
+	keyring.MockInit()
+	keyring.Set("supersonic", remoteControlKeyringUser, "secret")
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	r := NewRemoteControlServer("supersonic", filepath.Join(t.TempDir(), remoteControlTokenFileName), &RemoteControlConfig{},
+		pt.pm, pt.player, &ServerManager{Server: pt.server})
+	srv := httptest.NewServer(r.handler())
+	t.Cleanup(srv.Close)
+	return pt, r, srv
+}
+
+func remoteRequest(t *testing.T, srv *httptest.Server, method, path string, resp interface{}) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer res.Body.Close()
+	if resp != nil && res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+			t.Fatalf("decoding response of %s: %v", path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func Test_RemoteControlAuth(t *testing.T) {
+	_, _, srv := newRemoteControlTest(t)
+	for _, url := range []string{"/api/state", "/api/state?token=wrong"} {
+		res, err := http.Get(srv.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET %s: status %d, want 401", url, res.StatusCode)
+		}
+	}
+	res, err := http.Get(srv.URL + "/api/state?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET with token query: status %d, want 200", res.StatusCode)
+	}
+	if status := remoteRequest(t, srv, http.MethodGet, "/api/next", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/next: status %d, want 405", status)
+	}
+}
+
+func Test_RemoteControlPlayback(t *testing.T) {
+	pt, _, srv := newRemoteControlTest(t)
+	pt.loadTracks(makeTracks(100, 200, 300), false, false)
+
+	var state remoteState
+	remoteRequest(t, srv, http.MethodPost, "/api/play", &state)
+	if state.State != "playing" || state.Track == nil || state.Track.ID != "a" {
+		t.Errorf("after play: state %s, track %+v", state.State, state.Track)
+	}
+	remoteRequest(t, srv, http.MethodPost, "/api/next", nil)
+	pt.player.ProcessEvents()
+	remoteRequest(t, srv, http.MethodGet, "/api/state", &state)
+	if state.QueueIndex != 1 || state.Track.ID != "b" {
+		t.Errorf("after next: index %d, track %+v", state.QueueIndex, state.Track)
+	}
+	remoteRequest(t, srv, http.MethodPost, "/api/seek?position=50", &state)
+	if state.Position != 50 {
+		t.Errorf("after seek: position %v, want 50", state.Position)
+	}
+	remoteRequest(t, srv, http.MethodPost, "/api/volume?volume=40", &state)
+	remoteRequest(t, srv, http.MethodPost, "/api/volume?offset=-5", &state)
+	if state.Volume != 35 {
+		t.Errorf("volume = %d, want 35", state.Volume)
+	}
+	if status := remoteRequest(t, srv, http.MethodPost, "/api/volume?volume=loud", nil); status != http.StatusBadRequest {
+		t.Errorf("invalid volume: status %d, want 400", status)
+	}
+	remoteRequest(t, srv, http.MethodPost, "/api/pause", &state)
+	if state.State != "paused" {
+		t.Errorf("after pause: state %s", state.State)
+	}
+
+	var queue remoteQueue
+	remoteRequest(t, srv, http.MethodGet, "/api/queue", &queue)
+	if queue.Index != 1 || len(queue.Tracks) != 3 || queue.Tracks[2].Title != "Track 3" {
+		t.Errorf("queue = %d, %+v", queue.Index, queue.Tracks)
+	}
+
+	remoteRequest(t, srv, http.MethodPost, "/api/load?playlist=pl&shuffle=false", nil)
+	pt.player.ProcessEvents()
+	remoteRequest(t, srv, http.MethodGet, "/api/state", &state)
+	if state.State != "playing" || state.QueueIndex != 0 || len(pt.pm.GetPlayQueue()) != 2 {
+		t.Errorf("after load playlist: state %s, index %d, queue length %d",
+			state.State, state.QueueIndex, len(pt.pm.GetPlayQueue()))
+	}
+}
+
+func Test_RemoteControlEvents(t *testing.T) {
+	_, r, srv := newRemoteControlTest(t)
+
+	res, err := http.Get(srv.URL + "/api/events?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	scanner := bufio.NewScanner(res.Body)
+	nextEvent := func() (string, string) {
+		var name, data string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				return name, data
+			}
+			if strings.HasPrefix(line, "event: ") {
+				name = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		t.Fatalf("event stream ended: %v", scanner.Err())
+		return "", ""
+	}
+
+	// the initial event is the current track, of which there is none
+	if name, data := nextEvent(); name != "song" || data != "null" {
+		t.Errorf("initial event = %s %s", name, data)
+	}
+	// (playing a track would race with the PlaybackManager's time polling)
+	r.publish("time", remoteTimeUpdate{Position: 1.5, Duration: 100})
+	r.publish("song", toRemoteTrack(makeTracks(100)[0]))
+	if name, data := nextEvent(); name != "time" || data != `{"position":1.5,"duration":100}` {
+		t.Errorf("time event = %s %s", name, data)
+	}
+	name, data := nextEvent()
+	var track remoteTrack
+	if err := json.Unmarshal([]byte(data), &track); name != "song" || err != nil || track.ID != "a" {
+		t.Errorf("song event = %s %s", name, data)
+	}
+}
+
+func Test_RemoteControlTokenFile(t *testing.T) {
+	keyring.MockInit()
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	// saved instead of the keyring, as if it was unavailable on a previous run
+	tokenFile := filepath.Join(t.TempDir(), remoteControlTokenFileName)
+	if err := os.WriteFile(tokenFile, []byte("fromfile\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRemoteControlServer("supersonic", tokenFile, &RemoteControlConfig{},
+		pt.pm, pt.player, &ServerManager{Server: pt.server})
+	if got := r.Token(); got != "fromfile" {
+		t.Errorf("token = %q, want the one from the token file", got)
+	}
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"log"
+	"math"
+	"sync"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/player"
+)
+
+// Server-side ReplayGain metadata is applied through the player's fallback gain,
+// which mpv only uses for streams without ReplayGain tags (e.g. transcoded streams),
+// so it never doubles up with the gain mpv computes from tags.
+
+// Server-side lookups completing after this far into the track are applied
+// from the next time it plays, so the volume doesn't jump mid-track.
+const replayGainMaxLateSecs = 1.0
+
+// Bounds the number of tracks whose looked up ReplayGain metadata is remembered.
+const maxLookedUpReplayGains = 1000
+
+type replayGainState struct {
+	mutex  sync.Mutex
+	config ReplayGainConfig
+	// ReplayGain metadata looked up from the server for tracks loaded without it,
+	// by track ID, so it applies to every queue entry of the track; nil if the
+	// server has none. Kept here rather than set on the play queue's tracks,
+	// which are read elsewhere without locking.
+	lookedUp map[string]*mediaprovider.ReplayGain
+	// ID of the track whose gain was last applied
+	nowPlayingID string
+}
+
+func (p *PlaybackManager) SetReplayGainOptions(config ReplayGainConfig) {
+	p.replayGain.mutex.Lock()
+	p.replayGain.config = config
+	p.replayGain.mutex.Unlock()
+
+	p.player.SetReplayGainOptions(player.ReplayGainOptions{
+		Mode:            player.ReplayGainMode(config.Mode),
+		PreventClipping: config.PreventClipping,
+		PreampGain:      config.PreampGainDB,
+		FallbackGain:    config.FallbackGainDB,
+		TargetLevel:     config.TargetLevelDB,
+	})
+	if np := p.NowPlaying(); np != nil {
+		p.applyReplayGain(np)
+	}
+}
+
+// Sets the player's gain for untagged streams for the given (now playing) track,
+// and prefetches server-side ReplayGain metadata for the next track.
+func (p *PlaybackManager) applyReplayGain(tr *mediaprovider.Track) {
+	p.replayGain.mutex.Lock()
+	p.replayGain.nowPlayingID = tr.ID
+	rg, known := p.knownReplayGain(tr)
+	p.replayGain.mutex.Unlock()
+	if !p.replayGainLookupsEnabled() {
+		return
+	}
+
+	// until a lookup completes, this applies the configured fallback gain
+	p.setReplayGainFallback(rg)
+	if !known {
+		id := tr.ID
+		go func() {
+			rg := p.lookupReplayGain(id)
+			if rg == nil {
+				return
+			}
+			// normally the lookup was prefetched before the track started,
+			// but if not, only apply it while the track is just starting
+			p.replayGain.mutex.Lock()
+			current := p.replayGain.nowPlayingID == id
+			p.replayGain.mutex.Unlock()
+			if current && p.player.GetStatus().TimePos < replayGainMaxLateSecs {
+				p.setReplayGainFallback(rg)
+			}
+		}()
+	}
+	p.prefetchReplayGain(int(p.nowPlayingIdx) + 1)
+}
+
+// Looks up server-side ReplayGain metadata in the background
+// for the track at the given index of the play queue, if needed.
+func (p *PlaybackManager) prefetchReplayGain(idx int) {
+	if idx < 0 || idx >= len(p.playQueue) || !p.replayGainLookupsEnabled() {
+		return
+	}
+	tr := p.playQueue[idx]
+	p.replayGain.mutex.Lock()
+	_, known := p.knownReplayGain(tr)
+	p.replayGain.mutex.Unlock()
+	if !known {
+		go p.lookupReplayGain(tr.ID)
+	}
+}
+
+func (p *PlaybackManager) replayGainLookupsEnabled() bool {
+	p.replayGain.mutex.Lock()
+	defer p.replayGain.mutex.Unlock()
+	mode := p.replayGain.config.Mode
+	return mode != ReplayGainNone && mode != ReplayGainDynamic
+}
+
+// Forgets the ReplayGain metadata looked up from the server.
+func (p *PlaybackManager) clearReplayGainLookups() {
+	p.replayGain.mutex.Lock()
+	p.replayGain.lookedUp = nil
+	p.replayGain.mutex.Unlock()
+}
+
+// Returns the ReplayGain metadata for the track, from the track itself
+// or a previous lookup, and whether it is known. Must be called with
+// the ReplayGain mutex held.
+func (p *PlaybackManager) knownReplayGain(tr *mediaprovider.Track) (*mediaprovider.ReplayGain, bool) {
+	if tr.ReplayGain != nil {
+		return tr.ReplayGain, true
+	}
+	rg, ok := p.replayGain.lookedUp[tr.ID]
+	return rg, ok
+}
+
+func (p *PlaybackManager) setReplayGainFallback(rg *mediaprovider.ReplayGain) {
+	p.replayGain.mutex.Lock()
+	gain := replayGainForTrack(rg, p.replayGain.config)
+	p.replayGain.mutex.Unlock()
+	if err := p.player.SetReplayGainFallback(gain); err != nil {
+		log.Printf("error setting ReplayGain: %s", err.Error())
+	}
+}
+
+// Looks up the server-side ReplayGain metadata for the track ID and remembers
+// it. Failed lookups aren't remembered, so they are retried the next time the
+// track is needed. Returns nil if the lookup failed or found no metadata.
+func (p *PlaybackManager) lookupReplayGain(trackID string) *mediaprovider.ReplayGain {
+	rgp, ok := p.sm.Server.(mediaprovider.ReplayGainProvider)
+	if !ok {
+		return nil
+	}
+	rg, err := rgp.GetReplayGain(trackID)
+	if err != nil {
+		log.Printf("error looking up ReplayGain: %s", err.Error())
+		return nil
+	}
+	p.replayGain.mutex.Lock()
+	defer p.replayGain.mutex.Unlock()
+	if p.replayGain.lookedUp == nil || len(p.replayGain.lookedUp) >= maxLookedUpReplayGains {
+		p.replayGain.lookedUp = make(map[string]*mediaprovider.ReplayGain)
+	}
+	p.replayGain.lookedUp[trackID] = rg
+	return rg
+}
+
+// Returns the gain in dB to apply for the given ReplayGain metadata, or the
+// fallback gain if nil, with the preamp and clipping prevention applied.
+func replayGainForTrack(rg *mediaprovider.ReplayGain, config ReplayGainConfig) float64 {
+	if config.Mode == ReplayGainNone || config.Mode == ReplayGainDynamic {
+		return 0
+	}
+	if rg == nil {
+		return config.FallbackGainDB
+	}
+	gain, peak := rg.TrackGain, rg.TrackPeak
+	if config.Mode == ReplayGainAlbum {
+		gain, peak = rg.AlbumGain, rg.AlbumPeak
+	}
+	gain += config.PreampGainDB
+	if config.PreventClipping && peak > 0 {
+		gain = math.Min(gain, -20*math.Log10(peak))
+	}
+	return gain
+}
@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+func Test_ReplayGainFromMetadata(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	pt.pm.SetReplayGainOptions(ReplayGainConfig{
+		Mode:            ReplayGainTrack,
+		PreampGainDB:    2,
+		PreventClipping: true,
+		FallbackGainDB:  -3,
+	})
+	tracks := makeTracks(100, 100, 100)
+	tracks[0].ReplayGain = &mediaprovider.ReplayGain{TrackGain: -8, TrackPeak: 0.5, AlbumGain: -9}
+	// no metadata for tracks[1]
+	tracks[2].ReplayGain = &mediaprovider.ReplayGain{TrackGain: 5, TrackPeak: 0.5, AlbumGain: 4}
+	pt.loadTracks(tracks, false, false)
+	pt.pm.PlayFromBeginning()
+
+	checkGain := func(want float64) {
+		t.Helper()
+		pt.player.ProcessEvents()
+		if got := pt.player.ReplayGainFallback(); math.Abs(got-want) > 0.01 {
+			t.Errorf("gain for track %d = %g, want %g", pt.pm.NowPlayingIndex(), got, want)
+		}
+	}
+	checkGain(-6)
+	pt.player.SeekNext()
+	checkGain(-3) // fallback gain
+	pt.player.SeekNext()
+	checkGain(6.02) // limited by peak
+
+	pt.pm.SetReplayGainOptions(ReplayGainConfig{Mode: ReplayGainAlbum})
+	checkGain(4)
+	pt.pm.SetReplayGainOptions(ReplayGainConfig{Mode: ReplayGainNone, FallbackGainDB: -3})
+	checkGain(0)
+	pt.pm.SetReplayGainOptions(ReplayGainConfig{Mode: ReplayGainDynamic, FallbackGainDB: -3})
+	checkGain(0)
+}
+
+type replayGainMediaProvider struct {
+	*fakeMediaProvider
+
+	mutex   sync.Mutex
+	lookups map[string]int
+	// lookups of tracks for which it returns true fail
+	fail func(trackID string) bool
+}
+
+func (r *replayGainMediaProvider) GetReplayGain(trackID string) (*mediaprovider.ReplayGain, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lookups[trackID]++
+	if r.fail != nil && r.fail(trackID) {
+		return nil, errors.New("lookup failed")
+	}
+	return &mediaprovider.ReplayGain{TrackGain: -5, AlbumGain: -5}, nil
+}
+
+func (r *replayGainMediaProvider) numLookups(trackID string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.lookups[trackID]
+}
+
+func Test_ReplayGainLookup(t *testing.T) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	rgp := &replayGainMediaProvider{
+		fakeMediaProvider: pt.server,
+		lookups:           make(map[string]int),
+		fail:              func(trackID string) bool { return trackID == "b" },
+	}
+	pt.pm.sm.Server = rgp
+	pt.pm.SetReplayGainOptions(ReplayGainConfig{Mode: ReplayGainTrack, FallbackGainDB: -3})
+
+	waitForLookups := func(trackID string, n int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for rgp.numLookups(trackID) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("track %s looked up %d times, want %d", trackID, rgp.numLookups(trackID), n)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		// let the lookup finish updating the track
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// the first track is prefetched when the queue is loaded
+	pt.loadTracks(makeTracks(100, 100, 100), false, false)
+	waitForLookups("a", 1)
+	pt.pm.PlayFromBeginning()
+	pt.player.ProcessEvents()
+	if got := pt.player.ReplayGainFallback(); got != -5 {
+		t.Errorf("gain for prefetched track = %g, want -5", got)
+	}
+
+	// a failed lookup is retried the next time the track is needed
+	waitForLookups("b", 1)
+	pt.player.SeekNext()
+	pt.player.ProcessEvents()
+	waitForLookups("b", 2)
+	if got := pt.player.ReplayGainFallback(); got != -3 {
+		t.Errorf("gain after failed lookup = %g, want fallback -3", got)
+	}
+
+	// a successful lookup is not repeated, and applies to
+	// every queue entry of the track
+	pt.pm.LoadTracks([]*mediaprovider.Track{{ID: "a", Duration: 100}}, true, false)
+	pt.pm.PlayTrackAt(3)
+	pt.player.ProcessEvents()
+	time.Sleep(20 * time.Millisecond)
+	if n := rgp.numLookups("a"); n != 1 {
+		t.Errorf("track a looked up %d times, want 1", n)
+	}
+	if got := pt.player.ReplayGainFallback(); got != -5 {
+		t.Errorf("gain for second entry of track a = %g, want -5", got)
+	}
+	// the play queue's tracks are not modified from the lookup goroutines
+	for _, tr := range pt.pm.GetPlayQueue() {
+		if tr.ReplayGain != nil {
+			t.Errorf("track %s in queue has ReplayGain set", tr.ID)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const scrobbleQueueFileName = "scrobblequeue.jsonl"
+
+const (
+	scrobbleRetryMinBackoff = 30 * time.Second
+	scrobbleRetryMaxBackoff = 30 * time.Minute
+	// A scrobble which has failed this many times is dropped
+	// if the server is known to be accepting other scrobbles.
+	maxScrobbleAttempts = 5
+)
+
+// A play waiting to be submitted to the server.
+type QueuedScrobble struct {
+	ServerID string    `json:"serverId"`
+	TrackID  string    `json:"trackId"`
+	Time     time.Time `json:"time"`
+	Attempts int       `json:"attempts,omitempty"`
+}
+
+// A persistent queue of scrobbles to submit to the server, so that plays
+// made while the server is unreachable are submitted, with their original
+// play time, once it can be reached again. Failed submissions are retried
+// with exponential backoff, and whenever a server is connected to.
+type ScrobbleQueue struct {
+	ctx      context.Context
+	filePath string
+	sm       *ServerManager
+
+	mutex      sync.Mutex
+	pending    []*QueuedScrobble
+	flushing   bool
+	flushAgain bool // Add was called during a flush
+	// whether the server was accepting scrobbles at the last flush
+	reachable  bool
+	backoff    time.Duration
+	retryTimer *time.Timer
+
+	onPendingChanged []func(int)
+}
+
+// Creates a ScrobbleQueue backed by the given file,
+// loading any scrobbles left pending by a previous run.
+func NewScrobbleQueue(ctx context.Context, filePath string, sm *ServerManager) *ScrobbleQueue {
+	q := &ScrobbleQueue{ctx: ctx, filePath: filePath, sm: sm, backoff: scrobbleRetryMinBackoff}
+	if err := q.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("error loading scrobble queue: %s", err.Error())
+	}
+	sm.OnServerConnected(func() { go q.Flush() })
+	return q
+}
+
+// Registers a callback which is invoked with the number
+// of pending scrobbles, for all servers, when it changes.
+func (q *ScrobbleQueue) OnPendingChanged(cb func(int)) {
+	q.onPendingChanged = append(q.onPendingChanged, cb)
+}
+
+// Returns the number of pending scrobbles, for all servers.
+func (q *ScrobbleQueue) Pending() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pending)
+}
+
+// Queues a scrobble of the track, played at the given time,
+// for the current server, and begins submitting it.
+func (q *ScrobbleQueue) Add(trackID string, playTime time.Time) {
+	q.add(trackID, playTime)
+	go q.Flush()
+}
+
+func (q *ScrobbleQueue) add(trackID string, playTime time.Time) {
+	q.mutex.Lock()
+	q.pending = append(q.pending, &QueuedScrobble{
+		ServerID: q.sm.ServerID.String(),
+		TrackID:  trackID,
+		Time:     playTime,
+	})
+	q.save()
+	n := len(q.pending)
+	q.mutex.Unlock()
+	q.invokeOnPendingChanged(n)
+}
+
+// Submits the pending scrobbles for the current server. On the first failure,
+// one more scrobble is tried to tell if the server is unreachable, or rejected
+// the failed scrobble, and then submission is stopped and retried later.
+// Failed scrobbles are moved to the back of the queue, so that one the server
+// rejects does not block the others.
+func (q *ScrobbleQueue) Flush() {
+	q.mutex.Lock()
+	server := q.sm.Server
+	if q.flushing {
+		q.flushAgain = true
+	}
+	if q.flushing || server == nil || q.ctx.Err() != nil {
+		q.mutex.Unlock()
+		return
+	}
+	q.flushing = true
+	if q.retryTimer != nil {
+		q.retryTimer.Stop()
+		q.retryTimer = nil
+	}
+	serverID := q.sm.ServerID.String()
+	var batch []*QueuedScrobble
+	for _, s := range q.pending {
+		if s.ServerID == serverID {
+			batch = append(batch, s)
+		}
+	}
+	q.mutex.Unlock()
+
+	sent := make(map[*QueuedScrobble]bool)
+	var failed []*QueuedScrobble
+	for _, s := range batch {
+		if err := server.Scrobble(s.TrackID, true, s.Time); err != nil {
+			log.Printf("error submitting scrobble: %s", err.Error())
+			failed = append(failed, s)
+			if len(sent) == 0 && len(failed) > 1 {
+				break // most likely the server is unreachable
+			}
+			continue
+		}
+		sent[s] = true
+	}
+
+	q.mutex.Lock()
+	keep := make([]*QueuedScrobble, 0, len(q.pending))
+	for _, s := range q.pending {
+		if !sent[s] && !containsScrobble(failed, s) {
+			keep = append(keep, s)
+		}
+	}
+	if len(sent) > 0 {
+		q.reachable = true
+	} else if len(failed) > 1 {
+		q.reachable = false
+	}
+	for _, s := range failed {
+		s.Attempts++
+		if q.reachable && s.Attempts >= maxScrobbleAttempts {
+			log.Printf("dropping scrobble of track %s after %d attempts", s.TrackID, s.Attempts)
+			continue
+		}
+		keep = append(keep, s)
+	}
+	changed := len(keep) != len(q.pending)
+	q.pending = keep
+	if len(batch) > 0 {
+		q.save()
+	}
+	if len(failed) > 0 {
+		q.scheduleRetry(len(sent) == 0)
+	} else {
+		q.backoff = scrobbleRetryMinBackoff
+	}
+	q.flushing = false
+	again := q.flushAgain && len(failed) == 0
+	q.flushAgain = false
+	n := len(q.pending)
+	q.mutex.Unlock()
+	if changed {
+		q.invokeOnPendingChanged(n)
+	}
+	if again {
+		q.Flush()
+	}
+}
+
+// must be called with the mutex held
+func (q *ScrobbleQueue) scheduleRetry(increaseBackoff bool) {
+	if increaseBackoff {
+		q.backoff *= 2
+		if q.backoff > scrobbleRetryMaxBackoff {
+			q.backoff = scrobbleRetryMaxBackoff
+		}
+	} else {
+		q.backoff = scrobbleRetryMinBackoff
+	}
+	q.retryTimer = time.AfterFunc(q.backoff, q.Flush)
+}
+
+func (q *ScrobbleQueue) invokeOnPendingChanged(n int) {
+	for _, cb := range q.onPendingChanged {
+		cb(n)
+	}
+}
+
+func containsScrobble(list []*QueuedScrobble, s *QueuedScrobble) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *ScrobbleQueue) load() error {
+	f, err := os.Open(q.filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s QueuedScrobble
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			// skip a malformed line, eg. a partial write if the app crashed
+			continue
+		}
+		q.pending = append(q.pending, &s)
+	}
+	return scanner.Err()
+}
+
+// must be called with the mutex held
+func (q *ScrobbleQueue) save() {
+	if err := q.rewriteFile(); err != nil {
+		log.Printf("error saving scrobble queue: %s", err.Error())
+	}
+}
+
+// must be called with the mutex held
+func (q *ScrobbleQueue) rewriteFile() error {
+	if len(q.pending) == 0 {
+		if err := os.Remove(q.filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	tmpPath := q.filePath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, s := range q.pending {
+		if err := writeQueuedScrobble(w, s); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, q.filePath)
+}
+
+func writeQueuedScrobble(w io.Writer, s *QueuedScrobble) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
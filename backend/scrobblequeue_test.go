@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func Test_ScrobbleQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	filePath := filepath.Join(t.TempDir(), scrobbleQueueFileName)
+	offline := true
+	server := &fakeMediaProvider{failScrobble: func(id string) bool { return offline || id == "bad" }}
+	sm := &ServerManager{ServerID: uuid.New()}
+	q := NewScrobbleQueue(ctx, filePath, sm)
+
+	// queued while not connected to the server
+	playTime := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	q.add("1", playTime)
+	q.add("bad", playTime.Add(time.Minute))
+	q.add("2", playTime.Add(2*time.Minute))
+	if n := q.Pending(); n != 3 {
+		t.Fatalf("got %d pending, want 3", n)
+	}
+
+	// persisted and reloaded at the next startup
+	q = NewScrobbleQueue(ctx, filePath, sm)
+	if n := q.Pending(); n != 3 {
+		t.Fatalf("got %d pending after reload, want 3", n)
+	}
+	if q.pending[1].TrackID != "bad" || !q.pending[1].Time.Equal(playTime.Add(time.Minute)) {
+		t.Errorf("unexpected reloaded scrobble: %+v", q.pending[1])
+	}
+
+	// server unreachable: stops after probing a second scrobble
+	sm.Server = server
+	q.Flush()
+	if n := q.Pending(); n != 3 {
+		t.Errorf("got %d pending while offline, want 3", n)
+	}
+
+	offline = false
+	for i := 0; i < maxScrobbleAttempts; i++ {
+		q.Flush()
+	}
+	// failed scrobbles were moved to the back of the queue
+	if got := server.waitForScrobbles(t, 2); !reflect.DeepEqual(got, []string{"2", "1"}) {
+		t.Errorf("got scrobbles %v, want [2 1]", got)
+	}
+	// the rejected scrobble is eventually dropped
+	if n := q.Pending(); n != 0 {
+		t.Errorf("got %d pending, want 0", n)
+	}
+	q.mutex.Lock()
+	if q.retryTimer != nil {
+		q.retryTimer.Stop()
+	}
+	q.mutex.Unlock()
+}
@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"log"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+// An external service, such as ListenBrainz, to which plays are submitted
+// in addition to the server, according to the same scrobble thresholds.
+// Methods are called in their own goroutine, and should do nothing if the
+// service is not enabled.
+type Scrobbler interface {
+	// Reports that the track has started playing.
+	SendNowPlaying(track *mediaprovider.Track) error
+	// Submits a listen of the track, which started playing at the given time.
+	Scrobble(track *mediaprovider.Track, startTime time.Time) error
+}
+
+// Sets the queue through which scrobbles are submitted to the server.
+// If not set, scrobbles are submitted directly, and lost if submission fails.
+func (p *PlaybackManager) SetScrobbleQueue(q *ScrobbleQueue) {
+	p.scrobbleQueue = q
+}
+
+func (p *PlaybackManager) submitServerScrobble(trackID string, playTime time.Time) {
+	if p.scrobbleQueue != nil {
+		p.scrobbleQueue.Add(trackID, playTime)
+		return
+	}
+	go p.sm.Server.Scrobble(trackID, true, playTime)
+}
+
+// Adds a scrobbler to which now playing and scrobble events are sent.
+func (p *PlaybackManager) AddScrobbler(s Scrobbler) {
+	p.scrobblers = append(p.scrobblers, s)
+}
+
+func (p *PlaybackManager) sendNowPlayingToScrobblers(track *mediaprovider.Track) {
+	for _, s := range p.scrobblers {
+		go func(s Scrobbler) {
+			if err := s.SendNowPlaying(track); err != nil {
+				log.Printf("error sending now playing: %s", err.Error())
+			}
+		}(s)
+	}
+}
+
+func (p *PlaybackManager) scrobbleToScrobblers(track *mediaprovider.Track, startTime time.Time) {
+	for _, s := range p.scrobblers {
+		go func(s Scrobbler) {
+			if err := s.Scrobble(track, startTime); err != nil {
+				log.Printf("error scrobbling: %s", err.Error())
+			}
+		}(s)
+	}
+}
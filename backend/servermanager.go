@@ -3,6 +3,7 @@ package backend
 import (
 	"context"
 	"errors"
+	"log"
 	"net/http"
 	"time"
 
@@ -23,6 +24,7 @@ type ServerManager struct {
 	config            *Config
 	onServerConnected []func()
 	onLogout          []func()
+	onSetFavorite     []func(mediaprovider.RatingFavoriteParameters, bool)
 }
 
 var ErrUnreachable = errors.New("server is unreachable")
@@ -148,6 +150,29 @@ func (s *ServerManager) OnLogout(cb func()) {
 	s.onLogout = append(s.onLogout, cb)
 }
 
+// Sets a callback that is invoked when items are (un)favorited through SetFavorite.
+func (s *ServerManager) OnSetFavorite(cb func(params mediaprovider.RatingFavoriteParameters, favorite bool)) {
+	s.onSetFavorite = append(s.onSetFavorite, cb)
+}
+
+// Sets the favorite status of the items on the server in the background.
+// All favorite changes made by the user should go through here, so that
+// the OnSetFavorite callbacks (e.g. syncing Last.fm loved tracks) are invoked.
+func (s *ServerManager) SetFavorite(params mediaprovider.RatingFavoriteParameters, favorite bool) {
+	server := s.Server
+	if server == nil {
+		return
+	}
+	go func() {
+		if err := server.SetFavorite(params, favorite); err != nil {
+			log.Printf("error setting favorite: %s", err.Error())
+		}
+	}()
+	for _, cb := range s.onSetFavorite {
+		cb(params, favorite)
+	}
+}
+
 func (s *ServerManager) GetServerPassword(serverID uuid.UUID) (string, error) {
 	return keyring.Get(s.appName, serverID.String())
 }
@@ -0,0 +1,296 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dweymouth/supersonic/player"
+)
+
+// The mode of the sleep timer (SleepTimerOff, SleepTimerDuration, SleepTimerTracks).
+type SleepTimerMode int
+
+const (
+	SleepTimerOff SleepTimerMode = iota
+	// Pause playback after a fixed amount of time.
+	SleepTimerDuration
+	// Pause playback when a number of tracks, counting the current one, have finished.
+	SleepTimerTracks
+)
+
+// Preset durations offered by the UI for the sleep timer.
+var SleepTimerPresets = []time.Duration{
+	15 * time.Minute,
+	30 * time.Minute,
+	45 * time.Minute,
+	60 * time.Minute,
+	90 * time.Minute,
+}
+
+// Length of the volume fade-out at the end of the sleep timer, if enabled.
+const sleepTimerFadeDuration = 1 * time.Minute
+
+// The current state of the sleep timer.
+// Returned by PlaybackManager.SleepTimerStatus and passed to OnSleepTimerUpdate callbacks.
+type SleepTimerStatus struct {
+	Mode SleepTimerMode
+
+	// Time left until playback is paused. Always set in SleepTimerDuration mode.
+	// In SleepTimerTracks mode, it is only set once the final track is playing.
+	Remaining time.Duration
+
+	// Number of tracks, including the current one, left to play in SleepTimerTracks mode.
+	TracksRemaining int
+}
+
+type sleepTimer struct {
+	// identifies the timer, so that ticks and track changes
+	// don't act on a timer started since; zero if off
+	id         int
+	mode       SleepTimerMode
+	deadline   time.Time
+	tracksLeft int
+	fadeOut    bool
+	fading     bool
+	origVolume int
+	// the volume last set by the fade, to tell if the user changed it
+	fadeVolume int
+	cancelTick context.CancelFunc
+}
+
+// Starts a sleep timer which pauses playback after the given duration.
+// If fadeOut is true, the volume is gradually lowered during the final minute
+// and restored to its original level once playback has been paused.
+// Replaces any sleep timer already running.
+func (p *PlaybackManager) StartSleepTimer(d time.Duration, fadeOut bool) {
+	p.sleepTimerMutex.Lock()
+	old := p.resetSleepTimerLocked()
+	p.startSleepTimerLocked(sleepTimer{
+		mode:     SleepTimerDuration,
+		deadline: time.Now().Add(d),
+		fadeOut:  fadeOut,
+	})
+	p.sleepTimerMutex.Unlock()
+	p.cleanUpSleepTimer(old)
+	p.invokeOnSleepTimerUpdateCallbacks()
+}
+
+// Starts a sleep timer which pauses playback once the given number of tracks,
+// including the currently playing one, have finished. StopAfterTracks(1, ...)
+// stops after the current track. See StartSleepTimer for the fadeOut option.
+func (p *PlaybackManager) StopAfterTracks(n int, fadeOut bool) {
+	if n < 1 {
+		n = 1
+	}
+	p.sleepTimerMutex.Lock()
+	old := p.resetSleepTimerLocked()
+	p.startSleepTimerLocked(sleepTimer{
+		mode:       SleepTimerTracks,
+		tracksLeft: n,
+		fadeOut:    fadeOut,
+	})
+	p.sleepTimerMutex.Unlock()
+	p.cleanUpSleepTimer(old)
+	if n == 1 {
+		p.pauseAtEndOfTrack(true)
+	}
+	p.invokeOnSleepTimerUpdateCallbacks()
+}
+
+// Cancels the running sleep timer, if any, restoring the volume if it was being faded out.
+func (p *PlaybackManager) CancelSleepTimer() {
+	p.sleepTimerMutex.Lock()
+	if p.sleepTimer.mode == SleepTimerOff {
+		p.sleepTimerMutex.Unlock()
+		return
+	}
+	old := p.resetSleepTimerLocked()
+	p.sleepTimerMutex.Unlock()
+	p.cleanUpSleepTimer(old)
+	p.invokeOnSleepTimerUpdateCallbacks()
+}
+
+// Gets the current state of the sleep timer.
+func (p *PlaybackManager) SleepTimerStatus() SleepTimerStatus {
+	p.sleepTimerMutex.Lock()
+	t := p.sleepTimer
+	p.sleepTimerMutex.Unlock()
+	return p.sleepTimerStatus(t)
+}
+
+func (p *PlaybackManager) sleepTimerStatus(t sleepTimer) SleepTimerStatus {
+	s := SleepTimerStatus{Mode: t.mode}
+	switch t.mode {
+	case SleepTimerDuration:
+		s.Remaining = time.Until(t.deadline)
+		if s.Remaining < 0 {
+			s.Remaining = 0
+		}
+	case SleepTimerTracks:
+		s.TracksRemaining = t.tracksLeft
+		if s.TracksRemaining == 1 {
+			status := p.player.GetStatus()
+			s.Remaining = time.Duration((status.Duration - status.TimePos) * float64(time.Second))
+		}
+	}
+	return s
+}
+
+// Registers a callback that is notified whenever the sleep timer is started,
+// cancelled or fires, and periodically while it is running.
+func (p *PlaybackManager) OnSleepTimerUpdate(cb func(SleepTimerStatus)) {
+	p.onSleepTimerUpdate = append(p.onSleepTimerUpdate, cb)
+}
+
+// called from the Player track change callback
+func (p *PlaybackManager) sleepTimerOnTrackChange() {
+	p.sleepTimerMutex.Lock()
+	if p.sleepTimer.mode != SleepTimerTracks {
+		p.sleepTimerMutex.Unlock()
+		return
+	}
+	p.sleepTimer.tracksLeft--
+	id, tracksLeft := p.sleepTimer.id, p.sleepTimer.tracksLeft
+	p.sleepTimerMutex.Unlock()
+	switch {
+	case tracksLeft <= 0:
+		// the player paused at the end of the final track, or it was skipped
+		p.fireSleepTimer(id)
+	case tracksLeft == 1:
+		p.pauseAtEndOfTrack(true)
+	}
+}
+
+// have the player pause when the final track ends, rather than
+// pausing after the next track has begun
+func (p *PlaybackManager) pauseAtEndOfTrack(pause bool) {
+	if err := p.player.SetPauseAtEndOfTrack(pause); err != nil {
+		log.Printf("error setting pause at end of track: %s", err.Error())
+	}
+}
+
+// called from the Player stopped callback
+func (p *PlaybackManager) sleepTimerOnStopped() {
+	p.sleepTimerMutex.Lock()
+	mode := p.sleepTimer.mode
+	p.sleepTimerMutex.Unlock()
+	// reached the end of the play queue; nothing left to stop
+	if mode == SleepTimerTracks {
+		p.CancelSleepTimer()
+	}
+}
+
+// pauses playback, if the sleep timer with the given ID is still running
+func (p *PlaybackManager) fireSleepTimer(id int) {
+	p.sleepTimerMutex.Lock()
+	if p.sleepTimer.id != id {
+		p.sleepTimerMutex.Unlock()
+		return
+	}
+	old := p.resetSleepTimerLocked()
+	p.sleepTimerMutex.Unlock()
+	log.Println("Sleep timer expired, pausing playback")
+	p.player.Pause()
+	p.cleanUpSleepTimer(old)
+	p.invokeOnSleepTimerUpdateCallbacks()
+}
+
+// must be called with the sleep timer mutex held
+func (p *PlaybackManager) startSleepTimerLocked(t sleepTimer) {
+	p.sleepTimerSeq++
+	t.id = p.sleepTimerSeq
+	ctx, cancel := context.WithCancel(p.ctx)
+	t.cancelTick = cancel
+	p.sleepTimer = t
+	ticker := time.NewTicker(1 * time.Second)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.doSleepTimerTick(t.id)
+			}
+		}
+	}()
+}
+
+func (p *PlaybackManager) doSleepTimerTick(id int) {
+	p.sleepTimerMutex.Lock()
+	t := p.sleepTimer
+	p.sleepTimerMutex.Unlock()
+	if t.id != id {
+		return
+	}
+	s := p.sleepTimerStatus(t)
+	if s.Mode == SleepTimerDuration && s.Remaining <= 0 {
+		p.fireSleepTimer(id)
+		return
+	}
+	lastTrack := s.Mode == SleepTimerDuration || s.TracksRemaining == 1
+	if t.fadeOut && lastTrack && s.Remaining <= sleepTimerFadeDuration &&
+		p.player.GetStatus().State == player.Playing {
+		if vol, ok := p.sleepTimerFadeVolume(id, s.Remaining); ok {
+			p.player.SetVolume(vol)
+		}
+	}
+	p.invokeOnSleepTimerUpdateCallbacks()
+}
+
+// Returns the volume to fade to with the given time remaining, and false if the
+// fade is over because the timer was replaced or the user changed the volume.
+func (p *PlaybackManager) sleepTimerFadeVolume(id int, remaining time.Duration) (int, bool) {
+	curVolume := p.player.GetVolume()
+	p.sleepTimerMutex.Lock()
+	defer p.sleepTimerMutex.Unlock()
+	t := &p.sleepTimer
+	if t.id != id || !t.fadeOut {
+		return 0, false
+	}
+	if !t.fading {
+		t.fading = true
+		t.origVolume = curVolume
+	} else if curVolume != t.fadeVolume {
+		// keep the volume the user chose, rather than restoring it later
+		t.fading, t.fadeOut = false, false
+		return 0, false
+	}
+	frac := remaining.Seconds() / sleepTimerFadeDuration.Seconds()
+	t.fadeVolume = int(float64(t.origVolume) * frac)
+	return t.fadeVolume, true
+}
+
+// Stops the sleep timer, returning its state to pass to cleanUpSleepTimer
+// once the mutex, which must be held, is released.
+func (p *PlaybackManager) resetSleepTimerLocked() sleepTimer {
+	old := p.sleepTimer
+	if old.cancelTick != nil {
+		old.cancelTick()
+	}
+	p.sleepTimer = sleepTimer{}
+	return old
+}
+
+// undoes the effects on the player of a stopped sleep timer
+func (p *PlaybackManager) cleanUpSleepTimer(old sleepTimer) {
+	if old.mode == SleepTimerTracks {
+		p.pauseAtEndOfTrack(false)
+	}
+	if old.fading {
+		// restore through SetVolume, so the UI and MPRIS are notified
+		p.SetVolume(old.origVolume)
+	}
+}
+
+func (p *PlaybackManager) invokeOnSleepTimerUpdateCallbacks() {
+	if p.callbacksDisabled {
+		return
+	}
+	s := p.SleepTimerStatus()
+	for _, cb := range p.onSleepTimerUpdate {
+		cb(s)
+	}
+}
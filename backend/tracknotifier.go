@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"image"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/player"
+)
+
+// actions of the track change notification
+const (
+	notificationActionNext     = "next"
+	notificationActionFavorite = "favorite"
+)
+
+// Shows a desktop notification when a new track starts playing, replacing
+// the previous one. Where supported (over D-Bus on Linux), notifications
+// have the cover art and Next and Favorite actions. Elsewhere, they are
+// shown with OnFallbackNotify, if set.
+type TrackNotifier struct {
+	// Function to look up the cover thumbnail for a given cover ID
+	CoverLookup func(coverID string) (image.Image, error)
+
+	// Function called to (un)set the track as a favorite from the Favorite action
+	OnSetFavorite func(trackID string, favorite bool)
+
+	// Function called to show a plain notification,
+	// on platforms without a notification sender
+	OnFallbackNotify func(title, content string)
+
+	config *AppConfig
+	p      player.BasePlayer
+	sender trackNotificationSender
+
+	mutex sync.Mutex
+	// incremented on each track change, so that notifications
+	// still fetching their cover are dropped if outdated
+	seq int
+	// the track of the notification last shown, and the notification,
+	// which is updated when the track is (un)favorited from it
+	shown             *mediaprovider.Track
+	shownNotification trackNotification
+}
+
+type trackNotification struct {
+	Title    string
+	Body     string
+	Cover    image.Image // nil if none
+	Favorite bool
+}
+
+// Sends track change notifications, each replacing the last.
+type trackNotificationSender interface {
+	Notify(n trackNotification) error
+}
+
+func NewTrackNotifier(appName string, config *AppConfig, pm *PlaybackManager, p player.BasePlayer) *TrackNotifier {
+	t := &TrackNotifier{config: config, p: p}
+	// nil if unsupported on this platform
+	t.sender = newTrackNotificationSender(appName, t.onAction)
+	pm.OnSongChange(func(track, _ *mediaprovider.Track) {
+		if track != nil && t.config.ShowTrackChangeNotifications {
+			t.mutex.Lock()
+			t.seq++
+			seq := t.seq
+			t.mutex.Unlock()
+			go t.notify(track, seq)
+		}
+	})
+	return t
+}
+
+func (t *TrackNotifier) notify(track *mediaprovider.Track, seq int) {
+	n := trackNotification{
+		Title:    track.Name,
+		Body:     strings.Join(track.ArtistNames, ", "),
+		Favorite: track.Favorite,
+	}
+	if track.Album != "" {
+		if n.Body != "" {
+			n.Body += " – "
+		}
+		n.Body += track.Album
+	}
+	if t.sender == nil {
+		if t.OnFallbackNotify != nil {
+			t.OnFallbackNotify(n.Title, n.Body)
+		}
+		return
+	}
+
+	if track.CoverArtID != "" && t.CoverLookup != nil {
+		if im, err := t.CoverLookup(track.CoverArtID); err == nil {
+			n.Cover = im
+		}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if seq != t.seq {
+		return // a newer track is playing
+	}
+	if err := t.sender.Notify(n); err != nil {
+		log.Printf("error sending track notification: %s", err.Error())
+		return
+	}
+	t.shown = track
+	t.shownNotification = n
+}
+
+func (t *TrackNotifier) onAction(action string) {
+	switch action {
+	case notificationActionNext:
+		if err := t.p.SeekNext(); err != nil {
+			log.Printf("error skipping to next track: %s", err.Error())
+		}
+	case notificationActionFavorite:
+		t.mutex.Lock()
+		track := t.shown
+		if track == nil {
+			t.mutex.Unlock()
+			return
+		}
+		t.shownNotification.Favorite = !t.shownNotification.Favorite
+		n := t.shownNotification
+		// re-send the notification so its action is labeled for the new state
+		if err := t.sender.Notify(n); err != nil {
+			log.Printf("error sending track notification: %s", err.Error())
+		}
+		t.mutex.Unlock()
+		if t.OnSetFavorite != nil {
+			t.OnSetFavorite(track.ID, n.Favorite)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+//go:build !darwin && !windows
+
+package backend
+
+import (
+	"image"
+	"image/draw"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsDest  = "org.freedesktop.Notifications"
+	notificationsPath  = "/org/freedesktop/Notifications"
+	notificationsIface = "org.freedesktop.Notifications"
+
+	// name of the icon and .desktop file installed with the app
+	notificationDesktopEntry = "supersonic-desktop"
+)
+
+var notificationMarkupEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Sends notifications over the org.freedesktop.Notifications D-Bus interface.
+type dbusNotificationSender struct {
+	appName  string
+	onAction func(action string)
+
+	mutex sync.Mutex
+	conn  *dbus.Conn
+	// ID of the notification last shown, replaced by the next
+	lastID uint32
+	// capabilities of the notification server
+	supportsActions bool
+	supportsMarkup  bool
+}
+
+// The image-data hint of a notification, of D-Bus signature (iiibiiay)
+type notificationImageData struct {
+	Width         int32
+	Height        int32
+	RowStride     int32
+	HasAlpha      bool
+	BitsPerSample int32
+	Channels      int32
+	Data          []byte
+}
+
+func newTrackNotificationSender(appName string, onAction func(action string)) trackNotificationSender {
+	return &dbusNotificationSender{appName: appName, onAction: onAction}
+}
+
+func (d *dbusNotificationSender) Notify(n trackNotification) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.conn == nil {
+		if err := d.connect(); err != nil {
+			return err
+		}
+	}
+
+	actions := []string{}
+	if d.supportsActions {
+		favorite := "Favorite"
+		if n.Favorite {
+			favorite = "Unfavorite"
+		}
+		actions = append(actions, notificationActionNext, "Next", notificationActionFavorite, favorite)
+	}
+	hints := map[string]dbus.Variant{
+		"desktop-entry": dbus.MakeVariant(notificationDesktopEntry),
+		"urgency":       dbus.MakeVariant(byte(0)), // low
+	}
+	if n.Cover != nil {
+		hints["image-data"] = dbus.MakeVariant(toNotificationImageData(n.Cover))
+	}
+	body := n.Body
+	if d.supportsMarkup {
+		body = notificationMarkupEscaper.Replace(body)
+	}
+
+	call := d.conn.Object(notificationsDest, notificationsPath).Call(notificationsIface+".Notify", 0,
+		d.appName, d.lastID, notificationDesktopEntry, n.Title, body, actions, hints, int32(-1))
+	if call.Err != nil {
+		return call.Err
+	}
+	return call.Store(&d.lastID)
+}
+
+// must be called with the mutex held
+func (d *dbusNotificationSender) connect() error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	var caps []string
+	if err := conn.Object(notificationsDest, notificationsPath).
+		Call(notificationsIface+".GetCapabilities", 0).Store(&caps); err != nil {
+		return err
+	}
+	for _, c := range caps {
+		switch c {
+		case "actions":
+			d.supportsActions = true
+		case "body-markup":
+			d.supportsMarkup = true
+		}
+	}
+	if d.supportsActions {
+		if err := conn.AddMatchSignal(
+			dbus.WithMatchObjectPath(notificationsPath),
+			dbus.WithMatchInterface(notificationsIface),
+			dbus.WithMatchMember("ActionInvoked"),
+		); err != nil {
+			return err
+		}
+		signals := make(chan *dbus.Signal, 10)
+		conn.Signal(signals)
+		go d.handleSignals(signals)
+	}
+	d.conn = conn
+	return nil
+}
+
+func (d *dbusNotificationSender) handleSignals(signals <-chan *dbus.Signal) {
+	for sig := range signals {
+		if sig.Name != notificationsIface+".ActionInvoked" || len(sig.Body) != 2 {
+			continue
+		}
+		id, _ := sig.Body[0].(uint32)
+		action, _ := sig.Body[1].(string)
+		d.mutex.Lock()
+		ours := id == d.lastID
+		d.mutex.Unlock()
+		if ours {
+			d.onAction(action)
+		}
+	}
+}
+
+func toNotificationImageData(im image.Image) notificationImageData {
+	rgba, ok := im.(*image.RGBA)
+	if !ok || rgba.Bounds().Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, im.Bounds().Dx(), im.Bounds().Dy()))
+		draw.Draw(rgba, rgba.Bounds(), im, im.Bounds().Min, draw.Src)
+	}
+	return notificationImageData{
+		Width:         int32(rgba.Bounds().Dx()),
+		Height:        int32(rgba.Bounds().Dy()),
+		RowStride:     int32(rgba.Stride),
+		HasAlpha:      true,
+		BitsPerSample: 8,
+		Channels:      4,
+		Data:          rgba.Pix,
+	}
+}
@@ -0,0 +1,8 @@
+//go:build darwin || windows
+
+package backend
+
+func newTrackNotificationSender(appName string, onAction func(action string)) trackNotificationSender {
+	// D-Bus notifications are only supported on Linux
+	return nil
+}
@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+)
+
+type fakeNotificationSender struct {
+	sent chan trackNotification
+}
+
+func (f *fakeNotificationSender) Notify(n trackNotification) error {
+	f.sent <- n
+	return nil
+}
+
+func (f *fakeNotificationSender) waitForNotification(t *testing.T) trackNotification {
+	t.Helper()
+	select {
+	case n := <-f.sent:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for notification")
+		return trackNotification{}
+	}
+}
+
+func newTrackNotifierTest(t *testing.T, enabled bool) (*playbackManagerTest, *TrackNotifier, *fakeNotificationSender) {
+	pt := newPlaybackManagerTest(t, ScrobbleConfig{})
+	tn := NewTrackNotifier("supersonic", &AppConfig{ShowTrackChangeNotifications: enabled}, pt.pm, pt.player)
+	sender := &fakeNotificationSender{sent: make(chan trackNotification, 10)}
+	tn.sender = sender
+	tn.CoverLookup = func(coverID string) (image.Image, error) {
+		return image.NewRGBA(image.Rect(0, 0, 2, 2)), nil
+	}
+	return pt, tn, sender
+}
+
+func Test_TrackNotifier(t *testing.T) {
+	pt, tn, sender := newTrackNotifierTest(t, true)
+	tracks := makeTracks(100, 100)
+	tracks[0].ArtistNames = []string{"Artist 1", "Artist 2"}
+	tracks[0].Album = "Album"
+	tracks[0].CoverArtID = "cover"
+	tracks[1].Favorite = true
+	pt.loadTracks(tracks, false, false)
+	pt.pm.PlayFromBeginning()
+	pt.player.ProcessEvents()
+
+	n := sender.waitForNotification(t)
+	if n.Title != "Track 1" || n.Body != "Artist 1, Artist 2 – Album" || n.Cover == nil || n.Favorite {
+		t.Errorf("notification = %+v, want Track 1 by Artist 1, Artist 2 with cover", n)
+	}
+
+	tn.onAction(notificationActionNext)
+	pt.player.ProcessEvents()
+	n = sender.waitForNotification(t)
+	if n.Title != "Track 2" || n.Body != "" || n.Cover != nil || !n.Favorite {
+		t.Errorf("notification = %+v, want favorited Track 2 without cover", n)
+	}
+
+	var favorited []string
+	tn.OnSetFavorite = func(trackID string, favorite bool) {
+		if !favorite {
+			favorited = append(favorited, trackID)
+		}
+	}
+	tn.onAction(notificationActionFavorite)
+	if len(favorited) != 1 || favorited[0] != "b" {
+		t.Errorf("unfavorited %v, want [b]", favorited)
+	}
+	if n = sender.waitForNotification(t); n.Title != "Track 2" || n.Favorite {
+		t.Errorf("notification = %+v, want unfavorited Track 2", n)
+	}
+	// toggling again favorites the track
+	tn.onAction(notificationActionFavorite)
+	if len(favorited) != 1 {
+		t.Errorf("unfavorited %v again, want it favorited", favorited)
+	}
+	if n = sender.waitForNotification(t); !n.Favorite {
+		t.Errorf("notification = %+v, want favorited Track 2", n)
+	}
+}
+
+func Test_TrackNotifier_Disabled(t *testing.T) {
+	pt, _, sender := newTrackNotifierTest(t, false)
+	pt.loadTracks(makeTracks(100), false, false)
+	pt.pm.PlayFromBeginning()
+	pt.player.ProcessEvents()
+
+	select {
+	case n := <-sender.sent:
+		t.Errorf("got notification %+v, want none", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func Test_TrackNotifier_DropsOutdated(t *testing.T) {
+	_, tn, sender := newTrackNotifierTest(t, true)
+	tn.seq = 2
+	tn.notify(&mediaprovider.Track{ID: "a", Name: "Outdated"}, 1)
+	tn.notify(&mediaprovider.Track{ID: "b", Name: "Current"}, 2)
+
+	if n := sender.waitForNotification(t); n.Title != "Current" {
+		t.Errorf("notification = %+v, want Current", n)
+	}
+	if tn.shown == nil || tn.shown.ID != "b" {
+		t.Errorf("shown track = %v, want b", tn.shown)
+	}
+}
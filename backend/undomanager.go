@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Maximum number of actions remembered by the UndoManager.
+const maxUndoActions = 20
+
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// Records destructive user actions, such as removing tracks from the
+// play queue or a playlist, so that they can be reversed.
+type UndoManager struct {
+	mutex   sync.Mutex
+	actions []undoAction
+
+	onActionRecorded []func(description string)
+}
+
+type undoAction struct {
+	description string
+	undo        func() error
+}
+
+func NewUndoManager() *UndoManager {
+	return &UndoManager{}
+}
+
+// Records an action which can be undone by calling the given undo func.
+// The description is a short, user-facing summary of the action, eg. "Removed 3 tracks from queue".
+// The undo func is called synchronously from Undo, which the UI invokes on its
+// goroutine, so it should make any slow server requests in the background.
+func (u *UndoManager) Record(description string, undo func() error) {
+	u.mutex.Lock()
+	u.actions = append(u.actions, undoAction{description: description, undo: undo})
+	if len(u.actions) > maxUndoActions {
+		u.actions = u.actions[len(u.actions)-maxUndoActions:]
+	}
+	u.mutex.Unlock()
+
+	for _, cb := range u.onActionRecorded {
+		cb(description)
+	}
+}
+
+// Returns true if there is an action that can be undone.
+func (u *UndoManager) CanUndo() bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return len(u.actions) > 0
+}
+
+// Undoes the most recently recorded action.
+// Returns ErrNothingToUndo if there are no actions recorded.
+func (u *UndoManager) Undo() error {
+	u.mutex.Lock()
+	if len(u.actions) == 0 {
+		u.mutex.Unlock()
+		return ErrNothingToUndo
+	}
+	action := u.actions[len(u.actions)-1]
+	u.actions = u.actions[:len(u.actions)-1]
+	u.mutex.Unlock()
+
+	if err := action.undo(); err != nil {
+		return fmt.Errorf("failed to undo %q: %v", action.description, err)
+	}
+	return nil
+}
+
+// Forgets all recorded actions.
+func (u *UndoManager) Clear() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.actions = nil
+}
+
+// Registers a callback that is notified whenever a new undoable action is recorded.
+func (u *UndoManager) OnActionRecorded(cb func(description string)) {
+	u.onActionRecorded = append(u.onActionRecorded, cb)
+}
+
+// Returns "1 track" or "N tracks".
+func TracksCountDescription(n int) string {
+	if n == 1 {
+		return "1 track"
+	}
+	return fmt.Sprintf("%d tracks", n)
+}
@@ -3,6 +3,10 @@ package util
 import "time"
 
 type Stopwatch struct {
+	// Returns the current time. If nil, time.Now is used.
+	// Can be replaced to control the passage of time in tests.
+	Clock func() time.Time
+
 	running bool
 	started time.Time
 	elapsed time.Duration
@@ -12,7 +16,7 @@ func (s *Stopwatch) Start() {
 	if s.running {
 		return
 	}
-	s.started = time.Now()
+	s.started = s.now()
 	s.running = true
 }
 
@@ -20,14 +24,14 @@ func (s *Stopwatch) Stop() {
 	if !s.running {
 		return
 	}
-	s.elapsed += time.Since(s.started)
+	s.elapsed += s.now().Sub(s.started)
 	s.running = false
 }
 
 func (s *Stopwatch) Elapsed() time.Duration {
 	e := s.elapsed
 	if s.running {
-		e += time.Since(s.started)
+		e += s.now().Sub(s.started)
 	}
 	return e
 }
@@ -36,3 +40,10 @@ func (s *Stopwatch) Reset() {
 	s.running = false
 	s.elapsed = time.Duration(0)
 }
+
+func (s *Stopwatch) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dweymouth/supersonic/backend"
+)
+
+type cliCommand struct {
+	ipcCommand string
+	// usage of the arguments, if any
+	args string
+	// number of arguments sent to the running instance
+	nargs int
+}
+
+// Subcommands which control the running instance, eg. `supersonic next`
+var cliCommands = map[string]cliCommand{
+	"play-pause":  {ipcCommand: backend.IPCPlayPause},
+	"next":        {ipcCommand: backend.IPCNext},
+	"prev":        {ipcCommand: backend.IPCPrevious},
+	"volume":      {ipcCommand: backend.IPCVolume, args: "<N|+N|-N>", nargs: 1},
+	"play-album":  {ipcCommand: backend.IPCPlayAlbum, args: "<album ID>", nargs: 1},
+	"now-playing": {ipcCommand: backend.IPCNowPlaying, args: "[--json]"},
+}
+
+// Runs the subcommand with the given arguments against the
+// running instance, returning the exit status of the process.
+func runCLICommand(name string, args []string) int {
+	cmd := cliCommands[name]
+	jsonOutput := false
+	if name == "now-playing" && len(args) == 1 && args[0] == "--json" {
+		jsonOutput = true
+		args = nil
+	}
+	if len(args) != cmd.nargs {
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s\n", appname, name, cmd.args)
+		return 2
+	}
+
+	result, err := backend.SendIPCCommand(appname, backend.IPCRequest{Command: cmd.ipcCommand, Args: args})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", appname, err.Error())
+		return 1
+	}
+	if name == "now-playing" {
+		if jsonOutput {
+			fmt.Println(string(result))
+		} else {
+			fmt.Println(formatNowPlaying(result))
+		}
+	}
+	return 0
+}
+
+func formatNowPlaying(result json.RawMessage) string {
+	var state struct {
+		State string
+		Track *struct {
+			Title   string
+			Artists []string
+		}
+	}
+	if err := json.Unmarshal(result, &state); err != nil || state.Track == nil {
+		return "Not playing"
+	}
+	s := state.Track.Title
+	if len(state.Track.Artists) > 0 {
+		s = strings.Join(state.Track.Artists, ", ") + " - " + s
+	}
+	if state.State == "paused" {
+		s += " (paused)"
+	}
+	return s
+}
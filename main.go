@@ -3,7 +3,9 @@ package main
 import (
 	"log"
 	"math"
+	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/dweymouth/supersonic/backend"
@@ -24,7 +26,13 @@ const (
 )
 
 func main() {
-	myApp, err := backend.StartupApp(appname, displayName, appVersionTag, configFile, latestReleaseURL)
+	if len(os.Args) > 1 {
+		if _, ok := cliCommands[os.Args[1]]; ok {
+			os.Exit(runCLICommand(os.Args[1], os.Args[2:]))
+		}
+	}
+
+	myApp, err := backend.StartupApp(appname, displayName, appVersionTag, configFile, latestReleaseURL, deepLinkArg())
 	if err != nil {
 		log.Fatalf("fatal startup error: %v", err.Error())
 	}
@@ -42,6 +50,7 @@ func main() {
 	}
 	mainWindow := ui.NewMainWindow(fyneApp, appname, displayName, appVersion, myApp, fyne.NewSize(w, h))
 	myApp.OnReactivate = mainWindow.Show
+	myApp.OnOpenDeepLink = mainWindow.Controller.OpenDeepLink
 	myApp.OnExit = func() {
 		saveWindowSize(myApp.Config, mainWindow.Window)
 		fyneApp.Quit()
@@ -80,6 +89,17 @@ func main() {
 	myApp.Shutdown()
 }
 
+// Returns the supersonic:// link passed on the command line, if any,
+// eg. by the desktop environment's URL scheme handler.
+func deepLinkArg() string {
+	for _, arg := range os.Args[1:] {
+		if strings.HasPrefix(strings.ToLower(arg), backend.DeepLinkScheme+"://") {
+			return arg
+		}
+	}
+	return ""
+}
+
 func saveWindowSize(config *backend.Config, window fyne.Window) {
 	// round sizes to even to avoid Wayland issues with 2x scaling factor
 	// https://github.com/dweymouth/supersonic/issues/212
@@ -0,0 +1,51 @@
+package player
+
+// BasePlayer is the interface of a player which manages a play queue
+// of URLs, and reports playback status changes via callbacks.
+// It is implemented by the mpv-backed Player, and by FakePlayer for tests.
+type BasePlayer interface {
+	// Play queue
+	AppendFile(url string) error
+	RemoveTrackAt(idx int) error
+	MoveTrack(from, to int) error
+	ClearPlayQueue() error
+
+	// Transport
+	PlayFromBeginning() error
+	PlayTrackAt(idx int) error
+	PlayPause() error
+	Pause() error
+	Continue() error
+	Stop() error
+	Seek(target string, mode SeekMode) error
+	SeekBackOrPrevious() error
+	SeekNext() error
+
+	// Status
+	GetStatus() Status
+	IsSeeking() bool
+
+	// Playback options
+	GetLoopMode() LoopMode
+	SetLoopMode(mode LoopMode) error
+	SetNextLoopMode() error
+	GetVolume() int
+	SetVolume(vol int) error
+	GetSpeed() float64
+	SetSpeed(speed float64) error
+	GetABLoop() (a, b float64)
+	SetABLoop(a, b float64) error
+	SetReplayGainOptions(options ReplayGainOptions) error
+	SetReplayGainFallback(gain float64) error
+	SetCrossfadeFilter(f func(fromIdx, toIdx int64) bool)
+	SetPauseAtEndOfTrack(pause bool) error
+
+	// Callbacks
+	OnPaused(cb func())
+	OnStopped(cb func())
+	OnPlaying(cb func())
+	OnSeek(cb func())
+	OnTrackChange(cb func(int64))
+}
+
+var _ BasePlayer = (*Player)(nil)
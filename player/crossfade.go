@@ -0,0 +1,367 @@
+package player
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dweymouth/go-mpv"
+)
+
+// Crossfading is implemented with a second mpv instance, the "fader".
+// Shortly before the crossfade point, the end of the currently playing track
+// is dumped from the main player's demuxer cache to a temporary file, which
+// the fader loads, paused. When the main player reaches the crossfade point,
+// the fader plays the end of the outgoing track, fading out, while the main
+// player advances to the next track, fading in. Both fades are done by afade
+// filters. If the end of the track isn't cached, it is played gaplessly
+// rather than streamed a second time from the server.
+//
+// Rather than polling the playback position, the steps of the crossfade are
+// scheduled with timers, which are reset by the mpv events for seeks and
+// track changes, and by pausing and changing the playback speed.
+
+const (
+	// how long before the crossfade point the fader loads the outgoing track
+	crossfadePreloadSecs = 5.0
+	// how late the crossfade may start before the track is played through instead
+	crossfadeMaxLateSecs = 1.0
+)
+
+// properties copied from the main player to the fader so both sound the same
+// (the audio filters are set separately, without the visualizer tap)
+var faderMirroredProperties = []string{"audio-device", "replaygain", "replaygain-preamp", "replaygain-clip", "replaygain-fallback", "speed"}
+
+type crossfader struct {
+	mutex sync.Mutex
+	fader *mpv.Mpv
+	// closed when the fader has shut down
+	faderDone chan struct{}
+	// the temporary file the end of the outgoing track is dumped to
+	dumpFile string
+
+	// fires at the next step of the crossfade (preparing or starting it)
+	timer *time.Timer
+	// fires at the end of the crossfade in progress
+	endTimer *time.Timer
+
+	// playlist pos of the track the fader has been prepared for, or -1
+	preparedPos int64
+	fading      bool
+	// the afade filter for the incoming track, applied when it loads
+	fadeIn string
+}
+
+// Sets the duration, in seconds, of the crossfade between tracks.
+// Zero disables crossfading.
+// Unlike most Player functions, SetCrossfadeDuration can be called
+// before Init, to set the initial crossfade duration on startup.
+func (p *Player) SetCrossfadeDuration(secs float64) {
+	if secs < 0 {
+		secs = 0
+	}
+	p.crossfadeSecs = secs
+	p.cancelCrossfade()
+	p.scheduleCrossfade()
+}
+
+// Gets the duration, in seconds, of the crossfade between tracks.
+func (p *Player) CrossfadeDuration() float64 {
+	return p.crossfadeSecs
+}
+
+// Sets a func which is consulted before crossfading from the track at one
+// playlist position to the next. If it returns false, the tracks are played
+// gaplessly instead. If nil, every transition between tracks is crossfaded.
+func (p *Player) SetCrossfadeFilter(f func(fromIdx, toIdx int64) bool) {
+	p.crossfadeFilter = f
+}
+
+// Schedules the next step of the crossfade from the current track,
+// based on the current playback position. Called whenever the position
+// jumps or the rate at which it advances changes.
+func (p *Player) scheduleCrossfade() {
+	x := &p.xfade
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	p.scheduleCrossfadeLocked()
+}
+
+func (p *Player) scheduleCrossfadeLocked() {
+	x := &p.xfade
+	if x.timer != nil {
+		x.timer.Stop()
+		x.timer = nil
+	}
+	// the fader can't share the audio device with an exclusive main player,
+	// and crossfading would cut an A-B loop short or skip the pause at the end of the track
+	if !p.initialized || p.crossfadeSecs <= 0 || p.audioExclusive || p.abLoopA >= 0 || p.pauseAtEnd ||
+		p.status.State != Playing || x.fading {
+		return
+	}
+	plPos, timePos, fadeStart, ok := p.crossfadePoint()
+	if !ok {
+		return
+	}
+	if x.preparedPos == plPos {
+		x.timer = time.AfterFunc(p.untilTimePos(timePos, fadeStart), p.startCrossfade)
+		return
+	}
+	if timePos >= fadeStart {
+		// seeked into the crossfade window; just play through
+		return
+	}
+	x.timer = time.AfterFunc(p.untilTimePos(timePos, fadeStart-crossfadePreloadSecs), p.prepareCrossfade)
+}
+
+// Returns the current playlist position and playback time, and the time
+// at which the crossfade from the current track should start.
+func (p *Player) crossfadePoint() (plPos int64, timePos, fadeStart float64, ok bool) {
+	plPos, err := p.getInt64Property("playlist-pos")
+	if err != nil || plPos < 0 {
+		return 0, 0, 0, false
+	}
+	pos, err1 := p.mpv.GetProperty("playback-time", mpv.FORMAT_DOUBLE)
+	dur, err2 := p.mpv.GetProperty("duration", mpv.FORMAT_DOUBLE)
+	if err1 != nil || err2 != nil || pos == nil || dur == nil {
+		return 0, 0, 0, false
+	}
+	duration := dur.(float64)
+	// don't crossfade very short tracks
+	if duration < 3*p.crossfadeSecs {
+		return 0, 0, 0, false
+	}
+	return plPos, pos.(float64), duration - p.crossfadeSecs, true
+}
+
+// Returns the wall clock time until playback reaches the given time.
+func (p *Player) untilTimePos(now, target float64) time.Duration {
+	if target <= now {
+		return 0
+	}
+	return time.Duration((target - now) / p.speed * float64(time.Second))
+}
+
+// Loads the end of the current track into the fader.
+func (p *Player) prepareCrossfade() {
+	x := &p.xfade
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if p.status.State != Playing || x.fading {
+		return
+	}
+	plPos, _, fadeStart, ok := p.crossfadePoint()
+	if !ok {
+		return
+	}
+	// not retried until the track changes or playback is seeked
+	x.preparedPos = -1
+	next, ok := p.nextPlaylistPos(plPos)
+	if !ok || (p.crossfadeFilter != nil && !p.crossfadeFilter(plPos, next)) || !p.trackEndCached() {
+		return
+	}
+	if err := p.prepareFader(fadeStart); err != nil {
+		log.Printf("error preparing crossfade: %s", err.Error())
+		return
+	}
+	x.preparedPos = plPos
+	p.scheduleCrossfadeLocked()
+}
+
+// Returns true if the rest of the current track has been read into the
+// demuxer cache, so that it can be dumped for the fader.
+func (p *Player) trackEndCached() bool {
+	n, err := p.mpv.GetProperty("demuxer-cache-state", mpv.FORMAT_NODE)
+	if err != nil || n == nil {
+		return false
+	}
+	state, ok := n.(*mpv.Node).Data.(map[string]*mpv.Node)
+	if !ok {
+		return false
+	}
+	eof, ok := state["eof-cached"]
+	return ok && eof.Data == true
+}
+
+// Starts the crossfade from the current track, if it has reached the crossfade point.
+func (p *Player) startCrossfade() {
+	x := &p.xfade
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if p.status.State != Playing || x.fading {
+		return
+	}
+	plPos, timePos, fadeStart, ok := p.crossfadePoint()
+	if !ok || plPos != x.preparedPos {
+		return
+	}
+	if timePos < fadeStart-0.05 {
+		// timer fired early
+		p.scheduleCrossfadeLocked()
+		return
+	}
+	if _, ok := p.nextPlaylistPos(plPos); !ok || timePos > fadeStart+crossfadeMaxLateSecs {
+		x.preparedPos = -1
+		x.fader.Command([]string{"stop"})
+		return
+	}
+
+	x.fading = true
+	x.fadeIn = fmt.Sprintf("afade=t=in:d=%0.3f", p.crossfadeSecs)
+	x.fader.SetPropertyString("pause", "no")
+	if err := p.mpv.Command([]string{"playlist-next"}); err != nil {
+		log.Printf("error starting crossfade: %s", err.Error())
+	}
+	x.endTimer = time.AfterFunc(p.untilTimePos(0, p.crossfadeSecs), p.endCrossfade)
+}
+
+// Called when a file has been loaded by the main player, to fade in
+// the incoming track if a crossfade has just begun.
+func (p *Player) crossfadeOnFileLoaded() {
+	x := &p.xfade
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.fadeIn == "" {
+		return
+	}
+	af := x.fadeIn
+	if p.audioFilters != "" {
+		af += "," + p.audioFilters
+	}
+	x.fadeIn = ""
+	// mpv restores the regular filter chain when the file ends
+	if err := p.mpv.SetPropertyString("file-local-options/af", af); err != nil {
+		log.Printf("error fading in track: %s", err.Error())
+	}
+}
+
+func (p *Player) endCrossfade() {
+	x := &p.xfade
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	p.stopFader()
+	p.scheduleCrossfadeLocked()
+}
+
+// Returns the playlist position that will play after the given one, if any.
+func (p *Player) nextPlaylistPos(pos int64) (int64, bool) {
+	if p.loopMode == LoopOne {
+		return 0, false
+	}
+	count, err := p.getInt64Property("playlist-count")
+	if err != nil {
+		return 0, false
+	}
+	if pos+1 < count {
+		return pos + 1, true
+	}
+	if p.loopMode == LoopAll && count > 1 {
+		return 0, true
+	}
+	return 0, false
+}
+
+// Dumps the current track from the given time to its end into a temporary file,
+// and loads it into the fader, paused. Must be called with the crossfader mutex held.
+func (p *Player) prepareFader(start float64) error {
+	x := &p.xfade
+	if x.fader == nil {
+		f := mpv.Create()
+		f.SetOptionString("idle", "yes")
+		f.SetOptionString("video", "no")
+		f.SetOptionString("audio-display", "no")
+		f.SetOptionString("terminal", "no")
+		if p.clientName != "" {
+			f.SetOptionString("audio-client-name", p.clientName)
+		}
+		if err := f.Initialize(); err != nil {
+			return fmt.Errorf("error initializing mpv: %s", err.Error())
+		}
+		// events are unused, but must be consumed
+		done := make(chan struct{})
+		go func() {
+			for f.WaitEvent(1 /*timeout seconds*/).Event_Id != mpv.EVENT_SHUTDOWN {
+			}
+			close(done)
+		}()
+		x.fader = f
+		x.faderDone = done
+		// Matroska can hold any audio codec; mpv picks the format by file extension
+		x.dumpFile = filepath.Join(os.TempDir(), fmt.Sprintf("mpv-crossfade-%d.mka", os.Getpid()))
+	}
+
+	x.fader.Command([]string{"stop"})
+	startArg := fmt.Sprintf("%0.3f", start)
+	if err := p.mpv.Command([]string{"dump-cache", startArg, "no", x.dumpFile}); err != nil {
+		return fmt.Errorf("error dumping cache: %s", err.Error())
+	}
+
+	for _, prop := range faderMirroredProperties {
+		x.fader.SetPropertyString(prop, p.mpv.GetPropertyString(prop))
+	}
+	af := fmt.Sprintf("afade=t=out:d=%0.3f", p.crossfadeSecs)
+	if pf := p.playbackFilters(); pf != "" {
+		af = pf + "," + af
+	}
+	x.fader.SetPropertyString("af", af)
+	x.fader.SetProperty("volume", mpv.FORMAT_INT64, p.vol)
+	x.fader.SetPropertyString("pause", "yes")
+	return x.fader.Command([]string{"loadfile", x.dumpFile, "replace"})
+}
+
+// Sets the volume of the fader, if it is playing, along with the main player.
+func (p *Player) setFaderVolume(vol int) {
+	x := &p.xfade
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.fading {
+		x.fader.SetProperty("volume", mpv.FORMAT_INT64, vol)
+	}
+}
+
+// Must be called with the crossfader mutex held.
+func (p *Player) stopFader() {
+	x := &p.xfade
+	x.preparedPos = -1
+	x.fading = false
+	x.fadeIn = ""
+	if x.endTimer != nil {
+		x.endTimer.Stop()
+		x.endTimer = nil
+	}
+	if x.fader != nil {
+		x.fader.Command([]string{"stop"})
+	}
+}
+
+// Cancels any crossfade scheduled or in progress.
+func (p *Player) cancelCrossfade() {
+	x := &p.xfade
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.timer != nil {
+		x.timer.Stop()
+		x.timer = nil
+	}
+	p.stopFader()
+}
+
+func (p *Player) destroyFader() {
+	p.cancelCrossfade()
+	x := &p.xfade
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.fader != nil {
+		x.fader.Command([]string{"quit"})
+		select {
+		case <-x.faderDone:
+		case <-time.After(time.Second):
+		}
+		x.fader.TerminateDestroy()
+		x.fader = nil
+		os.Remove(x.dumpFile)
+	}
+}
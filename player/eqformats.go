@@ -0,0 +1,306 @@
+package player
+
+// Import and export of equalizer settings in the text formats used by
+// EqualizerAPO and AutoEQ: "ParametricEQ.txt" filter lists and "GraphicEQ" curves.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sample rate used for computing the frequency response of filters
+const responseSampleRate = 48000.0
+
+// Q of the peaking filters used when converting a GraphicEQ
+// curve to a parametric equalizer (2/3 octave bandwidth)
+const graphicEQConversionQ = 2.145
+
+var ErrNoEqualizerFilters = errors.New("no equalizer filters found")
+
+// A graphic EQ curve, as a list of frequency/gain points sorted by frequency.
+type GraphicEQ []GraphicEQPoint
+
+type GraphicEQPoint struct {
+	Frequency float64
+	Gain      float64
+}
+
+// Parses the EqualizerAPO parametric filter format, as in AutoEQ's ParametricEQ.txt:
+//
+//	Preamp: -6.2 dB
+//	Filter 1: ON LSC Fc 105 Hz Gain 6.5 dB Q 0.70
+//	Filter 2: ON PK Fc 2000 Hz Gain -3.0 dB Q 2.00
+//
+// Peaking (PK, PEQ), low shelf (LSC, LS) and high shelf (HSC, HS) filters are supported.
+// Disabled filters and unsupported lines are ignored.
+func ParseEqualizerAPO(text string) (*ParametricEqualizer, error) {
+	eq := &ParametricEqualizer{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		switch {
+		case strings.EqualFold(name, "Preamp"):
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("invalid preamp line: %q", line)
+			}
+			g, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid preamp line: %q", line)
+			}
+			eq.EQPreamp = g
+		case strings.HasPrefix(strings.ToLower(name), "filter"):
+			band, ok, err := parseAPOFilter(fields)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter line: %q", line)
+			}
+			if ok {
+				eq.Bands = append(eq.Bands, band)
+			}
+		}
+	}
+	if len(eq.Bands) == 0 {
+		return nil, ErrNoEqualizerFilters
+	}
+	return eq, nil
+}
+
+// parses the fields of a filter line after the colon.
+// returns false if the filter is disabled or of an unsupported type.
+func parseAPOFilter(fields []string) (ParametricEQBand, bool, error) {
+	band := ParametricEQBand{Q: 0.707}
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "ON") {
+		return band, false, nil
+	}
+	switch strings.ToUpper(fields[1]) {
+	case "PK", "PEQ":
+		band.Type = FilterTypePeak
+	case "LSC", "LS":
+		band.Type = FilterTypeLowShelf
+	case "HSC", "HS":
+		band.Type = FilterTypeHighShelf
+	default:
+		return band, false, nil
+	}
+	haveFreq := false
+	for i := 2; i+1 < len(fields); i++ {
+		val, err := strconv.ParseFloat(fields[i+1], 64)
+		switch strings.ToLower(fields[i]) {
+		case "fc":
+			if err != nil {
+				return band, false, err
+			}
+			band.Frequency = int(math.Round(val))
+			haveFreq = true
+		case "gain":
+			if err != nil {
+				return band, false, err
+			}
+			band.Gain = val
+		case "q":
+			if err != nil {
+				return band, false, err
+			}
+			band.Q = val
+		default:
+			continue
+		}
+		i++
+	}
+	if !haveFreq {
+		return band, false, errors.New("missing filter frequency")
+	}
+	return band, true, nil
+}
+
+// Parses the EqualizerAPO GraphicEQ format, as in AutoEQ's GraphicEQ.txt:
+//
+//	GraphicEQ: 20 -6.3; 21 -6.3; 22 -6.4; ...
+func ParseGraphicEQ(text string) (GraphicEQ, error) {
+	var geq GraphicEQ
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(name, "GraphicEQ") {
+			continue
+		}
+		for _, pt := range strings.Split(rest, ";") {
+			fields := strings.Fields(pt)
+			if len(fields) == 0 {
+				continue
+			}
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("invalid GraphicEQ point: %q", pt)
+			}
+			f, err1 := strconv.ParseFloat(fields[0], 64)
+			g, err2 := strconv.ParseFloat(fields[1], 64)
+			if err1 != nil || err2 != nil || f <= 0 {
+				return nil, fmt.Errorf("invalid GraphicEQ point: %q", pt)
+			}
+			geq = append(geq, GraphicEQPoint{Frequency: f, Gain: g})
+		}
+	}
+	if len(geq) == 0 {
+		return nil, ErrNoEqualizerFilters
+	}
+	sort.Slice(geq, func(i, j int) bool { return geq[i].Frequency < geq[j].Frequency })
+	return geq, nil
+}
+
+// Returns the gain of the curve at the given frequency,
+// interpolating linearly on a log frequency scale.
+func (g GraphicEQ) Gain(hz float64) float64 {
+	if len(g) == 0 {
+		return 0
+	}
+	if hz <= g[0].Frequency {
+		return g[0].Gain
+	}
+	for i := 1; i < len(g); i++ {
+		if hz <= g[i].Frequency {
+			lo, hi := g[i-1], g[i]
+			t := math.Log(hz/lo.Frequency) / math.Log(hi.Frequency/lo.Frequency)
+			return lo.Gain + t*(hi.Gain-lo.Gain)
+		}
+	}
+	return g[len(g)-1].Gain
+}
+
+// Returns a graphic equalizer approximating the given frequency response
+// by setting each band to the response at its center frequency,
+// limited to the +/-12 dB range of the graphic equalizer UI.
+func NewISO15BandEqualizerFromResponse(preamp float64, response func(hz float64) float64) *ISO15BandEqualizer {
+	eq := &ISO15BandEqualizer{EQPreamp: preamp}
+	for i, band := range eq.Curve() {
+		g := math.Round(response(float64(band.Frequency))*10) / 10
+		eq.BandGains[i] = math.Max(-12, math.Min(12, g))
+	}
+	return eq
+}
+
+// Returns a parametric equalizer approximating the given frequency
+// response with peaking filters at the graphic equalizer band frequencies.
+func NewParametricEqualizerFromResponse(preamp float64, response func(hz float64) float64) *ParametricEqualizer {
+	eq := &ParametricEqualizer{EQPreamp: preamp}
+	for _, band := range (&ISO15BandEqualizer{}).Curve() {
+		eq.Bands = append(eq.Bands, ParametricEQBand{
+			Type:      FilterTypePeak,
+			Frequency: band.Frequency,
+			Gain:      math.Round(response(float64(band.Frequency))*10) / 10,
+			Q:         graphicEQConversionQ,
+		})
+	}
+	return eq
+}
+
+// Formats the equalizer in the EqualizerAPO parametric filter format.
+func FormatEqualizerAPO(eq Equalizer) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Preamp: %0.1f dB\n", eq.Preamp())
+	n := 0
+	for _, band := range eq.Curve() {
+		if band.String() == "" {
+			continue // no gain
+		}
+		typ := "PK"
+		switch band.Type {
+		case FilterTypeLowShelf:
+			typ = "LSC"
+		case FilterTypeHighShelf:
+			typ = "HSC"
+		}
+		n++
+		fmt.Fprintf(&sb, "Filter %d: ON %s Fc %d Hz Gain %0.1f dB Q %0.2f\n",
+			n, typ, band.Frequency, band.Gain, band.Q())
+	}
+	return sb.String()
+}
+
+// Formats the frequency response of the equalizer, including the preamp,
+// in the EqualizerAPO GraphicEQ format, at 1/12 octave intervals.
+func FormatGraphicEQ(eq Equalizer) string {
+	curve := eq.Curve()
+	var sb strings.Builder
+	sb.WriteString("GraphicEQ:")
+	for i := 0; ; i++ {
+		hz := 20 * math.Pow(2, float64(i)/12)
+		if hz > 20000 {
+			break
+		}
+		if i > 0 {
+			sb.WriteString(";")
+		}
+		fmt.Fprintf(&sb, " %d %0.1f", int(math.Round(hz)), eq.Preamp()+curve.Response(hz))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Returns the gain, in dB, of the combined filters of the curve at the given frequency.
+func (e EqualizerCurve) Response(hz float64) float64 {
+	g := 0.0
+	for _, band := range e {
+		g += band.Response(hz)
+	}
+	return g
+}
+
+// Returns the gain, in dB, of the band's filter at the given frequency.
+func (e EqualizerBand) Response(hz float64) float64 {
+	if e.Gain == 0 {
+		return 0
+	}
+	b, a := e.biquadCoefficients(responseSampleRate)
+	z := cmplx.Exp(complex(0, -2*math.Pi*hz/responseSampleRate)) // z^-1
+	num := complex(b[0], 0) + complex(b[1], 0)*z + complex(b[2], 0)*z*z
+	den := complex(a[0], 0) + complex(a[1], 0)*z + complex(a[2], 0)*z*z
+	return 20 * math.Log10(cmplx.Abs(num/den))
+}
+
+// Returns the band's width as a Q factor.
+func (e EqualizerBand) Q() float64 {
+	switch e.WidthType {
+	case WidthTypeOctave:
+		return 1 / (2 * math.Sinh(math.Ln2/2*e.Width))
+	case WidthTypeHz:
+		return float64(e.Frequency) / e.Width
+	case WidthTypeKhz:
+		return float64(e.Frequency) / (e.Width * 1000)
+	case WidthTypeSlope:
+		// shelf slope S to Q, for the band's gain
+		A := math.Pow(10, e.Gain/40)
+		return 1 / math.Sqrt((A+1/A)*(1/e.Width-1)+2)
+	}
+	return e.Width
+}
+
+// Returns the filter coefficients, from the Audio EQ Cookbook (as used by ffmpeg).
+func (e EqualizerBand) biquadCoefficients(sampleRate float64) (b, a [3]float64) {
+	A := math.Pow(10, e.Gain/40)
+	w0 := 2 * math.Pi * float64(e.Frequency) / sampleRate
+	cos := math.Cos(w0)
+	alpha := math.Sin(w0) / (2 * e.Q())
+	sqA := 2 * math.Sqrt(A) * alpha
+	switch e.Type {
+	case FilterTypeLowShelf:
+		b = [3]float64{A * ((A + 1) - (A-1)*cos + sqA), 2 * A * ((A - 1) - (A+1)*cos), A * ((A + 1) - (A-1)*cos - sqA)}
+		a = [3]float64{(A + 1) + (A-1)*cos + sqA, -2 * ((A - 1) + (A+1)*cos), (A + 1) + (A-1)*cos - sqA}
+	case FilterTypeHighShelf:
+		b = [3]float64{A * ((A + 1) + (A-1)*cos + sqA), -2 * A * ((A - 1) + (A+1)*cos), A * ((A + 1) + (A-1)*cos - sqA)}
+		a = [3]float64{(A + 1) - (A-1)*cos + sqA, 2 * ((A - 1) - (A+1)*cos), (A + 1) - (A-1)*cos - sqA}
+	default:
+		b = [3]float64{1 + alpha*A, -2 * cos, 1 - alpha*A}
+		a = [3]float64{1 + alpha/A, -2 * cos, 1 - alpha/A}
+	}
+	return b, a
+}
@@ -1,10 +1,12 @@
 package player
 
-// Equalizer implementations based on the ffmpeg 'equalizer' filter
+// Equalizer implementations based on the ffmpeg 'equalizer',
+// 'lowshelf' and 'highshelf' filters
 
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 )
 
@@ -63,6 +65,105 @@ func (*ISO15BandEqualizer) Type() string {
 	return "ISO15Band"
 }
 
+// A parametric equalizer with any number of bands,
+// each with its own filter type, frequency, gain and Q.
+type ParametricEqualizer struct {
+	Disabled bool
+	EQPreamp float64
+	Bands    []ParametricEQBand
+}
+
+type ParametricEQBand struct {
+	Type      FilterType
+	Frequency int
+	Gain      float64
+	Q         float64
+}
+
+// Limits of the parametric equalizer band parameters
+const (
+	ParametricEQMinFrequency = 20
+	ParametricEQMaxFrequency = 20000
+	ParametricEQMinQ         = 0.1
+	ParametricEQMaxQ         = 10.0
+	ParametricEQMaxGain      = 24.0
+)
+
+var _ Equalizer = (*ParametricEqualizer)(nil)
+
+func (p *ParametricEqualizer) IsEnabled() bool {
+	return !p.Disabled
+}
+
+func (p *ParametricEqualizer) Preamp() float64 {
+	return p.EQPreamp
+}
+
+func (p *ParametricEqualizer) Curve() EqualizerCurve {
+	curve := make([]EqualizerBand, 0, len(p.Bands))
+	for _, band := range p.Bands {
+		curve = append(curve, EqualizerBand{
+			Type:      band.Type,
+			Frequency: clampInt(band.Frequency, ParametricEQMinFrequency, ParametricEQMaxFrequency),
+			Width:     math.Max(ParametricEQMinQ, math.Min(ParametricEQMaxQ, band.Q)),
+			WidthType: WidthTypeQ,
+			Gain:      math.Max(-ParametricEQMaxGain, math.Min(ParametricEQMaxGain, band.Gain)),
+		})
+	}
+	return curve
+}
+
+func (p *ParametricEqualizer) BandFrequencies() []string {
+	ret := make([]string, len(p.Bands))
+	for i, band := range p.Bands {
+		ret[i] = FormatFrequency(band.Frequency)
+	}
+	return ret
+}
+
+func (*ParametricEqualizer) Type() string {
+	return "Parametric"
+}
+
+// Formats a frequency in Hz for display, eg "63", "1.6k", "10k"
+func FormatFrequency(hz int) string {
+	if hz < 1000 {
+		return strconv.Itoa(hz)
+	}
+	return strconv.FormatFloat(math.Round(float64(hz)/100)/10, 'f', -1, 64) + "k"
+}
+
+func clampInt(i, min, max int) int {
+	if i < min {
+		return min
+	}
+	if i > max {
+		return max
+	}
+	return i
+}
+
+// The type of filter applied for an equalizer band.
+// The zero value is a peaking filter.
+type FilterType string
+
+const (
+	FilterTypePeak      FilterType = "peak"
+	FilterTypeLowShelf  FilterType = "lowshelf"
+	FilterTypeHighShelf FilterType = "highshelf"
+)
+
+// Returns the name of the ffmpeg filter for the filter type.
+func (f FilterType) ffmpegFilter() string {
+	switch f {
+	case FilterTypeLowShelf:
+		return "lowshelf"
+	case FilterTypeHighShelf:
+		return "highshelf"
+	}
+	return "equalizer"
+}
+
 type WidthType int
 
 const (
@@ -74,6 +175,7 @@ const (
 )
 
 type EqualizerBand struct {
+	Type      FilterType
 	Frequency int
 	Gain      float64
 	Width     float64
@@ -101,8 +203,8 @@ func (e EqualizerBand) String() string {
 	if math.Abs(e.Gain) < 0.02 {
 		return ""
 	}
-	return fmt.Sprintf("equalizer=f=%d:g=%0.2f:t=%s:w=%0.2f",
-		e.Frequency, e.Gain, e.WidthType.String(), e.Width)
+	return fmt.Sprintf("%s=f=%d:g=%0.2f:t=%s:w=%0.2f",
+		e.Type.ffmpegFilter(), e.Frequency, e.Gain, e.WidthType.String(), e.Width)
 }
 
 func (w WidthType) String() string {
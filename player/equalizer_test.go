@@ -0,0 +1,98 @@
+package player
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_ParametricEqualizerCurve(t *testing.T) {
+	eq := &ParametricEqualizer{
+		Bands: []ParametricEQBand{
+			{Type: FilterTypeLowShelf, Frequency: 105, Gain: 6.5, Q: 0.7},
+			{Frequency: 2000, Gain: -3, Q: 2},
+			{Type: FilterTypeHighShelf, Frequency: 30000, Gain: 30, Q: 0},
+			{Frequency: 500, Gain: 0, Q: 1}, // omitted
+		},
+	}
+	want := "lowshelf=f=105:g=6.50:t=q:w=0.70," +
+		"equalizer=f=2000:g=-3.00:t=q:w=2.00," +
+		"highshelf=f=20000:g=24.00:t=q:w=0.10"
+	if got := eq.Curve().String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func Test_FormatFrequency(t *testing.T) {
+	for hz, want := range map[int]string{63: "63", 1000: "1k", 1600: "1.6k", 12500: "12.5k"} {
+		if got := FormatFrequency(hz); got != want {
+			t.Errorf("FormatFrequency(%d) = %q, want %q", hz, got, want)
+		}
+	}
+}
+
+func Test_ParseEqualizerAPO(t *testing.T) {
+	text := `Preamp: -6.2 dB
+Filter 1: ON LSC Fc 105 Hz Gain 6.5 dB Q 0.70
+Filter 2: ON PK Fc 2000 Hz Gain -3.0 dB Q 2.00
+Filter 3: OFF PK Fc 5000 Hz Gain 4.0 dB Q 1.00
+`
+	eq, err := ParseEqualizerAPO(text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ParametricEqualizer{
+		EQPreamp: -6.2,
+		Bands: []ParametricEQBand{
+			{Type: FilterTypeLowShelf, Frequency: 105, Gain: 6.5, Q: 0.7},
+			{Type: FilterTypePeak, Frequency: 2000, Gain: -3, Q: 2},
+		},
+	}
+	if eq.EQPreamp != want.EQPreamp || len(eq.Bands) != len(want.Bands) {
+		t.Fatalf("got %+v, want %+v", *eq, want)
+	}
+	for i := range want.Bands {
+		if eq.Bands[i] != want.Bands[i] {
+			t.Errorf("band %d: got %+v, want %+v", i, eq.Bands[i], want.Bands[i])
+		}
+	}
+
+	// round trip
+	eq2, err := ParseEqualizerAPO(FormatEqualizerAPO(eq))
+	if err != nil || eq2.EQPreamp != eq.EQPreamp || len(eq2.Bands) != 2 || eq2.Bands[1] != eq.Bands[1] {
+		t.Errorf("round trip failed: got %+v, %v", eq2, err)
+	}
+
+	if _, err := ParseEqualizerAPO("GraphicEQ: 20 -1; 20000 1"); err != ErrNoEqualizerFilters {
+		t.Errorf("expected ErrNoEqualizerFilters, got %v", err)
+	}
+}
+
+func Test_GraphicEQ(t *testing.T) {
+	geq, err := ParseGraphicEQ("GraphicEQ: 20 -6; 2000 6; 200 0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for hz, want := range map[float64]float64{10: -6, 20: -6, 63.2456: -3, 200: 0, 20000: 6} {
+		if got := geq.Gain(hz); math.Abs(got-want) > 0.01 {
+			t.Errorf("Gain(%g) = %g, want %g", hz, got, want)
+		}
+	}
+}
+
+func Test_EqualizerBandResponse(t *testing.T) {
+	for _, band := range []EqualizerBand{
+		{Type: FilterTypePeak, Frequency: 1000, Gain: 6, Width: 1, WidthType: WidthTypeQ},
+		{Type: FilterTypePeak, Frequency: 250, Gain: -4, Width: 2. / 3, WidthType: WidthTypeOctave},
+	} {
+		if got := band.Response(float64(band.Frequency)); math.Abs(got-band.Gain) > 0.05 {
+			t.Errorf("%v: response at center = %g, want %g", band, got, band.Gain)
+		}
+		if got := band.Response(float64(band.Frequency) * 16); math.Abs(got) > 0.5 {
+			t.Errorf("%v: response far from center = %g, want ~0", band, got)
+		}
+	}
+	shelf := EqualizerBand{Type: FilterTypeLowShelf, Frequency: 100, Gain: 6, Width: 0.7, WidthType: WidthTypeQ}
+	if lo, hi := shelf.Response(20), shelf.Response(5000); math.Abs(lo-6) > 0.5 || math.Abs(hi) > 0.2 {
+		t.Errorf("low shelf response: got %g at 20 Hz, %g at 5 kHz", lo, hi)
+	}
+}
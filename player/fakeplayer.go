@@ -0,0 +1,404 @@
+package player
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var errFakeIndexOutOfRange = errors.New("playlist index out of range")
+
+// Duration, in seconds, of each track played by a FakePlayer
+// unless changed with SetTrackDuration.
+const FakePlayerDefaultDuration = 180.0
+
+// FakePlayer is an in-memory BasePlayer which doesn't play any audio,
+// for testing code that controls a player.
+//
+// As with the mpv-backed Player, state changes caused by a call to a
+// FakePlayer function invoke the OnPlaying/OnPaused/OnStopped callbacks
+// immediately, while track changes and seeks are reported asynchronously:
+// their callbacks are invoked by the next call to ProcessEvents or AdvanceTime.
+type FakePlayer struct {
+	playlist  []string
+	durations map[string]float64
+	status    Status
+	loopMode  LoopMode
+	vol       int
+	speed     float64
+	abLoopA   float64
+	abLoopB   float64
+	// see SetPauseAtEndOfTrack
+	pauseAtEnd bool
+
+	replayGainOpts  ReplayGainOptions
+	rgFallback      float64
+	crossfadeFilter func(fromIdx, toIdx int64) bool
+
+	pendingEvents []func()
+
+	onPaused      []func()
+	onStopped     []func()
+	onPlaying     []func()
+	onSeek        []func()
+	onTrackChange []func(int64)
+}
+
+var _ BasePlayer = (*FakePlayer)(nil)
+
+func NewFakePlayer() *FakePlayer {
+	return &FakePlayer{
+		durations: make(map[string]float64),
+		vol:       100,
+		speed:     1,
+		abLoopA:   -1,
+		abLoopB:   -1,
+		status:    Status{PlaylistPos: -1},
+	}
+}
+
+// Sets the duration, in seconds, of the track with the given URL.
+func (f *FakePlayer) SetTrackDuration(url string, secs float64) {
+	f.durations[url] = secs
+}
+
+// Returns a copy of the URLs in the play queue.
+func (f *FakePlayer) Playlist() []string {
+	pl := make([]string, len(f.playlist))
+	copy(pl, f.playlist)
+	return pl
+}
+
+// Invokes the callbacks for any track changes and seeks that have happened.
+func (f *FakePlayer) ProcessEvents() {
+	for len(f.pendingEvents) > 0 {
+		evt := f.pendingEvents[0]
+		f.pendingEvents = f.pendingEvents[1:]
+		evt()
+	}
+}
+
+// Advances playback by the given number of seconds if playing,
+// moving on to the next track(s) or stopping at the end of the play queue,
+// and then processes events.
+func (f *FakePlayer) AdvanceTime(secs float64) {
+	f.ProcessEvents()
+	if f.status.State == Playing {
+		f.status.TimePos += secs * f.speed
+		for f.status.State == Playing && f.status.TimePos >= f.status.Duration {
+			f.status.TimePos -= f.status.Duration
+			switch {
+			case f.pauseAtEnd && f.loopMode != LoopOne:
+				f.pauseAtEnd = false
+				f.status.TimePos = 0
+				if f.status.PlaylistPos+1 < int64(len(f.playlist)) {
+					f.setState(Paused)
+					f.loadTrack(f.status.PlaylistPos + 1)
+				} else {
+					f.idle()
+				}
+			case f.loopMode == LoopOne:
+				f.loadTrack(f.status.PlaylistPos)
+			case f.status.PlaylistPos+1 < int64(len(f.playlist)):
+				f.loadTrack(f.status.PlaylistPos + 1)
+			case f.loopMode == LoopAll:
+				f.loadTrack(0)
+			default:
+				f.idle()
+			}
+			f.ProcessEvents()
+		}
+	}
+	f.ProcessEvents()
+}
+
+func (f *FakePlayer) AppendFile(url string) error {
+	f.playlist = append(f.playlist, url)
+	return nil
+}
+
+func (f *FakePlayer) RemoveTrackAt(idx int) error {
+	if idx < 0 || idx >= len(f.playlist) {
+		return errFakeIndexOutOfRange
+	}
+	f.playlist = append(f.playlist[:idx], f.playlist[idx+1:]...)
+	pos := int(f.status.PlaylistPos)
+	switch {
+	case pos < 0 || idx > pos:
+	case idx < pos:
+		f.status.PlaylistPos--
+	case f.status.State == Stopped:
+		f.status.PlaylistPos = -1
+	case idx < len(f.playlist):
+		// mpv moves on to the next track when the current one is removed
+		f.loadTrack(int64(idx))
+	default:
+		f.idle()
+	}
+	return nil
+}
+
+func (f *FakePlayer) MoveTrack(from, to int) error {
+	if from < 0 || from >= len(f.playlist) || to < 0 || to > len(f.playlist) {
+		return errFakeIndexOutOfRange
+	}
+	if to > from {
+		to-- // the index of the target after the item is removed
+	}
+	url := f.playlist[from]
+	f.playlist = append(f.playlist[:from], f.playlist[from+1:]...)
+	f.playlist = append(f.playlist[:to], append([]string{url}, f.playlist[to:]...)...)
+	switch pos := int(f.status.PlaylistPos); {
+	case pos < 0:
+	case pos == from:
+		f.status.PlaylistPos = int64(to)
+	case from < pos && to >= pos:
+		f.status.PlaylistPos--
+	case from > pos && to <= pos:
+		f.status.PlaylistPos++
+	}
+	return nil
+}
+
+// Clears the play queue, except for the currently playing file.
+func (f *FakePlayer) ClearPlayQueue() error {
+	if f.status.State == Stopped || f.status.PlaylistPos < 0 {
+		f.playlist = nil
+		f.status.PlaylistPos = -1
+		return nil
+	}
+	f.playlist = []string{f.playlist[f.status.PlaylistPos]}
+	f.status.PlaylistPos = 0
+	return nil
+}
+
+func (f *FakePlayer) PlayFromBeginning() error {
+	return f.PlayTrackAt(0)
+}
+
+func (f *FakePlayer) PlayTrackAt(idx int) error {
+	if idx < 0 || idx >= len(f.playlist) {
+		return errFakeIndexOutOfRange
+	}
+	f.setState(Playing)
+	f.loadTrack(int64(idx))
+	return nil
+}
+
+func (f *FakePlayer) PlayPause() error {
+	switch f.status.State {
+	case Stopped:
+		if len(f.playlist) > 0 {
+			return f.PlayTrackAt(0)
+		}
+		return nil
+	case Playing:
+		return f.Pause()
+	default:
+		return f.Continue()
+	}
+}
+
+func (f *FakePlayer) Pause() error {
+	if f.status.State == Playing {
+		f.setState(Paused)
+	}
+	return nil
+}
+
+func (f *FakePlayer) Continue() error {
+	switch f.status.State {
+	case Paused:
+		f.setState(Playing)
+	case Stopped:
+		return f.PlayFromBeginning()
+	}
+	return nil
+}
+
+// Stops playback and clears the play queue.
+func (f *FakePlayer) Stop() error {
+	f.playlist = nil
+	f.status = Status{State: f.status.State, PlaylistPos: -1}
+	f.setState(Stopped)
+	return nil
+}
+
+func (f *FakePlayer) Seek(target string, mode SeekMode) error {
+	if f.status.State == Stopped {
+		return nil
+	}
+	t, err := strconv.ParseFloat(target, 64)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case SeekRelative:
+		t += f.status.TimePos
+	case SeekAbsolutePercent:
+		t = t / 100 * f.status.Duration
+	case SeekRelativePercent:
+		t = f.status.TimePos + t/100*f.status.Duration
+	}
+	f.status.TimePos = math.Max(0, math.Min(t, f.status.Duration))
+	f.pendingEvents = append(f.pendingEvents, func() {
+		for _, cb := range f.onSeek {
+			cb()
+		}
+	})
+	return nil
+}
+
+func (f *FakePlayer) SeekBackOrPrevious() error {
+	if f.status.TimePos > 3 || f.status.PlaylistPos <= 0 {
+		return f.Seek("0", SeekAbsolute)
+	}
+	f.loadTrack(f.status.PlaylistPos - 1)
+	return nil
+}
+
+func (f *FakePlayer) SeekNext() error {
+	if f.status.PlaylistPos+1 < int64(len(f.playlist)) {
+		f.loadTrack(f.status.PlaylistPos + 1)
+	}
+	return nil
+}
+
+func (f *FakePlayer) GetStatus() Status {
+	return f.status
+}
+
+func (f *FakePlayer) IsSeeking() bool {
+	return false
+}
+
+func (f *FakePlayer) GetLoopMode() LoopMode {
+	return f.loopMode
+}
+
+func (f *FakePlayer) SetLoopMode(mode LoopMode) error {
+	f.loopMode = mode
+	return nil
+}
+
+func (f *FakePlayer) SetNextLoopMode() error {
+	f.loopMode = (f.loopMode + 1) % 3
+	return nil
+}
+
+func (f *FakePlayer) GetVolume() int {
+	return f.vol
+}
+
+func (f *FakePlayer) SetVolume(vol int) error {
+	f.vol = int(math.Max(0, math.Min(100, float64(vol))))
+	return nil
+}
+
+func (f *FakePlayer) GetSpeed() float64 {
+	return f.speed
+}
+
+func (f *FakePlayer) SetSpeed(speed float64) error {
+	f.speed = math.Max(MinSpeed, math.Min(MaxSpeed, speed))
+	return nil
+}
+
+func (f *FakePlayer) GetABLoop() (a, b float64) {
+	return f.abLoopA, f.abLoopB
+}
+
+func (f *FakePlayer) SetABLoop(a, b float64) error {
+	f.abLoopA, f.abLoopB = a, b
+	return nil
+}
+
+func (f *FakePlayer) SetReplayGainOptions(options ReplayGainOptions) error {
+	f.replayGainOpts = options
+	f.rgFallback = 0
+	if options.Mode != ReplayGainNone && options.Mode != ReplayGainDynamic {
+		f.rgFallback = options.FallbackGain
+	}
+	return nil
+}
+
+func (f *FakePlayer) SetReplayGainFallback(gain float64) error {
+	f.rgFallback = gain
+	return nil
+}
+
+// Returns the gain that would be applied to a track without ReplayGain tags.
+func (f *FakePlayer) ReplayGainFallback() float64 {
+	return f.rgFallback
+}
+
+func (f *FakePlayer) SetCrossfadeFilter(filter func(fromIdx, toIdx int64) bool) {
+	f.crossfadeFilter = filter
+}
+
+func (f *FakePlayer) SetPauseAtEndOfTrack(pause bool) error {
+	f.pauseAtEnd = pause
+	return nil
+}
+
+func (f *FakePlayer) OnPaused(cb func()) {
+	f.onPaused = append(f.onPaused, cb)
+}
+
+func (f *FakePlayer) OnStopped(cb func()) {
+	f.onStopped = append(f.onStopped, cb)
+}
+
+func (f *FakePlayer) OnPlaying(cb func()) {
+	f.onPlaying = append(f.onPlaying, cb)
+}
+
+func (f *FakePlayer) OnSeek(cb func()) {
+	f.onSeek = append(f.onSeek, cb)
+}
+
+func (f *FakePlayer) OnTrackChange(cb func(int64)) {
+	f.onTrackChange = append(f.onTrackChange, cb)
+}
+
+// starts the track at the given index, and queues the track change event
+func (f *FakePlayer) loadTrack(idx int64) {
+	f.status.PlaylistPos = idx
+	f.status.TimePos = 0
+	f.status.Duration = FakePlayerDefaultDuration
+	if d, ok := f.durations[f.playlist[idx]]; ok {
+		f.status.Duration = d
+	}
+	f.pendingEvents = append(f.pendingEvents, func() {
+		for _, cb := range f.onTrackChange {
+			cb(idx)
+		}
+	})
+}
+
+// reached the end of the play queue; like mpv, the playlist is kept
+func (f *FakePlayer) idle() {
+	f.status.PlaylistPos = -1
+	f.status.TimePos = 0
+	f.status.Duration = 0
+	f.setState(Stopped)
+}
+
+func (f *FakePlayer) setState(s State) {
+	if s == f.status.State {
+		return
+	}
+	f.status.State = s
+	var cbs []func()
+	switch s {
+	case Playing:
+		cbs = f.onPlaying
+	case Paused:
+		cbs = f.onPaused
+	case Stopped:
+		cbs = f.onStopped
+	}
+	for _, cb := range cbs {
+		cb()
+	}
+}
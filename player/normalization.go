@@ -0,0 +1,44 @@
+package player
+
+import (
+	"fmt"
+	"math"
+)
+
+// Dynamic loudness normalization (ReplayGainDynamic) uses the ffmpeg dynaudnorm
+// filter, which adjusts the gain frame by frame towards a target RMS level and
+// so works for tracks without ReplayGain tags. Short frames and a small gaussian
+// window keep its lookahead delay after each track change or seek under a second,
+// and unlike loudnorm's dynamic mode it doesn't resample the audio.
+
+const normFilterLabel = "norm"
+
+// The range of target RMS levels, in dBFS, supported by ReplayGainDynamic.
+const (
+	DefaultTargetLevel = -16.0
+	MinTargetLevel     = -30.0
+	MaxTargetLevel     = -5.0
+)
+
+const (
+	// frame length in ms and gaussian window size in frames (must be odd),
+	// which give a lookahead of about normFrameLength*normGaussSize/2 ms
+	normFrameLength = 100
+	normGaussSize   = 15
+	// peak limit in dBFS
+	normPeak = -1.5
+)
+
+// Returns the mpv 'af' entry for normalizing to the given RMS level in dBFS.
+func normalizationFilter(targetLevel float64) string {
+	if targetLevel == 0 {
+		targetLevel = DefaultTargetLevel
+	}
+	targetLevel = math.Max(MinTargetLevel, math.Min(MaxTargetLevel, targetLevel))
+	return fmt.Sprintf("@%s:dynaudnorm=f=%d:g=%d:p=%0.3f:r=%0.3f",
+		normFilterLabel, normFrameLength, normGaussSize, dbToLinear(normPeak), dbToLinear(targetLevel))
+}
+
+func dbToLinear(db float64) float64 {
+	return math.Pow(10, db/20)
+}
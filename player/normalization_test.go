@@ -0,0 +1,28 @@
+package player
+
+import "testing"
+
+func Test_PlaybackFilters(t *testing.T) {
+	p := New()
+	p.equalizer = &ParametricEqualizer{
+		EQPreamp: -3,
+		Bands:    []ParametricEQBand{{Frequency: 1000, Gain: 2, Q: 1}},
+	}
+	p.replayGainOpts = ReplayGainOptions{Mode: ReplayGainDynamic, TargetLevel: -40}
+	want := "volume=volume=-3.0dB,equalizer=f=1000:g=2.00:t=q:w=1.00," +
+		"@norm:dynaudnorm=f=100:g=15:p=0.841:r=0.032"
+	if got := p.playbackFilters(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	p.equalizer = nil
+	p.replayGainOpts.TargetLevel = 0
+	if got, want := p.playbackFilters(), "@norm:dynaudnorm=f=100:g=15:p=0.841:r=0.158"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	p.replayGainOpts.Mode = ReplayGainTrack
+	if got := p.playbackFilters(); got != "" {
+		t.Errorf("got %q, want no filters", got)
+	}
+}
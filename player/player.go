@@ -7,6 +7,7 @@ import (
 	"log"
 	"math"
 	"strconv"
+	"strings"
 
 	"github.com/dweymouth/go-mpv"
 )
@@ -14,6 +15,18 @@ import (
 // Error returned by many Player functions if called before the player has not been initialized.
 var ErrUnitialized error = errors.New("mpv player uninitialized")
 
+// userdata values identifying observed mpv properties in change events
+const (
+	observeAudioDeviceList uint64 = iota + 1
+	observeEOFReached
+)
+
+// The range of playback speeds supported by SetSpeed.
+const (
+	MinSpeed = 0.5
+	MaxSpeed = 3.0
+)
+
 // The playback state (Stopped, Paused, or Playing).
 type State int
 
@@ -42,13 +55,16 @@ const (
 	SeekRelativePercent
 )
 
-// One of "no", "track", or "album"
+// One of "no", "track", "album", or "dynamic"
 type ReplayGainMode string
 
 const (
 	ReplayGainNone  ReplayGainMode = "no"
 	ReplayGainTrack ReplayGainMode = "track"
 	ReplayGainAlbum ReplayGainMode = "album"
+	// Normalizes loudness with an audio filter instead of ReplayGain tags.
+	// See ReplayGainOptions.TargetLevel.
+	ReplayGainDynamic ReplayGainMode = "dynamic"
 )
 
 // Replay Gain options (argument to SetReplayGainOptions).
@@ -56,7 +72,13 @@ type ReplayGainOptions struct {
 	Mode            ReplayGainMode
 	PreampGain      float64
 	PreventClipping bool
-	// Fallback gain intentionally omitted
+	// Gain in dB applied to files without ReplayGain tags,
+	// unless overridden per track with SetReplayGainFallback.
+	// Not applied if Mode is ReplayGainNone or ReplayGainDynamic.
+	FallbackGain float64
+	// Target RMS level in dBFS for ReplayGainDynamic.
+	// Zero means DefaultTargetLevel.
+	TargetLevel float64
 }
 
 // The playback loop mode (LoopNone, LoopAll, LoopOne).
@@ -105,16 +127,26 @@ type Player struct {
 	mpv            *mpv.Mpv
 	initialized    bool
 	vol            int
+	speed          float64
+	abLoopA        float64
+	abLoopB        float64
 	replayGainOpts ReplayGainOptions
 	haveRGainOpts  bool
 	audioExclusive bool
 	status         Status
 	loopMode       LoopMode
 	seeking        bool
+	pauseAtEnd     bool
 	curPlaylistPos int64
 	prePausedState State
 	clientName     string
 	equalizer      Equalizer
+	visualizer     bool
+	audioFilters   string // the current mpv 'af' property
+
+	crossfadeSecs   float64
+	crossfadeFilter func(fromIdx, toIdx int64) bool
+	xfade           crossfader
 
 	bgCancel context.CancelFunc
 
@@ -124,6 +156,8 @@ type Player struct {
 	onPlaying     []func()
 	onSeek        []func()
 	onTrackChange []func(int64)
+
+	onAudioDevicesChanged []func()
 }
 
 // Returns a new player.
@@ -137,7 +171,11 @@ func New() *Player {
 func NewWithClientName(c string) *Player {
 	return &Player{
 		vol:        -1, // use 100 in Init
+		speed:      1,
+		abLoopA:    -1,
+		abLoopB:    -1,
 		clientName: c,
+		xfade:      crossfader{preparedPos: -1},
 	}
 }
 
@@ -162,6 +200,9 @@ func (p *Player) Init(maxCacheMB int) error {
 			p.vol = 100
 		}
 		m.SetOption("volume", mpv.FORMAT_INT64, p.vol)
+		m.SetOption("speed", mpv.FORMAT_DOUBLE, p.speed)
+		// keep the original pitch when playing at a different speed
+		m.SetOptionString("audio-pitch-correction", "yes")
 
 		p.SetAudioExclusive(p.audioExclusive)
 		if p.haveRGainOpts {
@@ -175,6 +216,13 @@ func (p *Player) Init(maxCacheMB int) error {
 		if err := m.Initialize(); err != nil {
 			return fmt.Errorf("error initializing mpv: %s", err.Error())
 		}
+		// be notified of audio devices being added or removed
+		if err := m.ObserveProperty(observeAudioDeviceList, "audio-device-list", mpv.FORMAT_NONE); err != nil {
+			log.Printf("error observing audio device list: %s", err.Error())
+		}
+		if err := m.ObserveProperty(observeEOFReached, "eof-reached", mpv.FORMAT_NONE); err != nil {
+			log.Printf("error observing eof-reached: %s", err.Error())
+		}
 		p.mpv = m
 	}
 	ctx, cancel := context.WithCancel(context.Background())
@@ -201,6 +249,7 @@ func (p *Player) PlayFile(url string) error {
 	if !p.initialized {
 		return ErrUnitialized
 	}
+	p.cancelCrossfade()
 	err := p.mpv.Command([]string{"loadfile", url, "replace"})
 	if err == nil {
 		p.setState(Playing)
@@ -213,9 +262,22 @@ func (p *Player) RemoveTrackAt(idx int) error {
 	if !p.initialized {
 		return ErrUnitialized
 	}
+	// playlist positions may have shifted
+	p.cancelCrossfade()
 	return p.mpv.Command([]string{"playlist-remove", strconv.Itoa(idx)})
 }
 
+// Moves the item at index from in the internal playqueue to before
+// the item at index to, or to the end if to is the length of the queue.
+func (p *Player) MoveTrack(from, to int) error {
+	if !p.initialized {
+		return ErrUnitialized
+	}
+	// playlist positions may have shifted
+	p.cancelCrossfade()
+	return p.mpv.Command([]string{"playlist-move", strconv.Itoa(from), strconv.Itoa(to)})
+}
+
 // Stops playback and clears the play queue.
 func (p *Player) Stop() error {
 	if !p.initialized {
@@ -250,6 +312,7 @@ func (p *Player) Seek(target string, mode SeekMode) error {
 	if !p.initialized {
 		return ErrUnitialized
 	}
+	p.cancelCrossfade()
 	p.seeking = true
 	err := p.mpv.Command([]string{"seek", target, mode.String()})
 	return err
@@ -271,6 +334,7 @@ func (p *Player) SeekBackOrPrevious() error {
 	if pos, err := p.getInt64Property("playlist-pos"); err == nil && pos == 0 {
 		return p.Seek("0", SeekAbsolutePercent)
 	}
+	p.cancelCrossfade()
 	return p.mpv.Command([]string{"playlist-prev"})
 }
 
@@ -279,9 +343,32 @@ func (p *Player) SeekNext() error {
 	if !p.initialized {
 		return ErrUnitialized
 	}
+	p.cancelCrossfade()
 	return p.mpv.Command([]string{"playlist-next"})
 }
 
+// Sets whether playback should pause at the end of the current track,
+// with the next track loaded, instead of moving on to it. If the current track
+// is the last in the play queue, playback stops as usual.
+// Tracks are not crossfaded while set.
+func (p *Player) SetPauseAtEndOfTrack(pause bool) error {
+	if !p.initialized {
+		return ErrUnitialized
+	}
+	keepOpen := "no"
+	if pause {
+		// pause at the end of every file, not just the last one
+		keepOpen = "always"
+		p.cancelCrossfade()
+	}
+	if err := p.mpv.SetOptionString("keep-open", keepOpen); err != nil {
+		return err
+	}
+	p.pauseAtEnd = pause
+	p.scheduleCrossfade()
+	return nil
+}
+
 // Sets the volume of the player (0-100).
 // Unlike most Player functions, SetVolume can be called before Init,
 // to set the initial volume of the player on startup.
@@ -295,6 +382,7 @@ func (p *Player) SetVolume(vol int) error {
 		err := p.mpv.SetProperty("volume", mpv.FORMAT_INT64, vol)
 		if err == nil {
 			p.vol = vol
+			p.setFaderVolume(vol)
 		}
 		return err
 	}
@@ -302,6 +390,63 @@ func (p *Player) SetVolume(vol int) error {
 	return nil
 }
 
+// Gets the current playback speed of the player.
+func (p *Player) GetSpeed() float64 {
+	return p.speed
+}
+
+// Sets the playback speed of the player, as a multiple of
+// the normal speed, clamped to between MinSpeed and MaxSpeed.
+// The pitch of the audio is preserved.
+// Unlike most Player functions, SetSpeed can be called before Init,
+// to set the initial playback speed of the player on startup.
+func (p *Player) SetSpeed(speed float64) error {
+	speed = math.Max(MinSpeed, math.Min(MaxSpeed, speed))
+	if p.initialized {
+		if err := p.mpv.SetProperty("speed", mpv.FORMAT_DOUBLE, speed); err != nil {
+			return err
+		}
+	}
+	p.speed = speed
+	p.scheduleCrossfade()
+	return nil
+}
+
+// Sets the A-B loop points, in seconds, within the current track.
+// Once playback reaches B, it jumps back to A. A negative value leaves
+// the point unset; playback doesn't loop until both points are set.
+// The loop points are not cleared when the track changes.
+func (p *Player) SetABLoop(a, b float64) error {
+	if !p.initialized {
+		return ErrUnitialized
+	}
+	loopPoint := func(t float64) string {
+		if t < 0 {
+			return "no"
+		}
+		return strconv.FormatFloat(t, 'f', 3, 64)
+	}
+	if err := p.mpv.SetPropertyString("ab-loop-a", loopPoint(a)); err != nil {
+		return err
+	}
+	if err := p.mpv.SetPropertyString("ab-loop-b", loopPoint(b)); err != nil {
+		return err
+	}
+	p.abLoopA, p.abLoopB = a, b
+	p.scheduleCrossfade()
+	return nil
+}
+
+// Clears the A-B loop points.
+func (p *Player) ClearABLoop() error {
+	return p.SetABLoop(-1, -1)
+}
+
+// Gets the A-B loop points, in seconds. Unset points are negative.
+func (p *Player) GetABLoop() (a, b float64) {
+	return p.abLoopA, p.abLoopB
+}
+
 // Sets the ReplayGain options of the player.
 // Unlike most Player functions, SetReplayGainOptions can be called
 // before Init, to set the initial replaygain options of the player on startup.
@@ -309,7 +454,11 @@ func (p *Player) SetReplayGainOptions(options ReplayGainOptions) error {
 	p.replayGainOpts = options
 	p.haveRGainOpts = true
 	if p.initialized {
-		if err := p.mpv.SetPropertyString("replaygain", string(options.Mode)); err != nil {
+		mode := options.Mode
+		if mode == ReplayGainDynamic {
+			mode = ReplayGainNone // normalized by the audio filter chain instead
+		}
+		if err := p.mpv.SetPropertyString("replaygain", string(mode)); err != nil {
 			return err
 		}
 		if err := p.mpv.SetProperty("replaygain-preamp", mpv.FORMAT_DOUBLE, options.PreampGain); err != nil {
@@ -322,10 +471,30 @@ func (p *Player) SetReplayGainOptions(options ReplayGainOptions) error {
 		if err := p.mpv.SetPropertyString("replaygain-clip", clip); err != nil {
 			return err
 		}
+		fallback := options.FallbackGain
+		if mode == ReplayGainNone {
+			fallback = 0 // mpv applies the fallback gain whenever replaygain is off
+		}
+		if err := p.SetReplayGainFallback(fallback); err != nil {
+			return err
+		}
+		if err := p.updateAudioFilters(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Sets the gain in dB applied to the current track if it has no ReplayGain tags,
+// until the next call to SetReplayGainOptions. Useful for applying ReplayGain
+// metadata from another source, e.g. the server, to transcoded streams.
+func (p *Player) SetReplayGainFallback(gain float64) error {
+	if !p.initialized {
+		return ErrUnitialized
+	}
+	return p.mpv.SetProperty("replaygain-fallback", mpv.FORMAT_DOUBLE, gain)
+}
+
 // Sets the audio exclusive option of the player.
 // Unlike most Player functions, SetAudioExclusive can be called
 // before Init, to set the initial option of the player on startup.
@@ -367,6 +536,7 @@ func (p *Player) PlayFromBeginning() error {
 
 // Start playback from the specified track index in the play queue.
 func (p *Player) PlayTrackAt(idx int) error {
+	p.cancelCrossfade()
 	err := p.mpv.Command([]string{"playlist-play-index", strconv.Itoa(idx)})
 	if p.GetStatus().State == Paused {
 		err = p.setPaused(false)
@@ -535,8 +705,14 @@ func (p *Player) SetAudioDevice(deviceName string) error {
 
 func (p *Player) SetEqualizer(eq Equalizer) error {
 	p.equalizer = eq
+	return p.updateAudioFilters()
+}
+
+// Returns the audio filter chain for the equalizer, which may be empty.
+func (p *Player) equalizerFilters() string {
+	eq := p.equalizer
 	if eq == nil || !eq.IsEnabled() {
-		return p.mpv.SetPropertyString("af", "")
+		return ""
 	}
 	af := ""
 	if math.Abs(eq.Preamp()) > 0.01 {
@@ -548,7 +724,41 @@ func (p *Player) SetEqualizer(eq Equalizer) error {
 	} else if eqAF != "" {
 		af = fmt.Sprintf("%s,%s", af, eqAF)
 	}
-	return p.mpv.SetPropertyString("af", af)
+	return af
+}
+
+// Returns the audio filter chain for the equalizer and loudness
+// normalization, which may be empty. Does not include the visualizer tap.
+func (p *Player) playbackFilters() string {
+	var filters []string
+	if eq := p.equalizerFilters(); eq != "" {
+		filters = append(filters, eq)
+	}
+	if p.replayGainOpts.Mode == ReplayGainDynamic {
+		// after the EQ so that EQ boosts don't push the output past the target
+		filters = append(filters, normalizationFilter(p.replayGainOpts.TargetLevel))
+	}
+	return strings.Join(filters, ",")
+}
+
+// Sets the mpv audio filter chain from the equalizer, normalization, and visualizer settings.
+// Since changing the filter chain briefly interrupts playback, it is only set if changed.
+func (p *Player) updateAudioFilters() error {
+	af := p.playbackFilters()
+	if p.visualizer {
+		if af != "" {
+			af += ","
+		}
+		af += visualizerFilter()
+	}
+	if af == p.audioFilters {
+		return nil
+	}
+	if err := p.mpv.SetPropertyString("af", af); err != nil {
+		return err
+	}
+	p.audioFilters = af
+	return nil
 }
 
 func (p *Player) Equalizer() Equalizer {
@@ -621,12 +831,20 @@ func (p *Player) OnTrackChange(cb func(int64)) {
 	p.onTrackChange = append(p.onTrackChange, cb)
 }
 
+// Registers a callback which is invoked when the list of available audio devices changes,
+// eg. when a device is plugged in or unplugged. Not all audio outputs support this.
+// The callback is also invoked once shortly after Init.
+func (p *Player) OnAudioDevicesChanged(cb func()) {
+	p.onAudioDevicesChanged = append(p.onAudioDevicesChanged, cb)
+}
+
 // Destroy the player.
 func (p *Player) Destroy() {
 	if p.bgCancel != nil {
 		p.bgCancel()
 	}
 	if p.initialized {
+		p.destroyFader()
 		p.mpv.Command([]string{"stop"})
 		p.mpv.TerminateDestroy()
 		p.initialized = false
@@ -638,17 +856,20 @@ func (p *Player) setState(s State) {
 	switch {
 	case s == Playing && p.status.State != Playing:
 		defer func() {
+			p.scheduleCrossfade()
 			for _, cb := range p.onPlaying {
 				cb()
 			}
 		}()
 	case s == Paused && p.status.State != Paused:
+		p.cancelCrossfade()
 		defer func() {
 			for _, cb := range p.onPaused {
 				cb()
 			}
 		}()
 	case s == Stopped && p.status.State != Stopped:
+		p.cancelCrossfade()
 		defer func() {
 			for _, cb := range p.onStopped {
 				cb()
@@ -673,11 +894,14 @@ func (p *Player) eventHandler(ctx context.Context) {
 				if p.seeking {
 					p.seeking = false
 				}
+				// after a seek or track change
+				p.scheduleCrossfade()
 			case mpv.EVENT_SEEK:
 				for _, cb := range p.onSeek {
 					cb()
 				}
 			case mpv.EVENT_FILE_LOADED:
+				p.crossfadeOnFileLoaded()
 				if p.status.State == Paused {
 					// seek while paused switches to a new file
 					// mpv does not fire seek event in this case
@@ -695,11 +919,40 @@ func (p *Player) eventHandler(ctx context.Context) {
 				p.status.Duration = 0
 				p.status.TimePos = 0
 				p.setState(Stopped)
+			case mpv.EVENT_PROPERTY_CHANGE:
+				switch e.Reply_Userdata {
+				case observeAudioDeviceList:
+					for _, cb := range p.onAudioDevicesChanged {
+						cb()
+					}
+				case observeEOFReached:
+					if eof, err := p.mpv.GetProperty("eof-reached", mpv.FORMAT_FLAG); err == nil && eof.(bool) && p.pauseAtEnd {
+						p.handlePauseAtEnd()
+					}
+				}
 			}
 		}
 	}
 }
 
+// Called when mpv has paused at the end of the track with keep-open set,
+// to load the next track paused, or stop if there is none.
+func (p *Player) handlePauseAtEnd() {
+	p.pauseAtEnd = false
+	p.mpv.SetOptionString("keep-open", "no")
+	pos, _ := p.getInt64Property("playlist-pos")
+	if _, ok := p.nextPlaylistPos(pos); !ok {
+		// goes idle, keeping the playlist, as at the end of the play queue
+		p.mpv.Command([]string{"playlist-next", "force"})
+		p.setPaused(false)
+		return
+	}
+	p.Pause()
+	if err := p.mpv.Command([]string{"playlist-next"}); err != nil {
+		log.Printf("error loading next track: %s", err.Error())
+	}
+}
+
 func (s SeekMode) String() string {
 	switch s {
 	case SeekAbsolute:
@@ -0,0 +1,102 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dweymouth/go-mpv"
+)
+
+// The visualizer is implemented as a lavfi "tap" at the end of the audio
+// filter chain. The audio is split off, mixed to mono and run through a bank
+// of bandpass filters, and astats reports the RMS level of each band as frame
+// metadata, which mpv exposes via the af-metadata property. The filtered
+// channels are merged with, and then dropped from, the audio being played.
+
+const (
+	vizFilterLabel = "viz"
+	// band levels at or below this are reported as 0
+	vizFloorDB = -60.0
+)
+
+// The center frequencies, in Hz, of the bands reported by VisualizerLevels.
+var VisualizerBands = []int{32, 63, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+// Enables or disables the audio filter tap used by VisualizerLevels.
+// Since changing the audio filter chain causes a brief interruption
+// in playback, the visualizer should not be toggled on and off frequently.
+func (p *Player) SetVisualizerEnabled(enabled bool) error {
+	if !p.initialized {
+		return ErrUnitialized
+	}
+	p.visualizer = enabled
+	return p.updateAudioFilters()
+}
+
+// Returns true if the visualizer audio filter tap is enabled.
+func (p *Player) VisualizerEnabled() bool {
+	return p.visualizer
+}
+
+// Returns the current level, from 0 to 1, of each of the VisualizerBands,
+// or nil if the visualizer is disabled or no audio is being filtered.
+// The levels are of audio that has been decoded but which may still be
+// buffered for output, so they can lead what is heard by up to a few hundred ms.
+func (p *Player) VisualizerLevels() []float64 {
+	if !p.initialized || !p.visualizer {
+		return nil
+	}
+	n, err := p.mpv.GetProperty("af-metadata/"+vizFilterLabel, mpv.FORMAT_NODE)
+	if err != nil || n == nil {
+		return nil
+	}
+	meta, ok := n.(*mpv.Node).Data.(map[string]*mpv.Node)
+	if !ok || len(meta) == 0 {
+		return nil
+	}
+	levels := make([]float64, len(VisualizerBands))
+	for i := range levels {
+		// channels 1 and 2 are the stereo audio; the bands follow
+		key := fmt.Sprintf("lavfi.astats.%d.RMS_level", i+3)
+		v, ok := meta[key]
+		if !ok {
+			continue
+		}
+		s, _ := v.Data.(string)
+		db, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(db) {
+			continue
+		}
+		levels[i] = math.Max(0, math.Min(1, (db-vizFloorDB)/-vizFloorDB))
+	}
+	return levels
+}
+
+// Returns the lavfi filter graph for the visualizer tap.
+func visualizerGraph() string {
+	n := len(VisualizerBands)
+	var sb strings.Builder
+	sb.WriteString("aformat=channel_layouts=stereo,asplit=2[a][v];")
+	fmt.Fprintf(&sb, "[v]pan=mono|c0=0.5*c0+0.5*c1,asplit=%d", n)
+	for i := range VisualizerBands {
+		fmt.Fprintf(&sb, "[b%d]", i)
+	}
+	for i, f := range VisualizerBands {
+		fmt.Fprintf(&sb, ";[b%d]bandpass=f=%d:width_type=o:w=1[f%d]", i, f, i)
+	}
+	sb.WriteString(";[a]")
+	for i := range VisualizerBands {
+		fmt.Fprintf(&sb, "[f%d]", i)
+	}
+	fmt.Fprintf(&sb, "amerge=inputs=%d,astats=metadata=1:reset=1,pan=stereo|c0=c0|c1=c1", n+1)
+	return sb.String()
+}
+
+// Returns the mpv 'af' entry for the visualizer tap.
+func visualizerFilter() string {
+	graph := visualizerGraph()
+	// %len% quoting allows the graph to contain mpv option list separators
+	return fmt.Sprintf("@%s:lavfi=graph=%%%d%%%s", vizFilterLabel, len(graph), graph)
+}
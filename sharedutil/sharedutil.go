@@ -16,6 +16,18 @@ func SliceContains[T comparable](ts []T, t T) bool {
 	return false
 }
 
+func SliceEqual[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func FilterSlice[T any](ss []T, test func(T) bool) []T {
 	if ss == nil {
 		return nil
@@ -99,12 +99,24 @@ func NewBottomPanel(p *player.Player, pm *backend.PlaybackManager, contr *contro
 	bp.AuxControls = widgets.NewAuxControls(p.GetVolume())
 	pm.OnLoopModeChange(bp.AuxControls.SetLoopMode)
 	pm.OnVolumeChange(bp.AuxControls.VolumeControl.SetVolume)
+	pm.OnSpeedChange(bp.AuxControls.SetSpeed)
+	pm.OnABLoopChange(func(a, b float64) {
+		bp.Controls.SetABLoop(a, b)
+		bp.AuxControls.SetABLoop(a, b)
+	})
+	bp.AuxControls.OnSetSpeed = func(speed float64) {
+		_ = bp.playbackManager.SetSpeed(speed)
+	}
 	bp.AuxControls.VolumeControl.OnSetVolume = func(v int) {
 		_ = bp.playbackManager.SetVolume(v)
 	}
 	bp.AuxControls.OnChangeLoopMode(func() {
 		bp.playbackManager.SetNextLoopMode()
 	})
+	bp.AuxControls.SleepTimerMenu = newSleepTimerMenu(pm, &contr.App.Config.LocalPlayback)
+	pm.OnSleepTimerUpdate(bp.AuxControls.SetSleepTimerStatus)
+	bp.AuxControls.SetPendingScrobbles(contr.App.ScrobbleQueue.Pending())
+	contr.App.ScrobbleQueue.OnPendingChanged(bp.AuxControls.SetPendingScrobbles)
 
 	bp.container = container.New(layouts.NewLeftMiddleRightLayout(500),
 		bp.NowPlaying, bp.Controls, bp.AuxControls)
@@ -233,6 +233,9 @@ func NewAlbumPageHeader(page *AlbumPage) *AlbumPageHeader {
 				}),
 				fyne.NewMenuItem("Show Info...", func() {
 					a.page.contr.ShowAlbumInfoDialog(a.albumID, a.titleLabel.String(), a.cover.Image.Image)
+				}),
+				fyne.NewMenuItem("Copy link", func() {
+					a.page.contr.CopyLinks(backend.DeepLinkAlbum, []string{a.albumID})
 				}))
 			pop = widget.NewPopUpMenu(menu, fyne.CurrentApp().Driver().CanvasForObject(a))
 		}
@@ -299,7 +302,7 @@ func (a *AlbumPageHeader) Clear() {
 
 func (a *AlbumPageHeader) toggleFavorited() {
 	params := mediaprovider.RatingFavoriteParameters{AlbumIDs: []string{a.albumID}}
-	a.page.mp.SetFavorite(params, a.toggleFavButton.IsFavorited)
+	a.page.contr.App.ServerManager.SetFavorite(params, a.toggleFavButton.IsFavorited)
 }
 
 func (a *AlbumPageHeader) showPopUpCover() {
@@ -392,7 +392,7 @@ func (a *ArtistPageHeader) UpdateInfo(info *mediaprovider.ArtistInfo) {
 
 func (a *ArtistPageHeader) toggleFavorited() {
 	params := mediaprovider.RatingFavoriteParameters{ArtistIDs: []string{a.artistID}}
-	a.artistPage.mp.SetFavorite(params, a.favoriteBtn.IsFavorited)
+	a.artistPage.contr.App.ServerManager.SetFavorite(params, a.favoriteBtn.IsFavorited)
 }
 
 func (a *ArtistPageHeader) createContainer() {
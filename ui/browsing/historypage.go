@@ -0,0 +1,146 @@
+package browsing
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dweymouth/supersonic/backend"
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/ui/controller"
+	"github.com/dweymouth/supersonic/ui/layouts"
+	"github.com/dweymouth/supersonic/ui/widgets"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+type HistoryPage struct {
+	widget.BaseWidget
+
+	historyPageState
+
+	title       *widget.RichText
+	showSkipped *widget.Check
+	list        *widgets.HistoryList
+	container   *fyne.Container
+}
+
+type historyPageState struct {
+	contr   *controller.Controller
+	conf    *backend.HistoryPageConfig
+	history *backend.ListeningHistory
+	sm      *backend.ServerManager
+}
+
+func NewHistoryPage(contr *controller.Controller, conf *backend.HistoryPageConfig, history *backend.ListeningHistory, sm *backend.ServerManager) *HistoryPage {
+	h := &HistoryPage{historyPageState: historyPageState{contr: contr, conf: conf, history: history, sm: sm}}
+	h.ExtendBaseWidget(h)
+
+	h.title = widget.NewRichTextWithText("History")
+	h.title.Segments[0].(*widget.TextSegment).Style.SizeName = widget.RichTextStyleHeading.SizeName
+	h.showSkipped = widget.NewCheck("Show skipped", func(show bool) {
+		h.conf.ShowSkipped = show
+		h.Reload()
+	})
+	h.showSkipped.Checked = conf.ShowSkipped
+	stats := widget.NewButtonWithIcon("Statistics", theme.InfoIcon(), func() {
+		contr.NavigateTo(controller.StatsRoute())
+	})
+	export := widget.NewButtonWithIcon("Export...", theme.DocumentSaveIcon(), h.showExportDialog)
+	clear := widget.NewButtonWithIcon("Clear history", theme.DeleteIcon(), h.showClearConfirmation)
+
+	h.list = widgets.NewHistoryList()
+	h.list.OnPlayTracks = func(tracks []*mediaprovider.Track) {
+		contr.App.PlaybackManager.LoadTracks(tracks, false, false)
+		contr.App.PlaybackManager.PlayFromBeginning()
+	}
+	h.list.OnAddToQueue = func(tracks []*mediaprovider.Track) {
+		contr.App.PlaybackManager.LoadTracks(tracks, true, false)
+	}
+	h.list.OnShowAlbumPage = func(albumID string) {
+		contr.NavigateTo(controller.AlbumRoute(albumID))
+	}
+	h.list.OnShowArtistPage = func(artistID string) {
+		contr.NavigateTo(controller.ArtistRoute(artistID))
+	}
+
+	vCenter := func(obj fyne.CanvasObject) fyne.CanvasObject {
+		return container.NewVBox(layout.NewSpacer(), obj, layout.NewSpacer())
+	}
+	topRow := container.NewHBox(h.title, vCenter(h.showSkipped), layout.NewSpacer(), vCenter(stats), vCenter(export), vCenter(clear))
+	h.container = container.New(&layouts.MaxPadLayout{PadLeft: 15, PadRight: 15, PadTop: 5, PadBottom: 15},
+		container.NewBorder(topRow, nil, nil, nil, h.list))
+	h.Reload()
+	return h
+}
+
+func (h *HistoryPage) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(h.container)
+}
+
+func (h *HistoryPage) Save() SavedPage {
+	s := h.historyPageState
+	return &s
+}
+
+func (h *HistoryPage) Route() controller.Route {
+	return controller.HistoryRoute()
+}
+
+func (h *HistoryPage) Reload() {
+	h.list.SetEntries(h.history.Entries(h.sm.ServerID.String(), h.conf.ShowSkipped))
+}
+
+func (h *HistoryPage) Tapped(*fyne.PointEvent) {
+	h.list.UnselectAll()
+}
+
+var _ CanShowNowPlaying = (*HistoryPage)(nil)
+
+// The play of the previous track, if any, has been recorded
+// to the history by the time OnSongChange is called.
+func (h *HistoryPage) OnSongChange(_, _ *mediaprovider.Track) {
+	h.Reload()
+}
+
+func (h *HistoryPage) showExportDialog() {
+	dlg := dialog.NewFileSave(func(file fyne.URIWriteCloser, err error) {
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if file == nil {
+			return
+		}
+		defer file.Close()
+		if err := h.history.ExportCSV(file, h.sm.ServerID.String()); err != nil {
+			log.Printf("error exporting listening history: %s", err.Error())
+			dialog.ShowError(err, h.contr.MainWindow)
+		}
+	}, h.contr.MainWindow)
+	dlg.SetFileName("listening_history.csv")
+	dlg.Show()
+}
+
+func (h *HistoryPage) showClearConfirmation() {
+	dialog.ShowConfirm("Clear history",
+		"Are you sure you want to clear the listening history for this server?",
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := h.history.Clear(h.sm.ServerID.String()); err != nil {
+				log.Printf("error clearing listening history: %s", err.Error())
+				dialog.ShowError(fmt.Errorf("could not clear history: %v", err), h.contr.MainWindow)
+			}
+			h.Reload()
+		}, h.contr.MainWindow)
+}
+
+func (s *historyPageState) Restore() Page {
+	return NewHistoryPage(s.contr, s.conf, s.history, s.sm)
+}
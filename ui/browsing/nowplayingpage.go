@@ -32,8 +32,10 @@ type NowPlayingPage struct {
 	title        *widget.RichText
 	tracklist    *widgets.Tracklist
 	statusLabel  *widget.RichText
+	visualizer   *widgets.Visualizer
 	nowPlayingID string
 	container    *fyne.Container
+	saved        bool
 }
 
 type nowPlayingPageState struct {
@@ -60,6 +62,9 @@ func NewNowPlayingPage(
 	p.OnPaused(a.formatStatusLine)
 	p.OnPlaying(a.formatStatusLine)
 	p.OnStopped(a.formatStatusLine)
+	p.OnPaused(a.updateVisualizer)
+	p.OnPlaying(a.updateVisualizer)
+	p.OnStopped(a.updateVisualizer)
 
 	if t := a.pool.Obtain(util.WidgetTypeTracklist); t != nil {
 		a.tracklist = t.(*widgets.Tracklist)
@@ -84,13 +89,16 @@ func NewNowPlayingPage(
 	a.title = widget.NewRichTextWithText("Now Playing")
 	a.title.Segments[0].(*widget.TextSegment).Style.SizeName = widget.RichTextStyleHeading.SizeName
 	a.statusLabel = widget.NewRichTextWithText("Stopped")
+	a.visualizer = widgets.NewVisualizer(p.VisualizerLevels)
 	statusLabelCtr := container.New(&layouts.VboxCustomPadding{ExtraPad: -5},
+		a.visualizer,
 		myTheme.NewThemedRectangle(theme.ColorNameInputBorder),
 		a.statusLabel,
 	)
 	a.container = container.New(&layouts.MaxPadLayout{PadLeft: 15, PadRight: 15, PadTop: 5, PadBottom: 15},
 		container.NewBorder(a.title, statusLabelCtr, nil, nil, a.tracklist))
 	a.load(highlightedTrackID)
+	a.updateVisualizer()
 	return a
 }
 
@@ -101,6 +109,9 @@ func (a *NowPlayingPage) CreateRenderer() fyne.WidgetRenderer {
 func (a *NowPlayingPage) Save() SavedPage {
 	a.tracklist.Clear()
 	a.pool.Release(util.WidgetTypeTracklist, a.tracklist)
+	a.visualizer.Stop()
+	a.setVisualizerFilterEnabled(false)
+	a.saved = true
 	nps := a.nowPlayingPageState
 	return &nps
 }
@@ -186,6 +197,37 @@ func (a *NowPlayingPage) formatStatusLine() {
 
 func (a *NowPlayingPage) Reload() {
 	a.load("")
+	a.updateVisualizer()
+}
+
+// shows and runs the visualizer only if enabled and playing
+func (a *NowPlayingPage) updateVisualizer() {
+	if a.saved {
+		return // player callbacks outlive the page
+	}
+	if !a.conf.ShowVisualizer {
+		a.visualizer.Stop()
+		a.visualizer.Hide()
+		a.setVisualizerFilterEnabled(false)
+		return
+	}
+	a.setVisualizerFilterEnabled(true)
+	a.visualizer.Show()
+	if a.p.GetStatus().State == player.Playing {
+		a.visualizer.Start()
+	} else {
+		a.visualizer.Stop()
+	}
+}
+
+// the visualizer's audio filter is only inserted while it is shown
+func (a *NowPlayingPage) setVisualizerFilterEnabled(enabled bool) {
+	if a.p.VisualizerEnabled() == enabled {
+		return
+	}
+	if err := a.p.SetVisualizerEnabled(enabled); err != nil {
+		log.Printf("error setting visualizer enabled: %s", err.Error())
+	}
 }
 
 func (a *NowPlayingPage) onPlayTrackAt(tracknum int) {
@@ -15,6 +15,7 @@ import (
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
@@ -219,7 +220,27 @@ func (a *PlaylistPage) onRemoveSelectedFromPlaylist() {
 			idxs = append(idxs, i)
 		}
 	}
-	a.sm.Server.EditPlaylistTracks(a.playlistID, nil, idxs)
+	prevTrackIDs := sharedutil.TracksToIDs(a.tracks)
+	playlistID, server := a.playlistID, a.sm.Server
+	if err := server.EditPlaylistTracks(playlistID, nil, idxs); err != nil {
+		log.Printf("error removing tracks from playlist: %s", err.Error())
+	} else {
+		contr := a.contr
+		contr.App.UndoManager.Record(
+			fmt.Sprintf("Removed %s from playlist", backend.TracksCountDescription(len(idxs))),
+			func() error {
+				// undo is invoked on the UI goroutine; don't block it on the server
+				go func() {
+					if err := server.ReplacePlaylistTracks(playlistID, prevTrackIDs); err != nil {
+						log.Printf("error restoring playlist tracks: %s", err.Error())
+						dialog.ShowError(fmt.Errorf("failed to undo removing tracks from playlist: %v", err), contr.MainWindow)
+					} else if rte := contr.CurPageFunc(); rte.Page == controller.Playlist && rte.Arg == playlistID {
+						contr.ReloadFunc()
+					}
+				}()
+				return nil
+			})
+	}
 	a.tracklist.UnselectAll()
 	a.Reload()
 }
@@ -286,6 +307,9 @@ func NewPlaylistPageHeader(page *PlaylistPage) *PlaylistPageHeader {
 				}),
 				fyne.NewMenuItem("Download...", func() {
 					a.page.contr.ShowDownloadDialog(a.page.tracks, a.playlistInfo.Name)
+				}),
+				fyne.NewMenuItem("Copy link", func() {
+					a.page.contr.CopyLinks(backend.DeepLinkPlaylist, []string{a.page.playlistID})
 				}))
 			pop = widget.NewPopUpMenu(menu, fyne.CurrentApp().Driver().CanvasForObject(a))
 		}
@@ -136,6 +136,9 @@ func (a *PlaylistsPage) createGridView(playlists []*mediaprovider.Playlist) {
 			a.contr.ShowDownloadDialog(pl.Tracks, pl.Name)
 		}()
 	}
+	a.gridView.OnCopyLink = func(id string) {
+		a.contr.CopyLinks(backend.DeepLinkPlaylist, []string{id})
+	}
 }
 
 func (a *PlaylistsPage) showListView() {
@@ -0,0 +1,208 @@
+package browsing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend"
+	"github.com/dweymouth/supersonic/ui/controller"
+	"github.com/dweymouth/supersonic/ui/layouts"
+	"github.com/dweymouth/supersonic/ui/widgets"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	statsTopN = 10
+	// above this many days, the listening time chart shows weeks instead of days
+	statsMaxDailyBars = 92
+)
+
+type StatsPage struct {
+	widget.BaseWidget
+
+	statsPageState
+
+	title      *widget.RichText
+	periodBtns *widgets.ToggleButtonGroup
+	summary    *widget.Label
+	topLists   *fyne.Container
+	dailyTitle *widget.Label
+	daily      *widgets.BarChart
+	heatmap    *widgets.Heatmap
+	container  *fyne.Container
+}
+
+type statsPageState struct {
+	contr   *controller.Controller
+	history *backend.ListeningHistory
+	sm      *backend.ServerManager
+	period  backend.StatsPeriod
+}
+
+func NewStatsPage(contr *controller.Controller, history *backend.ListeningHistory, sm *backend.ServerManager) *StatsPage {
+	return newStatsPage(statsPageState{contr: contr, history: history, sm: sm, period: backend.StatsPeriodMonth})
+}
+
+func newStatsPage(state statsPageState) *StatsPage {
+	s := &StatsPage{statsPageState: state}
+	s.ExtendBaseWidget(s)
+
+	s.title = widget.NewRichTextWithText("Statistics")
+	s.title.Segments[0].(*widget.TextSegment).Style.SizeName = widget.RichTextStyleHeading.SizeName
+	periodBtn := func(label string, period backend.StatsPeriod) *widget.Button {
+		return widget.NewButton(label, func() {
+			s.period = period
+			s.Reload()
+		})
+	}
+	s.periodBtns = widgets.NewToggleButtonGroup(0,
+		periodBtn("This week", backend.StatsPeriodWeek),
+		periodBtn("This month", backend.StatsPeriodMonth),
+		periodBtn("This year", backend.StatsPeriodYear),
+		periodBtn("All time", backend.StatsPeriodAllTime))
+	s.periodBtns.SetActivatedButton(int(s.period))
+	s.summary = widget.NewLabel("")
+	s.topLists = container.NewGridWithColumns(4)
+	s.dailyTitle = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	s.daily = widgets.NewBarChart()
+	s.heatmap = widgets.NewHeatmap()
+	s.heatmap.RowLabels = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+	s.heatmap.ColumnLabels = make([]string, 24)
+	for h := 0; h < 24; h += 3 {
+		s.heatmap.ColumnLabels[h] = fmt.Sprintf("%02d", h)
+	}
+
+	topRow := container.NewHBox(s.title, container.NewCenter(s.periodBtns), layout.NewSpacer(), container.NewCenter(s.summary))
+	content := container.NewVBox(
+		s.topLists,
+		s.dailyTitle,
+		s.daily,
+		widget.NewLabelWithStyle("Listening time by hour of day", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		s.heatmap,
+	)
+	s.container = container.New(&layouts.MaxPadLayout{PadLeft: 15, PadRight: 15, PadTop: 5, PadBottom: 15},
+		container.NewBorder(topRow, nil, nil, nil, container.NewVScroll(content)))
+	s.Reload()
+	return s
+}
+
+func (s *StatsPage) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(s.container)
+}
+
+func (s *StatsPage) Save() SavedPage {
+	st := s.statsPageState
+	return &st
+}
+
+func (s *StatsPage) Route() controller.Route {
+	return controller.StatsRoute()
+}
+
+func (s *StatsPage) Reload() {
+	stats := s.history.Stats(s.sm.ServerID.String(), s.period, statsTopN)
+
+	s.summary.SetText(fmt.Sprintf("%d plays · %s listened", stats.TotalPlays, formatListeningTime(stats.TotalPlayTime)))
+
+	s.topLists.Objects = []fyne.CanvasObject{
+		s.newTopList("Top Artists", stats.TopArtists, func(it backend.StatsItem) controller.Route {
+			return controller.ArtistRoute(it.ID)
+		}, false),
+		s.newTopList("Top Albums", stats.TopAlbums, func(it backend.StatsItem) controller.Route {
+			return controller.AlbumRoute(it.ID)
+		}, true),
+		s.newTopList("Top Tracks", stats.TopTracks, func(it backend.StatsItem) controller.Route {
+			return controller.AlbumRoute(it.AlbumID)
+		}, true),
+		s.newTopList("Top Genres", stats.TopGenres, func(it backend.StatsItem) controller.Route {
+			return controller.GenreRoute(it.Name)
+		}, false),
+	}
+	s.topLists.Refresh()
+
+	s.updateDailyChart(stats.Daily)
+
+	// reorder rows to start the week on Monday
+	s.heatmap.Values = make([][]float64, 7)
+	for i := range s.heatmap.Values {
+		weekday := (i + 1) % 7
+		s.heatmap.Values[i] = make([]float64, 24)
+		for h, d := range stats.HourOfDay[weekday] {
+			s.heatmap.Values[i][h] = d.Minutes()
+		}
+	}
+	s.heatmap.Refresh()
+}
+
+func (s *StatsPage) updateDailyChart(daily []backend.DailyListening) {
+	bucketDays := 1
+	s.dailyTitle.SetText("Listening time per day")
+	if len(daily) > statsMaxDailyBars {
+		bucketDays = 7
+		s.dailyTitle.SetText("Listening time per week")
+	}
+	var values []float64
+	var max time.Duration
+	for i := 0; i < len(daily); i += bucketDays {
+		var d time.Duration
+		for j := i; j < i+bucketDays && j < len(daily); j++ {
+			d += daily[j].PlayTime
+		}
+		if d > max {
+			max = d
+		}
+		values = append(values, d.Hours())
+	}
+	s.daily.Values = values
+	s.daily.MaxLabel = formatListeningTime(max)
+	s.daily.StartLabel, s.daily.EndLabel = "", ""
+	if len(daily) > 0 {
+		s.daily.StartLabel = daily[0].Day.Format("Jan 2, 2006")
+		s.daily.EndLabel = daily[len(daily)-1].Day.Format("Jan 2, 2006")
+	}
+	s.daily.Refresh()
+}
+
+// Builds a ranked list of the given items. Item names link to the route returned by routeFn,
+// and if showArtist is true, the item's artist is shown beneath, linking to the artist page.
+func (s *StatsPage) newTopList(title string, items []backend.StatsItem, routeFn func(backend.StatsItem) controller.Route, showArtist bool) fyne.CanvasObject {
+	list := container.NewVBox(widget.NewLabelWithStyle(title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+	if len(items) == 0 {
+		list.Add(widget.NewLabel("No plays"))
+	}
+	for i, it := range items {
+		it := it
+		route := routeFn(it)
+		name := widgets.NewCustomHyperlink()
+		name.Disabled = route.Arg == ""
+		name.SetText(fmt.Sprintf("%d. %s", i+1, it.Name))
+		name.OnTapped = func() { s.contr.NavigateTo(route) }
+		plays := widget.NewLabel(fmt.Sprintf("%d", it.Plays))
+		var entry fyne.CanvasObject = name
+		if showArtist && it.ArtistName != "" {
+			artist := widgets.NewCustomHyperlink()
+			artist.Disabled = it.ArtistID == ""
+			artist.SetTextStyle(fyne.TextStyle{Italic: true})
+			artist.SetText(it.ArtistName)
+			artist.OnTapped = func() { s.contr.NavigateTo(controller.ArtistRoute(it.ArtistID)) }
+			entry = container.New(&layouts.VboxCustomPadding{ExtraPad: -10}, name, artist)
+		}
+		list.Add(container.NewBorder(nil, nil, nil, container.NewCenter(plays), entry))
+	}
+	return list
+}
+
+func formatListeningTime(d time.Duration) string {
+	if d < time.Hour {
+		return fmt.Sprintf("%d min", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%.1f h", d.Hours())
+}
+
+func (s *statsPageState) Restore() Page {
+	return newStatsPage(*s)
+}
@@ -8,6 +8,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dweymouth/supersonic/backend"
@@ -42,12 +44,44 @@ type Controller struct {
 	escapablePopUp   *widget.PopUp
 	haveModal        bool
 	runOnModalClosed func()
+
+	// the settings dialog, while it is shown,
+	// which is also accessed from a background goroutine
+	settingsDialogLock   sync.Mutex
+	settingsDialog       *dialogs.SettingsDialog
+	watchingAudioDevices bool
 }
 
 func (m *Controller) NavigateTo(route Route) {
 	m.NavHandler(route)
 }
 
+// Shows the page of the item linked by a supersonic:// link.
+func (m *Controller) OpenDeepLink(link backend.DeepLink) {
+	switch link.Kind {
+	case backend.DeepLinkAlbum:
+		m.NavigateTo(AlbumRoute(link.ID))
+	case backend.DeepLinkArtist:
+		m.NavigateTo(ArtistRoute(link.ID))
+	case backend.DeepLinkPlaylist:
+		m.NavigateTo(PlaylistRoute(link.ID))
+	default:
+		return
+	}
+	m.MainWindow.Show()
+}
+
+// Copies supersonic:// links to the items with the given IDs
+// to the clipboard, one per line.
+func (m *Controller) CopyLinks(kind backend.DeepLinkKind, ids []string) {
+	links := make([]string, len(ids))
+	for i, id := range ids {
+		// tracks have no page of their own, so link to playing them
+		links[i] = backend.DeepLink{Kind: kind, ID: id, Play: kind == backend.DeepLinkTrack}.String()
+	}
+	m.MainWindow.Clipboard().SetContent(strings.Join(links, "\n"))
+}
+
 func (m *Controller) ClosePopUpOnEscape(pop *widget.PopUp) {
 	m.escapablePopUp = pop
 }
@@ -118,6 +152,9 @@ func (m *Controller) ConnectTracklistActions(tracklist *widgets.Tracklist) {
 		m.ClosePopUpOnEscape(pop)
 	}
 	tracklist.OnDownload = m.ShowDownloadDialog
+	tracklist.OnCopyLink = func(trackIDs []string) {
+		m.CopyLinks(backend.DeepLinkTrack, trackIDs)
+	}
 }
 
 func (m *Controller) ConnectAlbumGridActions(grid *widgets.GridView) {
@@ -153,6 +190,9 @@ func (m *Controller) ConnectAlbumGridActions(grid *widgets.GridView) {
 			m.ShowDownloadDialog(album.Tracks, album.Name)
 		}()
 	}
+	grid.OnCopyLink = func(albumID string) {
+		m.CopyLinks(backend.DeepLinkAlbum, []string{albumID})
+	}
 }
 
 func (m *Controller) ConnectArtistGridActions(grid *widgets.GridView) {
@@ -176,6 +216,9 @@ func (m *Controller) ConnectArtistGridActions(grid *widgets.GridView) {
 			m.ShowDownloadDialog(tracks, artist.Name)
 		}()
 	}
+	grid.OnCopyLink = func(artistID string) {
+		m.CopyLinks(backend.DeepLinkArtist, []string{artistID})
+	}
 }
 
 func (m *Controller) GetArtistTracks(artistID string) []*mediaprovider.Track {
@@ -453,7 +496,7 @@ func (c *Controller) ShowSettingsDialog(themeUpdateCallbk func(), themeFiles map
 		devs = []player.AudioDevice{{Name: "auto", Description: "Autoselect device"}}
 	}
 
-	bands := c.App.Player.Equalizer().BandFrequencies()
+	bands := (&player.ISO15BandEqualizer{}).BandFrequencies()
 	dlg := dialogs.NewSettingsDialog(c.App.Config, devs, themeFiles, bands, c.MainWindow)
 	dlg.OnReplayGainSettingsChanged = func() {
 		c.App.PlaybackManager.SetReplayGainOptions(c.App.Config.ReplayGain)
@@ -462,19 +505,56 @@ func (c *Controller) ShowSettingsDialog(themeUpdateCallbk func(), themeFiles map
 		c.App.Player.SetAudioExclusive(c.App.Config.LocalPlayback.AudioExclusive)
 	}
 	dlg.OnAudioDeviceSettingChanged = func() {
-		c.App.Player.SetAudioDevice(c.App.Config.LocalPlayback.AudioDeviceName)
+		c.App.SetAudioDevice(c.App.Config.LocalPlayback.AudioDeviceName)
+	}
+	dlg.OnDeviceEqualizerProfileChanged = func() {
+		c.App.ApplyDeviceEqualizerProfile(c.App.Config.LocalPlayback.AudioDeviceName)
+	}
+	dlg.OnCrossfadeSettingChanged = func() {
+		c.App.Player.SetCrossfadeDuration(float64(c.App.Config.LocalPlayback.CrossfadeSeconds))
 	}
 	dlg.OnThemeSettingChanged = themeUpdateCallbk
+	dlg.OnVisualizerSettingChanged = func() {
+		// the Now Playing page enables the visualizer audio filter while it is shown
+		if c.CurPageFunc().Page == NowPlaying {
+			c.ReloadFunc()
+		}
+	}
+	dlg.OnSetListenBrainzToken = c.App.ListenBrainz.SetToken
+	dlg.OnClearListenBrainzToken = c.App.ListenBrainz.ClearToken
+	dlg.OnBeginLastFMAuth = c.App.LastFM.BeginAuth
+	dlg.OnCompleteLastFMAuth = c.App.LastFM.CompleteAuth
+	dlg.OnLastFMLogout = c.App.LastFM.Logout
+	dlg.OnRemoteControlSettingChanged = func() error {
+		if c.App.Config.RemoteControl.Enabled {
+			return c.App.RemoteControl.Start()
+		}
+		c.App.RemoteControl.Stop()
+		return nil
+	}
+	dlg.OnGetRemoteControlToken = c.App.RemoteControl.Token
 	dlg.OnEqualizerSettingsChanged = func() {
-		// currently we only have one equalizer type
-		eq := c.App.Player.Equalizer().(*player.ISO15BandEqualizer)
-		eq.Disabled = !c.App.Config.LocalPlayback.EqualizerEnabled
-		eq.EQPreamp = c.App.Config.LocalPlayback.EqualizerPreamp
-		copy(eq.BandGains[:], c.App.Config.LocalPlayback.GraphicEqualizerBands)
-		c.App.Player.SetEqualizer(eq)
+		c.App.Player.SetEqualizer(backend.EqualizerFromConfig(&c.App.Config.LocalPlayback))
+	}
+	if !c.watchingAudioDevices {
+		c.App.OnAudioDevicesChanged(func(devs []player.AudioDevice) {
+			// held while updating so the dialog isn't dismissed mid-update
+			c.settingsDialogLock.Lock()
+			defer c.settingsDialogLock.Unlock()
+			if d := c.settingsDialog; d != nil {
+				d.SetAudioDevices(devs)
+			}
+		})
+		c.watchingAudioDevices = true
 	}
+	c.settingsDialogLock.Lock()
+	c.settingsDialog = dlg
+	c.settingsDialogLock.Unlock()
 	pop := widget.NewModalPopUp(dlg, c.MainWindow.Canvas())
 	dlg.OnDismiss = func() {
+		c.settingsDialogLock.Lock()
+		c.settingsDialog = nil
+		c.settingsDialogLock.Unlock()
 		pop.Hide()
 		c.doModalClosed()
 	}
@@ -531,7 +611,7 @@ func (c *Controller) doModalClosed() {
 }
 
 func (c *Controller) SetTrackFavorites(trackIDs []string, favorite bool) {
-	go c.App.ServerManager.Server.SetFavorite(mediaprovider.RatingFavoriteParameters{
+	c.App.ServerManager.SetFavorite(mediaprovider.RatingFavoriteParameters{
 		TrackIDs: trackIDs,
 	}, favorite)
 
@@ -11,9 +11,11 @@ const (
 	Genre
 	Genres
 	Favorites
+	History
 	NowPlaying
 	Playlist
 	Playlists
+	Stats
 	Tracks
 )
 
@@ -53,6 +55,10 @@ func PlaylistsRoute() Route {
 	return Route{Page: Playlists}
 }
 
+func StatsRoute() Route {
+	return Route{Page: Stats}
+}
+
 func TracksRoute() Route {
 	return Route{Page: Tracks}
 }
@@ -61,6 +67,10 @@ func ArtistsRoute() Route {
 	return Route{Page: Artists}
 }
 
+func HistoryRoute() Route {
+	return Route{Page: History}
+}
+
 func NowPlayingRoute(highlightedTrackID string) Route {
 	return Route{Page: NowPlaying, Arg: highlightedTrackID}
 }
@@ -17,7 +17,9 @@ type GraphicEqualizer struct {
 	OnChanged       func(band int, gain float64)
 	OnPreampChanged func(gain float64)
 
-	container *fyne.Container
+	preampSlider *eqSlider
+	bandSliders  []*eqSlider
+	container    *fyne.Container
 }
 
 func NewGraphicEqualizer(preamp float64, bandFreqs []string, bandGains []float64) *GraphicEqualizer {
@@ -40,6 +42,7 @@ func (g *GraphicEqualizer) buildSliders(preamp float64, bands []string, bandGain
 	pre := newCaptionTextSizeLabel("Pre", fyne.TextAlignCenter)
 	preampSlider := newEQSlider()
 	preampSlider.SetValue(preamp)
+	g.preampSlider = preampSlider
 	preampSlider.OnChanged = func(f float64) {
 		if g.OnPreampChanged != nil {
 			g.OnPreampChanged(f)
@@ -52,6 +55,7 @@ func (g *GraphicEqualizer) buildSliders(preamp float64, bands []string, bandGain
 		if i < len(bandGains) {
 			s.SetValue(bandGains[i])
 		}
+		g.bandSliders = append(g.bandSliders, s)
 		s.OnChanged = func(i int) func(float64) {
 			return func(f float64) {
 				if g.OnChanged != nil {
@@ -77,6 +81,20 @@ func (g *GraphicEqualizer) buildSliders(preamp float64, bands []string, bandGain
 	)
 }
 
+// Sets the preamp and band gains shown by the sliders.
+// OnChanged and OnPreampChanged are not invoked.
+func (g *GraphicEqualizer) SetValues(preamp float64, bandGains []float64) {
+	onChanged, onPreampChanged := g.OnChanged, g.OnPreampChanged
+	g.OnChanged, g.OnPreampChanged = nil, nil
+	g.preampSlider.SetValue(preamp)
+	for i, s := range g.bandSliders {
+		if i < len(bandGains) {
+			s.SetValue(bandGains[i])
+		}
+	}
+	g.OnChanged, g.OnPreampChanged = onChanged, onPreampChanged
+}
+
 func newCaptionTextSizeLabel(text string, alignment fyne.TextAlign) *widget.RichText {
 	l := widget.NewRichTextWithText(text)
 	ts := l.Segments[0].(*widget.TextSegment)
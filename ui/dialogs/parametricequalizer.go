@@ -0,0 +1,172 @@
+package dialogs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/dweymouth/supersonic/backend"
+	"github.com/dweymouth/supersonic/player"
+	"github.com/dweymouth/supersonic/ui/widgets"
+)
+
+var (
+	parametricFilterTypes     = []player.FilterType{player.FilterTypePeak, player.FilterTypeLowShelf, player.FilterTypeHighShelf}
+	parametricFilterTypeNames = []string{"Peak", "Low shelf", "High shelf"}
+)
+
+// An editor for the bands of a parametric equalizer.
+type ParametricEqualizer struct {
+	widget.BaseWidget
+
+	OnChanged       func(bands []backend.ParametricEQBandConfig)
+	OnPreampChanged func(gain float64)
+
+	bands     []backend.ParametricEQBandConfig
+	preamp    *widget.Slider
+	bandRows  *fyne.Container
+	container *fyne.Container
+}
+
+func NewParametricEqualizer(preamp float64, bands []backend.ParametricEQBandConfig) *ParametricEqualizer {
+	p := &ParametricEqualizer{}
+	p.ExtendBaseWidget(p)
+	p.bands = make([]backend.ParametricEQBandConfig, len(bands))
+	copy(p.bands, bands)
+
+	preampLabel := widget.NewLabel(formatGain(preamp))
+	p.preamp = widget.NewSlider(-12, 12)
+	p.preamp.Step = 0.1
+	p.preamp.Value = preamp
+	p.preamp.OnChanged = func(f float64) {
+		preampLabel.SetText(formatGain(f))
+		if p.OnPreampChanged != nil {
+			p.OnPreampChanged(f)
+		}
+	}
+
+	p.bandRows = container.NewVBox()
+	p.buildBandRows()
+	addBand := widget.NewButtonWithIcon("Add band", theme.ContentAddIcon(), func() {
+		p.bands = append(p.bands, backend.ParametricEQBandConfig{
+			Type:      string(player.FilterTypePeak),
+			Frequency: 1000,
+			Q:         1,
+		})
+		p.buildBandRows()
+		p.onChanged()
+	})
+
+	header := container.NewGridWithColumns(5,
+		newCaptionTextSizeLabel("Type", fyne.TextAlignLeading),
+		newCaptionTextSizeLabel("Frequency (Hz)", fyne.TextAlignLeading),
+		newCaptionTextSizeLabel("Gain (dB)", fyne.TextAlignLeading),
+		newCaptionTextSizeLabel("Q", fyne.TextAlignLeading),
+		layout.NewSpacer(),
+	)
+	p.container = container.NewBorder(
+		container.NewBorder(nil, header, widget.NewLabel("Preamp"), preampLabel, p.preamp),
+		container.NewHBox(addBand),
+		nil, nil,
+		container.NewVScroll(p.bandRows),
+	)
+	return p
+}
+
+// Sets the preamp and the bands being edited.
+// OnChanged and OnPreampChanged are not invoked.
+func (p *ParametricEqualizer) SetBands(preamp float64, bands []backend.ParametricEQBandConfig) {
+	p.bands = make([]backend.ParametricEQBandConfig, len(bands))
+	copy(p.bands, bands)
+	onPreampChanged := p.OnPreampChanged
+	p.OnPreampChanged = nil
+	p.preamp.SetValue(preamp)
+	p.OnPreampChanged = onPreampChanged
+	p.buildBandRows()
+}
+
+func (p *ParametricEqualizer) buildBandRows() {
+	p.bandRows.RemoveAll()
+	for i := range p.bands {
+		p.bandRows.Add(p.newBandRow(i))
+	}
+	p.bandRows.Refresh()
+}
+
+func (p *ParametricEqualizer) newBandRow(i int) fyne.CanvasObject {
+	band := &p.bands[i]
+
+	typeSelect := widget.NewSelect(parametricFilterTypeNames, nil)
+	typeIdx := 0
+	for j, t := range parametricFilterTypes {
+		if string(t) == band.Type {
+			typeIdx = j
+		}
+	}
+	typeSelect.SetSelectedIndex(typeIdx)
+	typeSelect.OnChanged = func(_ string) {
+		band.Type = string(parametricFilterTypes[typeSelect.SelectedIndex()])
+		p.onChanged()
+	}
+
+	freq := newNumberEntry(false, strconv.Itoa(band.Frequency), func(f float64) {
+		band.Frequency = int(f)
+		p.onChanged()
+	})
+	gain := newNumberEntry(true, strconv.FormatFloat(band.Gain, 'f', -1, 64), func(f float64) {
+		band.Gain = f
+		p.onChanged()
+	})
+	q := newNumberEntry(false, strconv.FormatFloat(band.Q, 'f', -1, 64), func(f float64) {
+		band.Q = f
+		p.onChanged()
+	})
+	remove := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		p.bands = append(p.bands[:i], p.bands[i+1:]...)
+		p.buildBandRows()
+		p.onChanged()
+	})
+	remove.Importance = widget.LowImportance
+
+	return container.NewGridWithColumns(5, typeSelect, freq, gain, q, container.NewHBox(remove))
+}
+
+func (p *ParametricEqualizer) onChanged() {
+	if p.OnChanged != nil {
+		bands := make([]backend.ParametricEQBandConfig, len(p.bands))
+		copy(bands, p.bands)
+		p.OnChanged(bands)
+	}
+}
+
+func (p *ParametricEqualizer) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(p.container)
+}
+
+// Returns an entry which accepts decimal numbers (and negative numbers if signed),
+// and calls onChanged when the text is changed to a valid number.
+func newNumberEntry(signed bool, text string, onChanged func(float64)) *widgets.TextRestrictedEntry {
+	e := widgets.NewTextRestrictedEntry(func(curText, selText string, r rune) bool {
+		return unicode.IsDigit(r) ||
+			(r == '.' && !strings.Contains(curText, ".")) ||
+			(signed && r == '-' && (curText == "" || curText == selText))
+	})
+	e.SetMinCharWidth(5)
+	e.Text = text
+	e.OnChanged = func(s string) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			onChanged(f)
+		}
+	}
+	return e
+}
+
+func formatGain(g float64) string {
+	return fmt.Sprintf("%+0.1f dB", g)
+}
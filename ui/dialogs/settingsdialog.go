@@ -2,10 +2,14 @@ package dialogs
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"math"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -34,15 +38,41 @@ type SettingsDialog struct {
 	OnReplayGainSettingsChanged    func()
 	OnAudioExclusiveSettingChanged func()
 	OnAudioDeviceSettingChanged    func()
+	OnCrossfadeSettingChanged      func()
 	OnThemeSettingChanged          func()
+	OnVisualizerSettingChanged     func()
 	OnDismiss                      func()
 	OnEqualizerSettingsChanged     func()
+	// Invoked when the EQ preset for the current audio device is changed
+	OnDeviceEqualizerProfileChanged func()
+	// Validates and saves a ListenBrainz user token, returning the user name.
+	// Invoked from a goroutine.
+	OnSetListenBrainzToken   func(token string) (string, error)
+	OnClearListenBrainzToken func()
+	// Begins the Last.fm auth flow, returning the URL at which the user approves access.
+	// OnCompleteLastFMAuth returns the user name. Both are invoked from a goroutine.
+	OnBeginLastFMAuth    func() (*url.URL, error)
+	OnCompleteLastFMAuth func() (string, error)
+	OnLastFMLogout       func()
+	// Starts or stops the remote control API, returning an error if it fails to start.
+	OnRemoteControlSettingChanged func() error
+	// Returns the remote control API token, which is read from the keyring.
+	OnGetRemoteControlToken func() string
 
-	config       *backend.Config
+	config *backend.Config
+	// guards audioDevices and refreshing the widgets which depend on it,
+	// since SetAudioDevices is called from a background goroutine
+	devicesLock  sync.Mutex
 	audioDevices []player.AudioDevice
 	themeFiles   map[string]string // filename -> displayName
 	promptText   *widget.RichText
 
+	// update the equalizer tab and device EQ setting from the config
+	refreshEqualizer       func()
+	refreshDeviceEqualizer func()
+	// update the audio device select from audioDevices
+	refreshAudioDevices func()
+
 	content fyne.CanvasObject
 }
 
@@ -60,7 +90,7 @@ func NewSettingsDialog(
 	tabs := container.NewAppTabs(
 		s.createGeneralTab(),
 		s.createPlaybackTab(),
-		s.createEqualizerTab(equalizerBands),
+		s.createEqualizerTab(equalizerBands, window),
 		s.createExperimentalTab(window),
 	)
 	tabs.SelectIndex(s.getActiveTabNumFromConfig())
@@ -143,6 +173,17 @@ func (s *SettingsDialog) createGeneralTab() *container.TabItem {
 	})
 	systemTrayEnable.Checked = s.config.Application.EnableSystemTray
 
+	showVisualizer := widget.NewCheck("Show audio visualizer on Now Playing page", func(val bool) {
+		s.config.NowPlayingPage.ShowVisualizer = val
+		if s.OnVisualizerSettingChanged != nil {
+			s.OnVisualizerSettingChanged()
+		}
+	})
+	showVisualizer.Checked = s.config.NowPlayingPage.ShowVisualizer
+
+	trackNotifications := widget.NewCheckWithData("Show notification when the track changes",
+		binding.BindBool(&s.config.Application.ShowTrackChangeNotifications))
+
 	// Scrobble settings
 
 	twoDigitValidator := func(text, selText string, r rune) bool {
@@ -223,6 +264,8 @@ func (s *SettingsDialog) createGeneralTab() *container.TabItem {
 			widget.NewLabel("Startup page"), container.NewGridWithColumns(2, startupPage),
 		),
 		container.NewHBox(systemTrayEnable, closeToTray),
+		showVisualizer,
+		trackNotifications,
 		s.newSectionSeparator(),
 
 		widget.NewRichText(&widget.TextSegment{Text: "Scrobbling", Style: boldStyle}),
@@ -237,56 +280,328 @@ func (s *SettingsDialog) createGeneralTab() *container.TabItem {
 			durationEntry,
 			widget.NewLabel("minutes of track have been played"),
 		),
+		s.createListenBrainzSettings(),
+		s.createLastFMSettings(),
+		s.newSectionSeparator(),
+
+		widget.NewRichText(&widget.TextSegment{Text: "Discord", Style: boldStyle}),
+		s.createDiscordSettings(),
 	))
 }
 
-func (s *SettingsDialog) createPlaybackTab() *container.TabItem {
-	deviceList := make([]string, len(s.audioDevices))
-	var selIndex int
-	for i, dev := range s.audioDevices {
-		deviceList[i] = dev.Description
-		if dev.Name == s.config.LocalPlayback.AudioDeviceName {
-			selIndex = i
+func (s *SettingsDialog) createDiscordSettings() fyne.CanvasObject {
+	cfg := &s.config.Discord
+	enabledBinding := binding.BindBool(&cfg.Enabled)
+	enabled := widget.NewCheckWithData("Show current track as Discord status", enabledBinding)
+	if backend.DiscordClientID != "" {
+		return enabled
+	}
+
+	// builds without a Discord application need one to be configured
+	clientID := widget.NewEntry()
+	clientID.SetPlaceHolder("Discord application ID")
+	clientID.Text = cfg.ClientID
+	status := widget.NewLabel("")
+	updateState := func() {
+		if cfg.ClientID == "" {
+			enabledBinding.Set(false)
+			enabled.Disable()
+			status.SetText("An application ID is required")
+		} else {
+			enabled.Enable()
+			status.SetText("")
 		}
 	}
-	deviceSelect := widget.NewSelect(deviceList, nil)
-	deviceSelect.SetSelectedIndex(selIndex)
-	deviceSelect.OnChanged = func(_ string) {
-		dev := s.audioDevices[deviceSelect.SelectedIndex()]
-		s.config.LocalPlayback.AudioDeviceName = dev.Name
-		if s.OnAudioDeviceSettingChanged != nil {
-			s.OnAudioDeviceSettingChanged()
+	clientID.OnChanged = func(text string) {
+		cfg.ClientID = strings.TrimSpace(text)
+		updateState()
+	}
+	updateState()
+
+	return container.NewVBox(
+		enabled,
+		container.NewBorder(nil, nil, nil, status, clientID),
+	)
+}
+
+func (s *SettingsDialog) createLastFMSettings() fyne.CanvasObject {
+	cfg := &s.config.LastFM
+	// updated through the binding, since the backend and the
+	// auth goroutine change the setting outside of the check
+	enabledBinding := binding.BindBool(&cfg.Enabled)
+	enabled := widget.NewCheckWithData("Scrobble to Last.fm", enabledBinding)
+	syncLoved := widget.NewCheckWithData("Sync favorites with loved tracks",
+		binding.BindBool(&cfg.SyncLoved))
+	status := widget.NewLabel("")
+	var connect, complete, disconnect *widget.Button
+
+	// builds without a Last.fm API account need one to be configured
+	builtInAPIKey := backend.LastFMAPIKey != "" && backend.LastFMAPISecret != ""
+	apiKey := widget.NewEntry()
+	apiKey.SetPlaceHolder("Last.fm API key")
+	apiKey.Text = cfg.APIKey
+	apiSecret := widget.NewPasswordEntry()
+	apiSecret.SetPlaceHolder("Shared secret")
+	apiSecret.Text = cfg.APISecret
+	apiAccount := container.NewGridWithColumns(2, apiKey, apiSecret)
+	var controls *fyne.Container
+
+	updateState := func() {
+		connect.Hide()
+		complete.Hide()
+		disconnect.Hide()
+		if builtInAPIKey || cfg.Username != "" {
+			apiAccount.Hide()
+		} else {
+			apiAccount.Show()
+		}
+		if !builtInAPIKey && (cfg.APIKey == "" || cfg.APISecret == "") {
+			controls.Hide()
+			return
+		}
+		controls.Show()
+		if cfg.Username != "" {
+			status.SetText(fmt.Sprintf("Connected as %s", cfg.Username))
+			disconnect.Show()
+			enabled.Enable()
+			syncLoved.Enable()
+		} else {
+			connect.Show()
+			enabled.Disable()
+			syncLoved.Disable()
 		}
 	}
+	apiKey.OnChanged = func(text string) {
+		cfg.APIKey = strings.TrimSpace(text)
+		updateState()
+	}
+	apiSecret.OnChanged = func(text string) {
+		cfg.APISecret = strings.TrimSpace(text)
+		updateState()
+	}
+	connect = widget.NewButton("Connect...", func() {
+		if s.OnBeginLastFMAuth == nil {
+			return
+		}
+		connect.Disable()
+		go func() {
+			u, err := s.OnBeginLastFMAuth()
+			connect.Enable()
+			if err != nil {
+				status.SetText(err.Error())
+				return
+			}
+			if err := fyne.CurrentApp().OpenURL(u); err != nil {
+				status.SetText(err.Error())
+				return
+			}
+			status.SetText("Allow access in your browser, then click Done")
+			connect.Hide()
+			complete.Show()
+		}()
+	})
+	complete = widget.NewButton("Done", func() {
+		if s.OnCompleteLastFMAuth == nil {
+			return
+		}
+		complete.Disable()
+		go func() {
+			_, err := s.OnCompleteLastFMAuth()
+			complete.Enable()
+			if err != nil {
+				status.SetText(err.Error())
+				return
+			}
+			enabledBinding.Set(true)
+			updateState()
+		}()
+	})
+	disconnect = widget.NewButton("Disconnect", func() {
+		if s.OnLastFMLogout != nil {
+			s.OnLastFMLogout()
+		}
+		status.SetText("")
+		enabledBinding.Reload()
+		updateState()
+	})
+	controls = container.NewVBox(
+		container.NewHBox(enabled, syncLoved),
+		container.NewHBox(connect, complete, disconnect, status),
+	)
+	updateState()
 
-	replayGainSelect := widget.NewSelect([]string{"None", "Album", "Track"}, nil)
-	replayGainSelect.OnChanged = func(_ string) {
-		switch replayGainSelect.SelectedIndex() {
-		case 0:
-			s.config.ReplayGain.Mode = backend.ReplayGainNone
-		case 1:
-			s.config.ReplayGain.Mode = backend.ReplayGainAlbum
-		case 2:
-			s.config.ReplayGain.Mode = backend.ReplayGainTrack
+	return container.NewVBox(apiAccount, controls)
+}
+
+func (s *SettingsDialog) createListenBrainzSettings() fyne.CanvasObject {
+	cfg := &s.config.ListenBrainz
+	// updated through the binding, since the backend and the
+	// connect goroutine change the setting outside of the check
+	enabledBinding := binding.BindBool(&cfg.Enabled)
+	enabled := widget.NewCheckWithData("Submit listens to ListenBrainz", enabledBinding)
+	tokenEntry := widget.NewPasswordEntry()
+	tokenEntry.SetPlaceHolder("User token")
+	status := widget.NewLabel("")
+	var connect, disconnect *widget.Button
+
+	updateState := func() {
+		if cfg.Username != "" {
+			status.SetText(fmt.Sprintf("Connected as %s", cfg.Username))
+			tokenEntry.Hide()
+			connect.Hide()
+			disconnect.Show()
+			enabled.Enable()
+		} else {
+			tokenEntry.Show()
+			connect.Show()
+			disconnect.Hide()
+			enabled.Disable()
 		}
-		s.onReplayGainSettingsChanged()
 	}
+	connect = widget.NewButton("Connect", func() {
+		if s.OnSetListenBrainzToken == nil || tokenEntry.Text == "" {
+			return
+		}
+		connect.Disable()
+		status.SetText("Validating token...")
+		token := tokenEntry.Text
+		go func() {
+			_, err := s.OnSetListenBrainzToken(token)
+			connect.Enable()
+			if err != nil {
+				status.SetText(err.Error())
+				return
+			}
+			tokenEntry.SetText("")
+			enabledBinding.Set(true)
+			updateState()
+		}()
+	})
+	disconnect = widget.NewButton("Disconnect", func() {
+		if s.OnClearListenBrainzToken != nil {
+			s.OnClearListenBrainzToken()
+		}
+		status.SetText("")
+		enabledBinding.Reload()
+		updateState()
+	})
+	updateState()
+
+	return container.NewVBox(
+		enabled,
+		container.NewBorder(nil, nil, nil, container.NewHBox(connect, disconnect, status), tokenEntry),
+	)
+}
+
+func (s *SettingsDialog) createPlaybackTab() *container.TabItem {
+	deviceSelect := widget.NewSelect(nil, nil)
+	updateDeviceList := func() {
+		deviceList := make([]string, len(s.audioDevices))
+		var selIndex int
+		for i, dev := range s.audioDevices {
+			deviceList[i] = dev.Description
+			if dev.Name == s.config.LocalPlayback.AudioDeviceName {
+				selIndex = i
+			}
+		}
+		deviceSelect.Options = deviceList
+		// set directly to not invoke OnChanged
+		if len(deviceList) > 0 {
+			deviceSelect.Selected = deviceList[selIndex]
+		}
+		deviceSelect.Refresh()
+	}
+	updateDeviceList()
+	s.refreshAudioDevices = updateDeviceList
 
-	// set initially selected option
-	switch s.config.ReplayGain.Mode {
-	case backend.ReplayGainAlbum:
-		replayGainSelect.SetSelectedIndex(1)
-	case backend.ReplayGainTrack:
-		replayGainSelect.SetSelectedIndex(2)
-	default:
-		replayGainSelect.SetSelectedIndex(0)
+	// EQ preset to apply when switching to the selected device
+	cfg := &s.config.LocalPlayback
+	deviceEQSelect := widget.NewSelect(nil, nil)
+	deviceEQPreamp := newNumberEntry(true, "", func(f float64) {
+		if prof, ok := cfg.DeviceEqualizerProfiles[cfg.AudioDeviceName]; ok {
+			prof.Preamp = f
+			cfg.DeviceEqualizerProfiles[cfg.AudioDeviceName] = prof
+			s.onDeviceEqualizerProfileChanged()
+		}
+	})
+	deviceEQPreamp.SetMinCharWidth(3)
+	updateDeviceEQ := func() {
+		options := []string{"None"}
+		for _, p := range cfg.AllEqualizerPresets() {
+			options = append(options, p.Name)
+		}
+		deviceEQSelect.Options = options
+		if prof, ok := cfg.DeviceEqualizerProfiles[cfg.AudioDeviceName]; ok {
+			deviceEQSelect.Selected = prof.Preset
+			deviceEQPreamp.Text = strconv.FormatFloat(prof.Preamp, 'f', -1, 64)
+			deviceEQPreamp.Enable()
+		} else {
+			deviceEQSelect.Selected = options[0]
+			deviceEQPreamp.Text = ""
+			deviceEQPreamp.Disable()
+		}
+		deviceEQSelect.Refresh()
+		deviceEQPreamp.Refresh()
+	}
+	updateDeviceEQ()
+	s.refreshDeviceEqualizer = updateDeviceEQ
+	deviceEQSelect.OnChanged = func(name string) {
+		prof, hadProf := cfg.DeviceEqualizerProfiles[cfg.AudioDeviceName]
+		if deviceEQSelect.SelectedIndex() <= 0 {
+			if hadProf {
+				delete(cfg.DeviceEqualizerProfiles, cfg.AudioDeviceName)
+				updateDeviceEQ()
+			}
+			return
+		}
+		if hadProf && prof.Preset == name {
+			return
+		}
+		preset, _ := cfg.EqualizerPreset(name)
+		if cfg.DeviceEqualizerProfiles == nil {
+			cfg.DeviceEqualizerProfiles = make(map[string]backend.DeviceEqualizerProfile)
+		}
+		cfg.DeviceEqualizerProfiles[cfg.AudioDeviceName] = backend.DeviceEqualizerProfile{
+			Preset: name,
+			Preamp: preset.Preamp,
+		}
+		updateDeviceEQ()
+		s.onDeviceEqualizerProfileChanged()
+	}
+
+	deviceSelect.OnChanged = func(_ string) {
+		s.devicesLock.Lock()
+		idx := deviceSelect.SelectedIndex()
+		if idx < 0 || idx >= len(s.audioDevices) {
+			s.devicesLock.Unlock()
+			return
+		}
+		cfg.AudioDeviceName = s.audioDevices[idx].Name
+		updateDeviceEQ()
+		s.devicesLock.Unlock()
+		if s.OnAudioDeviceSettingChanged != nil {
+			s.OnAudioDeviceSettingChanged()
+		}
+		s.doRefreshEqualizer()
 	}
 
-	preampGain := widgets.NewTextRestrictedEntry(func(curText, _ string, r rune) bool {
+	targetLevel := newNumberEntry(true,
+		strconv.FormatFloat(s.config.ReplayGain.TargetLevelDB, 'f', -1, 64),
+		func(f float64) {
+			if f >= player.MinTargetLevel && f <= player.MaxTargetLevel {
+				s.config.ReplayGain.TargetLevelDB = f
+				s.onReplayGainSettingsChanged()
+			}
+		})
+	targetLevel.SetMinCharWidth(3)
+
+	// allows -9 to 9
+	oneDigitGainValidator := func(curText, _ string, r rune) bool {
 		return (curText == "" && r == '-') ||
 			(curText == "" && unicode.IsDigit(r)) ||
 			((curText == "-" || curText == "0") && unicode.IsDigit(r))
-	})
+	}
+	preampGain := widgets.NewTextRestrictedEntry(oneDigitGainValidator)
 	preampGain.SetMinCharWidth(2)
 	preampGain.OnChanged = func(text string) {
 		if f, err := strconv.ParseFloat(text, 64); err == nil {
@@ -302,23 +617,115 @@ func (s *SettingsDialog) createPlaybackTab() *container.TabItem {
 	}
 	preampGain.Text = strconv.Itoa(int(initVal))
 
+	fallbackGain := widgets.NewTextRestrictedEntry(oneDigitGainValidator)
+	fallbackGain.SetMinCharWidth(2)
+	fallbackGain.OnChanged = func(text string) {
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			s.config.ReplayGain.FallbackGainDB = f
+			s.onReplayGainSettingsChanged()
+		}
+	}
+	fallbackGain.Text = strconv.Itoa(int(math.Max(-9, math.Min(9, math.Round(s.config.ReplayGain.FallbackGainDB)))))
+
 	preventClipping := widget.NewCheck("", func(checked bool) {
 		s.config.ReplayGain.PreventClipping = checked
 		s.onReplayGainSettingsChanged()
 	})
 	preventClipping.Checked = s.config.ReplayGain.PreventClipping
 
+	// the ReplayGain settings don't apply to dynamic normalization, and vice versa
+	updateReplayGainControls := func() {
+		dynamic := s.config.ReplayGain.Mode == backend.ReplayGainDynamic
+		for _, w := range []fyne.Disableable{preampGain, fallbackGain, preventClipping} {
+			if dynamic {
+				w.Disable()
+			} else {
+				w.Enable()
+			}
+		}
+		if dynamic {
+			targetLevel.Enable()
+		} else {
+			targetLevel.Disable()
+		}
+	}
+
+	replayGainSelect := widget.NewSelect([]string{"None", "Album", "Track", "Dynamic normalization"}, nil)
+	replayGainSelect.OnChanged = func(_ string) {
+		switch replayGainSelect.SelectedIndex() {
+		case 0:
+			s.config.ReplayGain.Mode = backend.ReplayGainNone
+		case 1:
+			s.config.ReplayGain.Mode = backend.ReplayGainAlbum
+		case 2:
+			s.config.ReplayGain.Mode = backend.ReplayGainTrack
+		case 3:
+			s.config.ReplayGain.Mode = backend.ReplayGainDynamic
+		}
+		updateReplayGainControls()
+		s.onReplayGainSettingsChanged()
+	}
+
+	// set initially selected option
+	switch s.config.ReplayGain.Mode {
+	case backend.ReplayGainAlbum:
+		replayGainSelect.SetSelectedIndex(1)
+	case backend.ReplayGainTrack:
+		replayGainSelect.SetSelectedIndex(2)
+	case backend.ReplayGainDynamic:
+		replayGainSelect.SetSelectedIndex(3)
+	default:
+		replayGainSelect.SetSelectedIndex(0)
+	}
+
 	audioExclusive := widget.NewCheck("Audio exclusive mode", func(checked bool) {
 		s.config.LocalPlayback.AudioExclusive = checked
 		s.onAudioExclusiveSettingsChanged()
 	})
 	audioExclusive.Checked = s.config.LocalPlayback.AudioExclusive
 
+	crossfadeOpts := []int{0, 1, 2, 3, 4, 5, 6, 8, 10, 12}
+	crossfadeLabels := make([]string, len(crossfadeOpts))
+	for i, secs := range crossfadeOpts {
+		crossfadeLabels[i] = fmt.Sprintf("%d seconds", secs)
+	}
+	crossfadeLabels[0] = "Off"
+	crossfadeLabels[1] = "1 second"
+	crossfadeSelect := widget.NewSelect(crossfadeLabels, nil)
+	// select the option nearest to the configured time, which may
+	// not be one of the options if the config was edited by hand
+	nearest := 0
+	for i, secs := range crossfadeOpts {
+		if math.Abs(float64(secs-s.config.LocalPlayback.CrossfadeSeconds)) <
+			math.Abs(float64(crossfadeOpts[nearest]-s.config.LocalPlayback.CrossfadeSeconds)) {
+			nearest = i
+		}
+	}
+	// save the config with the selected time, taking effect on restart
+	s.config.LocalPlayback.CrossfadeSeconds = crossfadeOpts[nearest]
+	crossfadeSelect.SetSelectedIndex(nearest)
+	crossfadeSelect.OnChanged = func(_ string) {
+		s.config.LocalPlayback.CrossfadeSeconds = crossfadeOpts[crossfadeSelect.SelectedIndex()]
+		if s.OnCrossfadeSettingChanged != nil {
+			s.OnCrossfadeSettingChanged()
+		}
+	}
+
+	pauseOnRemoved := widget.NewCheckWithData("Pause playback when audio device is unplugged",
+		binding.BindBool(&s.config.LocalPlayback.PauseOnAudioDeviceRemoved))
+
+	sleepTimerFade := widget.NewCheckWithData("Fade out volume at end of sleep timer",
+		binding.BindBool(&s.config.LocalPlayback.SleepTimerFadeOut))
+
 	return container.NewTabItem("Playback", container.NewVBox(
 		container.New(&layouts.MaxPadLayout{PadTop: 5},
 			container.New(layout.NewFormLayout(),
 				widget.NewLabel("Audio device"), container.NewBorder(nil, nil, nil, util.NewHSpace(70), deviceSelect),
+				widget.NewLabel("Device EQ preset"), container.NewHBox(deviceEQSelect, widget.NewLabel("Preamp"), deviceEQPreamp, widget.NewLabel("dB")),
+				layout.NewSpacer(), container.NewHBox(pauseOnRemoved, layout.NewSpacer()),
 				layout.NewSpacer(), container.NewHBox(audioExclusive, layout.NewSpacer()),
+				widget.NewLabel("Crossfade"), container.NewHBox(crossfadeSelect, widget.NewLabel("(not applied between consecutive album tracks)")),
+				layout.NewSpacer(), container.NewHBox(sleepTimerFade, layout.NewSpacer()),
 			)),
 		s.newSectionSeparator(),
 
@@ -326,39 +733,212 @@ func (s *SettingsDialog) createPlaybackTab() *container.TabItem {
 		container.New(layout.NewFormLayout(),
 			widget.NewLabel("ReplayGain mode"), container.NewGridWithColumns(2, replayGainSelect),
 			widget.NewLabel("ReplayGain preamp"), container.NewHBox(preampGain, widget.NewLabel("dB")),
+			widget.NewLabel("Fallback gain"), container.NewHBox(fallbackGain, widget.NewLabel("dB (for tracks without ReplayGain info)")),
 			widget.NewLabel("Prevent clipping"), container.NewHBox(preventClipping, layout.NewSpacer()),
+			widget.NewLabel("Target level"), container.NewHBox(targetLevel, widget.NewLabel(fmt.Sprintf("dBFS RMS (dynamic normalization, %d to %d)",
+				int(player.MinTargetLevel), int(player.MaxTargetLevel)))),
 		),
 	))
 }
 
-func (s *SettingsDialog) createEqualizerTab(eqBands []string) *container.TabItem {
-	enabled := widget.NewCheck("Enabled", func(b bool) {
-		s.config.LocalPlayback.EqualizerEnabled = b
+func (s *SettingsDialog) createEqualizerTab(eqBands []string, window fyne.Window) *container.TabItem {
+	cfg := &s.config.LocalPlayback
+	onEqualizerSettingsChanged := func() {
 		if s.OnEqualizerSettingsChanged != nil {
 			s.OnEqualizerSettingsChanged()
 		}
+	}
+	enabled := widget.NewCheck("Enabled", func(b bool) {
+		cfg.EqualizerEnabled = b
+		onEqualizerSettingsChanged()
 	})
-	enabled.Checked = s.config.LocalPlayback.EqualizerEnabled
-	geq := NewGraphicEqualizer(s.config.LocalPlayback.EqualizerPreamp,
-		eqBands,
-		s.config.LocalPlayback.GraphicEqualizerBands)
-	debouncer := util.NewDebouncer(350*time.Millisecond, func() {
-		if s.OnEqualizerSettingsChanged != nil {
-			s.OnEqualizerSettingsChanged()
+	enabled.Checked = cfg.EqualizerEnabled
+
+	presetSelect := widget.NewSelect(nil, nil)
+	// clears the selected preset once the settings are edited
+	onEdited := func() {
+		if cfg.EqualizerPresetName != "" {
+			cfg.EqualizerPresetName = ""
+			presetSelect.ClearSelected()
 		}
-	})
+	}
+
+	geq := NewGraphicEqualizer(cfg.EqualizerPreamp,
+		eqBands,
+		cfg.GraphicEqualizerBands)
+	debouncer := util.NewDebouncer(350*time.Millisecond, onEqualizerSettingsChanged)
 	geq.OnChanged = func(b int, g float64) {
-		s.config.LocalPlayback.GraphicEqualizerBands[b] = g
+		cfg.GraphicEqualizerBands[b] = g
+		onEdited()
 		debouncer()
 	}
 	geq.OnPreampChanged = func(g float64) {
-		s.config.LocalPlayback.EqualizerPreamp = g
+		cfg.EqualizerPreamp = g
+		onEdited()
 		debouncer()
 	}
-	cont := container.NewBorder(container.NewHBox(enabled), nil, nil, nil, geq)
+	peq := NewParametricEqualizer(cfg.ParametricEqualizerPreamp,
+		cfg.ParametricEqualizerBands)
+	peq.OnChanged = func(bands []backend.ParametricEQBandConfig) {
+		cfg.ParametricEqualizerBands = bands
+		onEdited()
+		debouncer()
+	}
+	peq.OnPreampChanged = func(g float64) {
+		cfg.ParametricEqualizerPreamp = g
+		onEdited()
+		debouncer()
+	}
+
+	eqType := widget.NewSelect([]string{"Graphic", "Parametric"}, nil)
+	// updates the widgets from the config after loading a preset or import.
+	// Sets eqType.Selected directly, since SetSelected would invoke OnChanged.
+	updateEQ := func() {
+		if cfg.EqualizerType == backend.EqualizerTypeParametric {
+			eqType.Selected = eqType.Options[1]
+			peq.SetBands(cfg.ParametricEqualizerPreamp, cfg.ParametricEqualizerBands)
+			geq.Hide()
+			peq.Show()
+		} else {
+			eqType.Selected = eqType.Options[0]
+			geq.SetValues(cfg.EqualizerPreamp, cfg.GraphicEqualizerBands)
+			peq.Hide()
+			geq.Show()
+		}
+		eqType.Refresh()
+	}
+	updateEQ()
+	// only invoked when the user changes the mode
+	eqType.OnChanged = func(_ string) {
+		if eqType.SelectedIndex() == 1 {
+			cfg.EqualizerType = backend.EqualizerTypeParametric
+		} else {
+			cfg.EqualizerType = backend.EqualizerTypeGraphic
+		}
+		onEdited()
+		updateEQ()
+		onEqualizerSettingsChanged()
+	}
+
+	updatePresets := func() {
+		var names []string
+		for _, p := range cfg.AllEqualizerPresets() {
+			names = append(names, p.Name)
+		}
+		presetSelect.Options = names
+		// set directly to not invoke OnChanged
+		presetSelect.Selected = cfg.EqualizerPresetName
+		presetSelect.Refresh()
+	}
+	updatePresets()
+	s.refreshEqualizer = func() {
+		enabled.Checked = cfg.EqualizerEnabled
+		enabled.Refresh()
+		updatePresets()
+		updateEQ()
+	}
+	presetSelect.PlaceHolder = "(custom)"
+	presetSelect.OnChanged = func(name string) {
+		if p, ok := cfg.EqualizerPreset(name); ok && name != cfg.EqualizerPresetName {
+			cfg.ApplyEqualizerPreset(p)
+			updateEQ()
+			onEqualizerSettingsChanged()
+		}
+	}
+	savePreset := widget.NewButtonWithIcon("", theme.DocumentSaveIcon(), func() {
+		nameEntry := widget.NewEntry()
+		nameEntry.Text = cfg.EqualizerPresetName
+		dialog.ShowForm("Save Preset", "Save", "Cancel",
+			[]*widget.FormItem{widget.NewFormItem("Name", nameEntry)},
+			func(ok bool) {
+				if name := strings.TrimSpace(nameEntry.Text); ok && name != "" {
+					cfg.SaveEqualizerPreset(name)
+					updatePresets()
+					s.refreshDeviceEqualizer()
+				}
+			}, window)
+	})
+	deletePreset := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		if cfg.DeleteEqualizerPreset(presetSelect.Selected) {
+			updatePresets()
+			s.refreshDeviceEqualizer()
+		}
+	})
+	importEQ := widget.NewButton("Import...", func() {
+		s.doImportEqualizer(window, func() {
+			presetSelect.ClearSelected()
+			updateEQ()
+			onEqualizerSettingsChanged()
+		})
+	})
+	exportEQ := widget.NewButton("Export...", func() {
+		s.doExportEqualizer(window)
+	})
+
+	cont := container.NewBorder(
+		container.NewVBox(
+			container.NewHBox(enabled, layout.NewSpacer(), widget.NewLabel("Mode"), eqType),
+			container.NewBorder(nil, nil, widget.NewLabel("Preset"),
+				container.NewHBox(savePreset, deletePreset, importEQ, exportEQ),
+				presetSelect),
+		),
+		nil, nil, nil, container.NewMax(geq, peq))
 	return container.NewTabItem("Equalizer", cont)
 }
 
+// Shows a file dialog to import an AutoEQ / EqualizerAPO file into the current equalizer.
+func (s *SettingsDialog) doImportEqualizer(window fyne.Window, onImported func()) {
+	dlg := dialog.NewFileOpen(func(urirc fyne.URIReadCloser, err error) {
+		if err != nil || urirc == nil {
+			return
+		}
+		defer urirc.Close()
+		b, err := io.ReadAll(urirc)
+		if err == nil {
+			err = s.config.LocalPlayback.ImportEqualizer(string(b))
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error importing equalizer: %s", err.Error()), window)
+			return
+		}
+		onImported()
+	}, window)
+	dlg.SetFilter(&storage.ExtensionFileFilter{Extensions: []string{".txt"}})
+	dlg.Show()
+}
+
+// Asks for the format to export the current equalizer curve in,
+// EqualizerAPO parametric or GraphicEQ, and shows a file dialog to save it.
+func (s *SettingsDialog) doExportEqualizer(window fyne.Window) {
+	formats := []string{"EqualizerAPO parametric", "GraphicEQ"}
+	format := widget.NewRadioGroup(formats, nil)
+	format.Required = true
+	format.Selected = formats[0]
+	dialog.ShowForm("Export Equalizer", "Export...", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Format", format)},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			graphicEQ := format.Selected == formats[1]
+			dlg := dialog.NewFileSave(func(uriwc fyne.URIWriteCloser, err error) {
+				if err != nil || uriwc == nil {
+					return
+				}
+				defer uriwc.Close()
+				if _, err := io.WriteString(uriwc, s.config.LocalPlayback.ExportEqualizer(graphicEQ)); err != nil {
+					dialog.ShowError(fmt.Errorf("error exporting equalizer: %s", err.Error()), window)
+				}
+			}, window)
+			if graphicEQ {
+				dlg.SetFileName("GraphicEQ.txt")
+			} else {
+				dlg.SetFileName("ParametricEQ.txt")
+			}
+			dlg.Show()
+		}, window)
+}
+
 func (s *SettingsDialog) createExperimentalTab(window fyne.Window) *container.TabItem {
 	warningLabel := widget.NewLabel("WARNING: these settings are experimental and may " +
 		"make the application buggy or increase system resource use. " +
@@ -401,9 +981,66 @@ func (s *SettingsDialog) createExperimentalTab(window fyne.Window) *container.Ta
 			widget.NewLabel("Normal font"), container.NewBorder(nil, nil, nil, normalFontBrowse, normalFontEntry),
 			widget.NewLabel("Bold font"), container.NewBorder(nil, nil, nil, boldFontBrowse, boldFontEntry),
 		),
+		s.newSectionSeparator(),
+		widget.NewRichText(&widget.TextSegment{Text: "Remote Control API", Style: boldStyle}),
+		s.createRemoteControlSettings(window),
 	))
 }
 
+func (s *SettingsDialog) createRemoteControlSettings(window fyne.Window) fyne.CanvasObject {
+	cfg := &s.config.RemoteControl
+	status := widget.NewLabel("")
+	enabled := widget.NewCheck("Allow control by other applications over HTTP on localhost", func(checked bool) {
+		cfg.Enabled = checked
+		status.SetText("")
+		if s.OnRemoteControlSettingChanged != nil {
+			if err := s.OnRemoteControlSettingChanged(); err != nil {
+				status.SetText(fmt.Sprintf("Failed to start: %s", err.Error()))
+			}
+		}
+	})
+	enabled.Checked = cfg.Enabled
+
+	portEntry := widgets.NewTextRestrictedEntry(func(text, selText string, r rune) bool {
+		return unicode.IsDigit(r) && len(text)-len(selText) < 5
+	})
+	portEntry.SetMinCharWidth(5)
+	portEntry.Text = strconv.Itoa(cfg.Port)
+	portEntry.OnChanged = func(str string) {
+		if i, err := strconv.Atoi(str); err == nil && i > 0 && i < 65536 {
+			cfg.Port = i
+			if cfg.Enabled {
+				s.setRestartRequired()
+			}
+		}
+	}
+
+	getToken := func() string {
+		if s.OnGetRemoteControlToken == nil {
+			return ""
+		}
+		return s.OnGetRemoteControlToken()
+	}
+	// the token is only read from the keyring when the user asks for it
+	token := widget.NewLabel("••••••••")
+	token.TextStyle.Monospace = true
+	var showToken *widget.Button
+	showToken = widget.NewButtonWithIcon("", theme.VisibilityIcon(), func() {
+		token.SetText(getToken())
+		showToken.Disable()
+	})
+	copyToken := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+		window.Clipboard().SetContent(getToken())
+	})
+
+	return container.NewVBox(
+		enabled,
+		container.NewHBox(widget.NewLabel("Port"), portEntry,
+			widget.NewLabel("Token"), token, showToken, copyToken),
+		status,
+	)
+}
+
 func (s *SettingsDialog) doChooseTTFFile(window fyne.Window, entry *widget.Entry) {
 	callback := func(urirc fyne.URIReadCloser, err error) {
 		if err == nil && urirc != nil {
@@ -426,6 +1063,27 @@ func (s *SettingsDialog) ttfPathValidator(path string) error {
 	return err
 }
 
+// Updates the list of audio devices shown, eg. after a device is plugged in,
+// and the equalizer settings, which may have changed with the device.
+// Safe to call from a background goroutine.
+func (s *SettingsDialog) SetAudioDevices(devices []player.AudioDevice) {
+	s.devicesLock.Lock()
+	defer s.devicesLock.Unlock()
+	s.audioDevices = devices
+	s.refreshAudioDevices()
+	if s.refreshEqualizer != nil {
+		s.refreshEqualizer()
+	}
+}
+
+func (s *SettingsDialog) doRefreshEqualizer() {
+	s.devicesLock.Lock()
+	defer s.devicesLock.Unlock()
+	if s.refreshEqualizer != nil {
+		s.refreshEqualizer()
+	}
+}
+
 func (s *SettingsDialog) setRestartRequired() {
 	ts := s.promptText.Segments[0].(*widget.TextSegment)
 	if ts.Text != "" {
@@ -446,6 +1104,13 @@ func (s *SettingsDialog) onReplayGainSettingsChanged() {
 	}
 }
 
+func (s *SettingsDialog) onDeviceEqualizerProfileChanged() {
+	if s.OnDeviceEqualizerProfileChanged != nil {
+		s.OnDeviceEqualizerProfileChanged()
+	}
+	s.doRefreshEqualizer()
+}
+
 func (s *SettingsDialog) onAudioExclusiveSettingsChanged() {
 	if s.OnAudioExclusiveSettingChanged != nil {
 		s.OnAudioExclusiveSettingChanged()
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/20after4/configdir"
 	"github.com/dweymouth/supersonic/backend"
@@ -23,6 +24,7 @@ var (
 	ShortcutReload      = desktop.CustomShortcut{KeyName: fyne.KeyR, Modifier: os.ControlModifier}
 	ShortcutSearch      = desktop.CustomShortcut{KeyName: fyne.KeyF, Modifier: os.ControlModifier}
 	ShortcutCloseWindow = desktop.CustomShortcut{KeyName: fyne.KeyW, Modifier: os.ControlModifier}
+	ShortcutUndo        = desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: os.ControlModifier}
 
 	ShortcutNavOne   = desktop.CustomShortcut{KeyName: fyne.Key1, Modifier: os.ControlModifier}
 	ShortcutNavTwo   = desktop.CustomShortcut{KeyName: fyne.Key2, Modifier: os.ControlModifier}
@@ -31,9 +33,10 @@ var (
 	ShortcutNavFive  = desktop.CustomShortcut{KeyName: fyne.Key5, Modifier: os.ControlModifier}
 	ShortcutNavSix   = desktop.CustomShortcut{KeyName: fyne.Key6, Modifier: os.ControlModifier}
 	ShortcutNavSeven = desktop.CustomShortcut{KeyName: fyne.Key7, Modifier: os.ControlModifier}
+	ShortcutNavEight = desktop.CustomShortcut{KeyName: fyne.Key8, Modifier: os.ControlModifier}
 
 	NavShortcuts = []desktop.CustomShortcut{ShortcutNavOne, ShortcutNavTwo, ShortcutNavThree,
-		ShortcutNavFour, ShortcutNavFive, ShortcutNavSix, ShortcutNavSeven}
+		ShortcutNavFour, ShortcutNavFive, ShortcutNavSix, ShortcutNavSeven, ShortcutNavEight}
 )
 
 type MainWindow struct {
@@ -46,6 +49,7 @@ type MainWindow struct {
 	BottomPanel  *BottomPanel
 
 	theme          *theme.MyTheme
+	undoToast      *undoToast
 	haveSystemTray bool
 	container      *fyne.Container
 }
@@ -79,6 +83,9 @@ func NewMainWindow(fyneApp fyne.App, appName, displayAppName, appVersion string,
 	m.BottomPanel = NewBottomPanel(app.Player, app.PlaybackManager, m.Controller)
 	m.BottomPanel.ImageManager = app.ImageManager
 	m.container = container.NewBorder(nil, m.BottomPanel, nil, nil, m.BrowsingPane)
+	m.undoToast = newUndoToast(m.Window.Canvas(), func() float32 { return m.BottomPanel.Size().Height })
+	m.undoToast.OnUndo = m.undo
+	app.UndoManager.OnActionRecorded(m.undoToast.Show)
 	m.Window.SetContent(m.container)
 	m.Window.Resize(size)
 	app.PlaybackManager.OnSongChange(func(song, _ *mediaprovider.Track) {
@@ -88,6 +95,12 @@ func NewMainWindow(fyneApp fyne.App, appName, displayAppName, appVersion string,
 		}
 		m.Window.SetTitle(fmt.Sprintf("%s – %s · %s", song.Name, song.ArtistNames[0], displayAppName))
 	})
+	app.TrackNotifier.OnSetFavorite = func(trackID string, favorite bool) {
+		m.Controller.SetTrackFavorites([]string{trackID}, favorite)
+	}
+	app.TrackNotifier.OnFallbackNotify = func(title, content string) {
+		fyneApp.SendNotification(fyne.NewNotification(title, content))
+	}
 	app.ServerManager.OnServerConnected(func() {
 		m.BrowsingPane.EnableNavigationButtons()
 		m.Router.NavigateTo(m.StartupPage())
@@ -149,6 +162,8 @@ func (m *MainWindow) StartupPage() controller.Route {
 
 func (m *MainWindow) SetupSystemTrayMenu(appName string, fyneApp fyne.App) {
 	if desk, ok := fyneApp.(desktop.App); ok {
+		sleepTimer := fyne.NewMenuItem(sleepTimerTrayLabel(backend.SleepTimerStatus{}), nil)
+		sleepTimer.ChildMenu = newSleepTimerMenu(m.App.PlaybackManager, &m.App.Config.LocalPlayback)
 		menu := fyne.NewMenu(appName,
 			fyne.NewMenuItem("Play/Pause", func() {
 				_ = m.App.Player.PlayPause()
@@ -172,9 +187,18 @@ func (m *MainWindow) SetupSystemTrayMenu(appName string, fyneApp fyne.App) {
 				m.App.PlaybackManager.SetVolume(vol)
 			}),
 			fyne.NewMenuItemSeparator(),
+			sleepTimer,
+			fyne.NewMenuItemSeparator(),
 			fyne.NewMenuItem("Show", m.Window.Show),
 			fyne.NewMenuItem("Hide", m.Window.Hide),
 		)
+		m.App.PlaybackManager.OnSleepTimerUpdate(func(s backend.SleepTimerStatus) {
+			label := sleepTimerTrayLabel(s)
+			if label != sleepTimer.Label {
+				sleepTimer.Label = label
+				menu.Refresh()
+			}
+		})
 		desk.SetSystemTrayMenu(menu)
 		desk.SetSystemTrayIcon(res.ResAppicon256Png)
 		m.haveSystemTray = true
@@ -222,6 +246,9 @@ func (m *MainWindow) addNavigationButtons() {
 	m.BrowsingPane.AddNavigationButton(theme.TracksIcon, func() {
 		m.Router.NavigateTo(controller.TracksRoute())
 	})
+	m.BrowsingPane.AddNavigationButton(theme.HistoryIcon, func() {
+		m.Router.NavigateTo(controller.HistoryRoute())
+	})
 }
 
 func (m *MainWindow) addShortcuts() {
@@ -255,6 +282,9 @@ func (m *MainWindow) addShortcuts() {
 	m.Canvas().AddShortcut(&fyne.ShortcutSelectAll{}, func(_ fyne.Shortcut) {
 		m.BrowsingPane.SelectAll()
 	})
+	m.Canvas().AddShortcut(&ShortcutUndo, func(_ fyne.Shortcut) {
+		m.undo()
+	})
 	m.Canvas().AddShortcut(&ShortcutCloseWindow, func(_ fyne.Shortcut) {
 		if m.App.Config.Application.CloseToSystemTray && m.HaveSystemTray() {
 			m.Window.Hide()
@@ -275,10 +305,30 @@ func (m *MainWindow) addShortcuts() {
 			m.Controller.CloseEscapablePopUp()
 		case fyne.KeySpace:
 			m.App.Player.PlayPause()
+		case fyne.KeyLeftBracket:
+			m.App.PlaybackManager.SetABLoopStart()
+		case fyne.KeyRightBracket:
+			m.App.PlaybackManager.SetABLoopEnd()
+		case fyne.KeyBackslash:
+			m.App.PlaybackManager.ClearABLoop()
 		}
 	})
 }
 
+func (m *MainWindow) undo() {
+	m.undoToast.Hide()
+	// run on the UI goroutine, since undoing a queue edit reloads the play queue;
+	// undoing a playlist edit makes its server request in the background
+	if err := m.App.UndoManager.Undo(); err != nil {
+		if err != backend.ErrNothingToUndo {
+			log.Printf("error: %s", err.Error())
+			dialog.ShowError(err, m.Window)
+		}
+		return
+	}
+	m.BrowsingPane.Reload()
+}
+
 func (m *MainWindow) showSettingsDialog() {
 	m.Controller.ShowSettingsDialog(func() {
 		fyne.CurrentApp().Settings().SetTheme(m.theme)
@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/dweymouth/supersonic/backend"
+
+	"fyne.io/fyne/v2"
+)
+
+var sleepTimerTrackCounts = []int{2, 3, 5, 10}
+
+// Builds the menu to start or cancel the sleep timer.
+// Used both for the system tray and the sleep timer button in the bottom panel.
+func newSleepTimerMenu(pm *backend.PlaybackManager, conf *backend.LocalPlaybackConfig) *fyne.Menu {
+	items := make([]*fyne.MenuItem, 0, len(backend.SleepTimerPresets)+5)
+	for _, d := range backend.SleepTimerPresets {
+		d := d
+		items = append(items, fyne.NewMenuItem(fmt.Sprintf("%d minutes", int(d.Minutes())), func() {
+			pm.StartSleepTimer(d, conf.SleepTimerFadeOut)
+		}))
+	}
+
+	afterTracks := fyne.NewMenuItem("After tracks", nil)
+	afterTracks.ChildMenu = fyne.NewMenu("")
+	for _, n := range sleepTimerTrackCounts {
+		n := n
+		afterTracks.ChildMenu.Items = append(afterTracks.ChildMenu.Items,
+			fyne.NewMenuItem(fmt.Sprintf("%d tracks", n), func() {
+				pm.StopAfterTracks(n, conf.SleepTimerFadeOut)
+			}))
+	}
+
+	items = append(items,
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("End of current track", func() {
+			pm.StopAfterTracks(1, conf.SleepTimerFadeOut)
+		}),
+		afterTracks,
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Cancel sleep timer", pm.CancelSleepTimer),
+	)
+	return fyne.NewMenu("", items...)
+}
+
+// The system tray menu is rebuilt whenever its label changes,
+// so only show the remaining sleep time to minute precision.
+func sleepTimerTrayLabel(s backend.SleepTimerStatus) string {
+	switch {
+	case s.Mode == backend.SleepTimerDuration:
+		return fmt.Sprintf("Sleep timer (%d min left)", int(math.Ceil(s.Remaining.Minutes())))
+	case s.Mode == backend.SleepTimerTracks && s.TracksRemaining > 1:
+		return fmt.Sprintf("Sleep timer (%d tracks left)", s.TracksRemaining)
+	case s.Mode == backend.SleepTimerTracks:
+		return "Sleep timer (end of track)"
+	}
+	return "Sleep timer"
+}
@@ -193,6 +193,7 @@ var (
 	ShuffleIcon     fyne.Resource
 	TracksIcon      fyne.Resource
 	FilterIcon      fyne.Resource = theme.NewThemedResource(res.ResFilterSvg)
+	HistoryIcon     fyne.Resource = theme.HistoryIcon()
 	RepeatIcon      fyne.Resource = theme.NewThemedResource(res.ResRepeatSvg)
 	RepeatOneIcon   fyne.Resource = theme.NewThemedResource(res.ResRepeatoneSvg)
 )
@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const undoToastDuration = 5 * time.Second
+
+// A transient notification shown near the bottom of the window
+// after an undoable action, with a button to undo it.
+type undoToast struct {
+	OnUndo func()
+
+	canvas fyne.Canvas
+	// height of the area at the bottom of the window the toast should be shown above
+	bottomOffset func() float32
+
+	mutex     sync.Mutex
+	pop       *widget.PopUp
+	label     *widget.Label
+	hideTimer *time.Timer
+}
+
+func newUndoToast(canvas fyne.Canvas, bottomOffset func() float32) *undoToast {
+	return &undoToast{canvas: canvas, bottomOffset: bottomOffset}
+}
+
+// Shows the toast with the given description of the undoable action,
+// replacing any toast already shown.
+func (u *undoToast) Show(description string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.pop == nil {
+		u.label = widget.NewLabel("")
+		undo := widget.NewButtonWithIcon("Undo", theme.ContentUndoIcon(), func() {
+			u.Hide()
+			if u.OnUndo != nil {
+				u.OnUndo()
+			}
+		})
+		undo.Importance = widget.HighImportance
+		u.pop = widget.NewPopUp(container.NewHBox(u.label, undo), u.canvas)
+	}
+	u.label.SetText(description)
+
+	size := u.pop.MinSize()
+	canvasSize := u.canvas.Size()
+	u.pop.Resize(size)
+	u.pop.ShowAtPosition(fyne.NewPos(
+		(canvasSize.Width-size.Width)/2,
+		canvasSize.Height-u.bottomOffset()-size.Height-theme.Padding()*2,
+	))
+
+	if u.hideTimer != nil {
+		u.hideTimer.Stop()
+	}
+	u.hideTimer = time.AfterFunc(undoToastDuration, u.Hide)
+}
+
+func (u *undoToast) Hide() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.hideTimer != nil {
+		u.hideTimer.Stop()
+		u.hideTimer = nil
+	}
+	if u.pop != nil {
+		u.pop.Hide()
+	}
+}
@@ -1,6 +1,9 @@
 package widgets
 
 import (
+	"fmt"
+	"strconv"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
@@ -12,13 +15,32 @@ import (
 	"github.com/dweymouth/supersonic/ui/util"
 )
 
+// Playback speeds offered in the speed menu.
+var playbackSpeeds = []float64{0.5, 0.75, 1, 1.25, 1.5, 1.75, 2, 2.5, 3}
+
 // The "aux" controls for playback, positioned to the right
-// of the BottomPanel. Currently only volume control.
+// of the BottomPanel. Volume, loop mode, speed and sleep timer controls.
 type AuxControls struct {
 	widget.BaseWidget
 
 	VolumeControl *VolumeControl
 	loop          *miniButton
+	abLoopLabel   *widget.RichText
+
+	// Called when the user selects a playback speed.
+	OnSetSpeed func(float64)
+
+	speed    *textMiniButton
+	curSpeed float64
+
+	// Menu shown when the sleep timer button is tapped.
+	// Must be set before the button is tapped for the first time.
+	SleepTimerMenu *fyne.Menu
+
+	sleepTimer      *miniButton
+	sleepTimerLabel *widget.RichText
+
+	pendingScrobblesLabel *widget.RichText
 
 	container *fyne.Container
 }
@@ -41,18 +63,59 @@ func (b *miniButton) MinSize() fyne.Size {
 	return fyne.NewSize(24, 24)
 }
 
+// A miniButton showing text instead of an icon.
+type textMiniButton struct {
+	widget.Button
+}
+
+func newTextMiniButton(text string) *textMiniButton {
+	b := &textMiniButton{
+		Button: widget.Button{
+			Text: text,
+		},
+	}
+	b.ExtendBaseWidget(b)
+	return b
+}
+
+func (b *textMiniButton) MinSize() fyne.Size {
+	w := fyne.MeasureText(b.Text, theme.TextSize(), fyne.TextStyle{Bold: true}).Width
+	return fyne.NewSize(w+theme.Padding()*2, 24)
+}
+
 func NewAuxControls(initialVolume int) *AuxControls {
 	a := &AuxControls{
-		VolumeControl: NewVolumeControl(initialVolume),
-		loop:          newMiniButton(myTheme.RepeatIcon),
+		VolumeControl:   NewVolumeControl(initialVolume),
+		loop:            newMiniButton(myTheme.RepeatIcon),
+		abLoopLabel:     widget.NewRichTextWithText("A-B"),
+		speed:           newTextMiniButton(formatSpeed(1)),
+		curSpeed:        1,
+		sleepTimer:      newMiniButton(theme.HistoryIcon()),
+		sleepTimerLabel: widget.NewRichTextWithText(""),
+
+		pendingScrobblesLabel: widget.NewRichTextWithText(""),
 	}
+	a.sleepTimer.OnTapped = a.showSleepTimerMenu
+	a.speed.OnTapped = a.showSpeedMenu
+	ts := a.sleepTimerLabel.Segments[0].(*widget.TextSegment)
+	ts.Style.SizeName = theme.SizeNameCaptionText
+	a.sleepTimerLabel.Hidden = true
+	ts = a.abLoopLabel.Segments[0].(*widget.TextSegment)
+	ts.Style.SizeName = theme.SizeNameCaptionText
+	ts.Style.ColorName = theme.ColorNamePrimary
+	a.abLoopLabel.Hidden = true
+	ts = a.pendingScrobblesLabel.Segments[0].(*widget.TextSegment)
+	ts.Style.SizeName = theme.SizeNameCaptionText
+	ts.Style.ColorName = theme.ColorNameDisabled
+	a.pendingScrobblesLabel.Hidden = true
 	a.container = container.NewHBox(
 		layout.NewSpacer(),
 		container.NewVBox(
 			util.NewHSpace(0), // hack to move everything down a tiny bit
 			layout.NewSpacer(),
+			container.NewHBox(layout.NewSpacer(), a.pendingScrobblesLabel, util.NewHSpace(5)),
 			a.VolumeControl,
-			container.NewHBox(layout.NewSpacer(), a.loop, util.NewHSpace(5)),
+			container.NewHBox(layout.NewSpacer(), a.sleepTimerLabel, a.sleepTimer, a.speed, a.abLoopLabel, a.loop, util.NewHSpace(5)),
 			layout.NewSpacer(),
 		),
 	)
@@ -83,6 +146,100 @@ func (a *AuxControls) SetLoopMode(mode backend.LoopMode) {
 	a.loop.Refresh()
 }
 
+// Shows the state of the A-B loop, given its points in seconds
+// (negative if unset): "A-B" if the loop is active, or a dimmed "A-"
+// if only the start point is set and the loop is pending its end point.
+func (a *AuxControls) SetABLoop(loopA, loopB float64) {
+	ts := a.abLoopLabel.Segments[0].(*widget.TextSegment)
+	if loopB >= 0 {
+		ts.Text = "A-B"
+		ts.Style.ColorName = theme.ColorNamePrimary
+	} else {
+		ts.Text = "A-"
+		ts.Style.ColorName = theme.ColorNameDisabled
+	}
+	a.abLoopLabel.Hidden = loopA < 0 && loopB < 0
+	a.abLoopLabel.Refresh()
+}
+
+// Shows the number of scrobbles waiting to be submitted, or hides the indicator if none.
+func (a *AuxControls) SetPendingScrobbles(n int) {
+	ts := a.pendingScrobblesLabel.Segments[0].(*widget.TextSegment)
+	if n == 1 {
+		ts.Text = "1 scrobble pending"
+	} else {
+		ts.Text = fmt.Sprintf("%d scrobbles pending", n)
+	}
+	a.pendingScrobblesLabel.Hidden = n == 0
+	a.pendingScrobblesLabel.Refresh()
+}
+
+// Updates the sleep timer button and countdown to reflect the given status.
+func (a *AuxControls) SetSleepTimerStatus(s backend.SleepTimerStatus) {
+	ts := a.sleepTimerLabel.Segments[0].(*widget.TextSegment)
+	switch {
+	case s.Mode == backend.SleepTimerOff:
+		ts.Text = ""
+	case s.Mode == backend.SleepTimerTracks && s.TracksRemaining > 1:
+		ts.Text = fmt.Sprintf("%d tracks", s.TracksRemaining)
+	default:
+		ts.Text = util.SecondsToTimeString(s.Remaining.Seconds())
+	}
+	active := s.Mode != backend.SleepTimerOff
+	if hidden := !active; hidden != a.sleepTimerLabel.Hidden {
+		a.sleepTimerLabel.Hidden = hidden
+		if active {
+			a.sleepTimer.Importance = widget.HighImportance
+		} else {
+			a.sleepTimer.Importance = widget.MediumImportance
+		}
+		a.sleepTimer.Refresh()
+	}
+	a.sleepTimerLabel.Refresh()
+}
+
+func (a *AuxControls) showSleepTimerMenu() {
+	if a.SleepTimerMenu == nil {
+		return
+	}
+	pop := widget.NewPopUpMenu(a.SleepTimerMenu, fyne.CurrentApp().Driver().CanvasForObject(a))
+	pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(a.sleepTimer)
+	// the bottom panel is at the bottom of the window, so show the menu above the button
+	pop.ShowAtPosition(fyne.NewPos(pos.X, pos.Y-pop.MinSize().Height))
+}
+
+// Updates the speed button to show the given playback speed.
+func (a *AuxControls) SetSpeed(speed float64) {
+	a.curSpeed = speed
+	a.speed.Text = formatSpeed(speed)
+	if speed == 1 {
+		a.speed.Importance = widget.MediumImportance
+	} else {
+		a.speed.Importance = widget.HighImportance
+	}
+	a.speed.Refresh()
+}
+
+func (a *AuxControls) showSpeedMenu() {
+	items := make([]*fyne.MenuItem, len(playbackSpeeds))
+	for i, speed := range playbackSpeeds {
+		speed := speed
+		items[i] = fyne.NewMenuItem(formatSpeed(speed), func() {
+			if a.OnSetSpeed != nil {
+				a.OnSetSpeed(speed)
+			}
+		})
+		items[i].Checked = speed == a.curSpeed
+	}
+	pop := widget.NewPopUpMenu(fyne.NewMenu("", items...), fyne.CurrentApp().Driver().CanvasForObject(a))
+	pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(a.speed)
+	pop.ShowAtPosition(fyne.NewPos(pos.X, pos.Y-pop.MinSize().Height))
+}
+
+func formatSpeed(speed float64) string {
+	return strconv.FormatFloat(speed, 'f', -1, 64) + "x"
+}
+
 type volumeSlider struct {
 	widget.Slider
 
@@ -92,6 +92,7 @@ type GridViewState struct {
 	OnAddToQueue        func(id string)
 	OnAddToPlaylist     func(id string)
 	OnDownload          func(id string)
+	OnCopyLink          func(id string)
 	OnShowItemPage      func(id string)
 	OnShowSecondaryPage func(id string)
 
@@ -354,6 +355,11 @@ func (g *GridView) showContextMenu(card *GridViewItem, pos fyne.Position) {
 				if g.OnDownload != nil {
 					g.OnDownload(g.menuGridViewItemId)
 				}
+			}),
+			fyne.NewMenuItem("Copy link", func() {
+				if g.OnCopyLink != nil {
+					g.OnCopyLink(g.menuGridViewItemId)
+				}
 			})),
 			fyne.CurrentApp().Driver().CanvasForObject(g))
 	}
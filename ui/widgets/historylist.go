@@ -0,0 +1,276 @@
+package widgets
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dweymouth/supersonic/backend"
+	"github.com/dweymouth/supersonic/backend/mediaprovider"
+	"github.com/dweymouth/supersonic/sharedutil"
+	"github.com/dweymouth/supersonic/ui/layouts"
+	"github.com/dweymouth/supersonic/ui/util"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// A list of listening history entries, grouped under a header row for each day.
+type HistoryList struct {
+	widget.BaseWidget
+
+	// user action callbacks
+	OnPlayTracks     func(tracks []*mediaprovider.Track)
+	OnAddToQueue     func(tracks []*mediaprovider.Track)
+	OnShowArtistPage func(artistID string)
+	OnShowAlbumPage  func(albumID string)
+
+	rows        []historyListRow
+	selectedRow int
+
+	colLayout  *layouts.ColumnsLayout
+	hdr        *ListHeader
+	list       *widget.List
+	entryMenu  *fyne.Menu
+	dayMenu    *fyne.Menu
+	menuForRow int
+	container  *fyne.Container
+}
+
+// either a day header row (if entry == nil) or a history entry row
+type historyListRow struct {
+	day        time.Time
+	entry      *backend.HistoryEntry
+	dayEntries []*backend.HistoryEntry
+}
+
+func NewHistoryList() *HistoryList {
+	h := &HistoryList{selectedRow: -1}
+	h.ExtendBaseWidget(h)
+
+	// Played at, Title, Artist, Album, Time
+	h.colLayout = layouts.NewColumnsLayout([]float32{75, -1, -1, -1, 75})
+	h.hdr = NewListHeader([]ListColumn{
+		{Text: "Played", Alignment: fyne.TextAlignLeading},
+		{Text: "Title", Alignment: fyne.TextAlignLeading},
+		{Text: "Artist", Alignment: fyne.TextAlignLeading},
+		{Text: "Album", Alignment: fyne.TextAlignLeading},
+		{Text: "Time", Alignment: fyne.TextAlignTrailing}},
+		h.colLayout)
+	h.hdr.DisableSorting = true
+
+	h.list = widget.NewList(
+		func() int { return len(h.rows) },
+		func() fyne.CanvasObject {
+			r := newHistoryRow(h)
+			r.OnTapped = func() { h.selectRow(r.rowIdx) }
+			r.OnDoubleTapped = func() { h.playRow(r.rowIdx) }
+			return r
+		},
+		func(itemID widget.ListItemID, item fyne.CanvasObject) {
+			r := item.(*historyRow)
+			r.rowIdx = itemID
+			r.Update(&h.rows[itemID], itemID == h.selectedRow)
+		})
+	h.container = container.NewBorder(h.hdr, nil, nil, nil, h.list)
+	return h
+}
+
+// Sets the history entries to display. Entries must be ordered most recent first.
+func (h *HistoryList) SetEntries(entries []*backend.HistoryEntry) {
+	h.rows = nil
+	h.selectedRow = -1
+	var dayRow int
+	for _, e := range entries {
+		t := e.Time.Local()
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		if len(h.rows) == 0 || !h.rows[dayRow].day.Equal(day) {
+			dayRow = len(h.rows)
+			h.rows = append(h.rows, historyListRow{day: day})
+		}
+		h.rows[dayRow].dayEntries = append(h.rows[dayRow].dayEntries, e)
+		h.rows = append(h.rows, historyListRow{day: day, entry: e})
+	}
+	h.list.Refresh()
+}
+
+func (h *HistoryList) UnselectAll() {
+	h.selectedRow = -1
+	h.list.Refresh()
+}
+
+func (h *HistoryList) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(h.container)
+}
+
+// do nothing Tapped handler so that tapping the separator between rows
+// doesn't fall through to the page (which calls UnselectAll)
+func (h *HistoryList) Tapped(*fyne.PointEvent) {}
+
+func (h *HistoryList) selectRow(idx int) {
+	h.selectedRow = idx
+	h.list.Refresh()
+}
+
+// the tracks represented by the given row - either the whole day or a single entry
+func (h *HistoryList) rowTracks(idx int) []*mediaprovider.Track {
+	if idx < 0 || idx >= len(h.rows) {
+		return nil
+	}
+	row := h.rows[idx]
+	entries := row.dayEntries
+	if row.entry != nil {
+		entries = []*backend.HistoryEntry{row.entry}
+	}
+	return sharedutil.MapSlice(entries, func(e *backend.HistoryEntry) *mediaprovider.Track {
+		return e.Track()
+	})
+}
+
+func (h *HistoryList) playRow(idx int) {
+	if h.OnPlayTracks != nil {
+		if trs := h.rowTracks(idx); len(trs) > 0 {
+			h.OnPlayTracks(trs)
+		}
+	}
+}
+
+func (h *HistoryList) addRowToQueue(idx int) {
+	if h.OnAddToQueue != nil {
+		if trs := h.rowTracks(idx); len(trs) > 0 {
+			h.OnAddToQueue(trs)
+		}
+	}
+}
+
+func (h *HistoryList) onShowContextMenu(e *fyne.PointEvent, idx int) {
+	h.selectRow(idx)
+	h.menuForRow = idx
+	if h.entryMenu == nil {
+		h.entryMenu = fyne.NewMenu("",
+			fyne.NewMenuItem("Play", func() { h.playRow(h.menuForRow) }),
+			fyne.NewMenuItem("Add to queue", func() { h.addRowToQueue(h.menuForRow) }),
+			fyne.NewMenuItemSeparator(),
+			fyne.NewMenuItem("Go to album", func() {
+				if e := h.rows[h.menuForRow].entry; e != nil && e.AlbumID != "" {
+					h.onAlbumTapped(e.AlbumID)
+				}
+			}),
+			fyne.NewMenuItem("Go to artist", func() {
+				if e := h.rows[h.menuForRow].entry; e != nil && len(e.ArtistIDs) > 0 {
+					h.onArtistTapped(e.ArtistIDs[0])
+				}
+			}),
+		)
+		h.dayMenu = fyne.NewMenu("",
+			fyne.NewMenuItem("Play all", func() { h.playRow(h.menuForRow) }),
+			fyne.NewMenuItem("Add all to queue", func() { h.addRowToQueue(h.menuForRow) }),
+		)
+	}
+	menu := h.entryMenu
+	if h.rows[idx].entry == nil {
+		menu = h.dayMenu
+	}
+	widget.ShowPopUpMenuAtPosition(menu, fyne.CurrentApp().Driver().CanvasForObject(h), e.AbsolutePosition)
+}
+
+func (h *HistoryList) onArtistTapped(artistID string) {
+	if h.OnShowArtistPage != nil {
+		h.OnShowArtistPage(artistID)
+	}
+}
+
+func (h *HistoryList) onAlbumTapped(albumID string) {
+	if h.OnShowAlbumPage != nil {
+		h.OnShowAlbumPage(albumID)
+	}
+}
+
+type historyRow struct {
+	ListRowBase
+
+	historyList *HistoryList
+	rowIdx      int
+	artistID    string
+	albumID     string
+
+	dayLabel *widget.RichText
+	entryRow *fyne.Container
+	playedAt *widget.RichText
+	name     *widget.RichText
+	artist   *CustomHyperlink
+	album    *CustomHyperlink
+	dur      *widget.RichText
+}
+
+func newHistoryRow(h *HistoryList) *historyRow {
+	r := &historyRow{historyList: h}
+	r.ExtendBaseWidget(r)
+	r.dayLabel = widget.NewRichTextWithText("")
+	r.dayLabel.Segments[0].(*widget.TextSegment).Style.TextStyle.Bold = true
+	r.playedAt = newTruncatingRichText()
+	r.name = newTruncatingRichText()
+	r.artist = NewCustomHyperlink()
+	r.artist.OnTapped = func() { h.onArtistTapped(r.artistID) }
+	r.album = NewCustomHyperlink()
+	r.album.OnTapped = func() { h.onAlbumTapped(r.albumID) }
+	r.dur = newTrailingAlignRichText()
+	r.entryRow = container.New(h.colLayout, r.playedAt, r.name, r.artist, r.album, r.dur)
+	r.Content = container.NewMax(r.dayLabel, r.entryRow)
+	return r
+}
+
+func (r *historyRow) Update(row *historyListRow, selected bool) {
+	r.Selected = selected
+	isHeader := row.entry == nil
+	r.dayLabel.Hidden = !isHeader
+	r.entryRow.Hidden = isHeader
+	if isHeader {
+		r.dayLabel.Segments[0].(*widget.TextSegment).Text =
+			fmt.Sprintf("%s (%d tracks)", formatHistoryDay(row.day), len(row.dayEntries))
+		r.dayLabel.Refresh()
+		r.Refresh()
+		return
+	}
+
+	e := row.entry
+	r.artistID, r.albumID = "", e.AlbumID
+	artistName := ""
+	if len(e.ArtistIDs) > 0 {
+		r.artistID = e.ArtistIDs[0]
+	}
+	if len(e.ArtistNames) > 0 {
+		artistName = e.ArtistNames[0]
+	}
+	r.playedAt.Segments[0].(*widget.TextSegment).Text = e.Time.Local().Format("15:04")
+	r.name.Segments[0].(*widget.TextSegment).Text = e.Title
+	r.name.Segments[0].(*widget.TextSegment).Style.TextStyle.Italic = e.Skipped
+	r.artist.SetText(artistName)
+	r.artist.Disabled = r.artistID == ""
+	r.album.SetText(e.Album)
+	r.album.Disabled = r.albumID == ""
+	if e.Skipped {
+		r.dur.Segments[0].(*widget.TextSegment).Text = "Skipped"
+	} else {
+		r.dur.Segments[0].(*widget.TextSegment).Text = util.SecondsToTimeString(float64(e.Duration))
+	}
+	r.Refresh()
+}
+
+func (r *historyRow) TappedSecondary(e *fyne.PointEvent) {
+	r.historyList.onShowContextMenu(e, r.rowIdx)
+}
+
+func formatHistoryDay(day time.Time) string {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch {
+	case day.Equal(today):
+		return "Today"
+	case day.Equal(today.AddDate(0, 0, -1)):
+		return "Yesterday"
+	case day.Year() == today.Year():
+		return day.Format("Monday, January 2")
+	}
+	return day.Format("Monday, January 2, 2006")
+}
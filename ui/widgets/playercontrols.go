@@ -1,9 +1,12 @@
 package widgets
 
 import (
+	"image/color"
+
 	"github.com/dweymouth/supersonic/ui/util"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
@@ -53,10 +56,87 @@ func (t *TrackPosSlider) IsDragging() bool {
 	return t.isDragging
 }
 
+// Markers for the A-B loop points, drawn over a TrackPosSlider.
+type abLoopMarkers struct {
+	widget.BaseWidget
+
+	slider *TrackPosSlider
+	// loop points as a fraction of the track length; negative if unset
+	a, b float64
+}
+
+func newABLoopMarkers(slider *TrackPosSlider) *abLoopMarkers {
+	m := &abLoopMarkers{slider: slider, a: -1, b: -1}
+	m.ExtendBaseWidget(m)
+	return m
+}
+
+func (m *abLoopMarkers) CreateRenderer() fyne.WidgetRenderer {
+	r := &abLoopMarkersRenderer{
+		markers: m,
+		region:  canvas.NewRectangle(color.Transparent),
+		markA:   canvas.NewRectangle(color.Transparent),
+		markB:   canvas.NewRectangle(color.Transparent),
+	}
+	r.Refresh()
+	return r
+}
+
+type abLoopMarkersRenderer struct {
+	markers *abLoopMarkers
+	region  *canvas.Rectangle
+	markA   *canvas.Rectangle
+	markB   *canvas.Rectangle
+	size    fyne.Size
+}
+
+func (r *abLoopMarkersRenderer) Layout(size fyne.Size) {
+	r.size = size
+	pad := r.markers.slider.endOffset()
+	xPos := func(ratio float64) float32 {
+		return pad + float32(ratio)*(size.Width-2*pad)
+	}
+	const markW = 2
+	markH := size.Height / 2
+	markY := (size.Height - markH) / 2
+	a, b := r.markers.a, r.markers.b
+	r.markA.Move(fyne.NewPos(xPos(a)-markW/2, markY))
+	r.markA.Resize(fyne.NewSize(markW, markH))
+	r.markB.Move(fyne.NewPos(xPos(b)-markW/2, markY))
+	r.markB.Resize(fyne.NewSize(markW, markH))
+	r.region.Move(fyne.NewPos(xPos(a), markY))
+	r.region.Resize(fyne.NewSize(xPos(b)-xPos(a), markH))
+}
+
+func (r *abLoopMarkersRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(0, 0)
+}
+
+func (r *abLoopMarkersRenderer) Refresh() {
+	m := r.markers
+	r.markA.Hidden = m.a < 0
+	r.markB.Hidden = m.b < 0
+	// a lone A point is pending; mpv doesn't loop until B is set
+	r.region.Hidden = m.a < 0 || m.b < 0
+	r.markA.FillColor = theme.PrimaryColor()
+	r.markB.FillColor = theme.PrimaryColor()
+	pr, pg, pb, _ := theme.PrimaryColor().RGBA()
+	r.region.FillColor = color.NRGBA{R: uint8(pr >> 8), G: uint8(pg >> 8), B: uint8(pb >> 8), A: 60}
+	r.Layout(r.size)
+	canvas.Refresh(m)
+}
+
+func (r *abLoopMarkersRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.region, r.markA, r.markB}
+}
+
+func (r *abLoopMarkersRenderer) Destroy() {}
+
 type PlayerControls struct {
 	widget.BaseWidget
 
 	slider         *TrackPosSlider
+	abMarkers      *abLoopMarkers
 	curTimeLabel   *labelMinSize
 	totalTimeLabel *labelMinSize
 	prev           *widget.Button
@@ -65,6 +145,8 @@ type PlayerControls struct {
 	container      *fyne.Container
 
 	totalTime float64
+	// A-B loop points in seconds; negative if unset
+	abLoopA, abLoopB float64
 }
 
 var _ fyne.Widget = (*PlayerControls)(nil)
@@ -86,10 +168,11 @@ func NewLabelMinSize(text string, minWidth float32) *labelMinSize {
 
 // NewPlayerControls sets up the seek bar, and transport buttons.
 func NewPlayerControls() *PlayerControls {
-	pc := &PlayerControls{}
+	pc := &PlayerControls{abLoopA: -1, abLoopB: -1}
 	pc.ExtendBaseWidget(pc)
 
 	pc.slider = NewTrackPosSlider()
+	pc.abMarkers = newABLoopMarkers(pc.slider)
 	pc.curTimeLabel = NewLabelMinSize(util.SecondsToTimeString(0), 55)
 	pc.curTimeLabel.Alignment = fyne.TextAlignTrailing
 	pc.totalTimeLabel = NewLabelMinSize(util.SecondsToTimeString(0), 55)
@@ -109,7 +192,8 @@ func NewPlayerControls() *PlayerControls {
 	buttons := container.NewHBox(pc.prev, pc.playpause, pc.next)
 	b := container.New(layout.NewCenterLayout(), buttons)
 
-	c := container.NewBorder(nil, nil, pc.curTimeLabel, pc.totalTimeLabel, pc.slider)
+	c := container.NewBorder(nil, nil, pc.curTimeLabel, pc.totalTimeLabel,
+		container.NewMax(pc.slider, pc.abMarkers))
 	pc.container = container.NewVBox(c, b)
 
 	return pc
@@ -139,8 +223,29 @@ func (pc *PlayerControls) SetPlaying(playing bool) {
 	}
 }
 
+// Sets the A-B loop points, in seconds, to show on the seek bar.
+// Unset points are negative.
+func (pc *PlayerControls) SetABLoop(a, b float64) {
+	pc.abLoopA, pc.abLoopB = a, b
+	pc.updateABMarkers()
+}
+
+func (pc *PlayerControls) updateABMarkers() {
+	toRatio := func(t float64) float64 {
+		if t < 0 || pc.totalTime <= 0 {
+			return -1
+		}
+		return t / pc.totalTime
+	}
+	pc.abMarkers.a, pc.abMarkers.b = toRatio(pc.abLoopA), toRatio(pc.abLoopB)
+	pc.abMarkers.Refresh()
+}
+
 func (pc *PlayerControls) UpdatePlayTime(curTime, totalTime float64) {
-	pc.totalTime = totalTime
+	if totalTime != pc.totalTime {
+		pc.totalTime = totalTime
+		pc.updateABMarkers()
+	}
 	v := 0.0
 	if totalTime > 0 {
 		v = curTime / totalTime
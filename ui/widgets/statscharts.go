@@ -0,0 +1,257 @@
+package widgets
+
+import (
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// A simple vertical bar chart, with a label for the maximum value
+// and labels beneath the first and last bars.
+type BarChart struct {
+	widget.BaseWidget
+
+	Values     []float64
+	MaxLabel   string
+	StartLabel string
+	EndLabel   string
+
+	ChartHeight float32
+}
+
+func NewBarChart() *BarChart {
+	b := &BarChart{ChartHeight: 120}
+	b.ExtendBaseWidget(b)
+	return b
+}
+
+func (b *BarChart) CreateRenderer() fyne.WidgetRenderer {
+	r := &barChartRenderer{
+		chart:      b,
+		axis:       canvas.NewLine(theme.ForegroundColor()),
+		maxLabel:   canvas.NewText("", theme.ForegroundColor()),
+		startLabel: canvas.NewText("", theme.ForegroundColor()),
+		endLabel:   canvas.NewText("", theme.ForegroundColor()),
+	}
+	r.endLabel.Alignment = fyne.TextAlignTrailing
+	r.Refresh()
+	return r
+}
+
+type barChartRenderer struct {
+	chart      *BarChart
+	bars       []*canvas.Rectangle
+	axis       *canvas.Line
+	maxLabel   *canvas.Text
+	startLabel *canvas.Text
+	endLabel   *canvas.Text
+	size       fyne.Size
+}
+
+func (r *barChartRenderer) labelHeight() float32 {
+	return fyne.MeasureText("0", theme.CaptionTextSize(), fyne.TextStyle{}).Height
+}
+
+func (r *barChartRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(100, r.chart.ChartHeight+2*r.labelHeight())
+}
+
+func (r *barChartRenderer) Layout(size fyne.Size) {
+	r.size = size
+	lblH := r.labelHeight()
+	chartTop := lblH
+	chartH := size.Height - 2*lblH
+	r.maxLabel.Move(fyne.NewPos(0, 0))
+	r.startLabel.Move(fyne.NewPos(0, chartTop+chartH))
+	r.endLabel.Move(fyne.NewPos(0, chartTop+chartH))
+	r.endLabel.Resize(fyne.NewSize(size.Width, lblH))
+	r.axis.Position1 = fyne.NewPos(0, chartTop+chartH)
+	r.axis.Position2 = fyne.NewPos(size.Width, chartTop+chartH)
+
+	n := len(r.chart.Values)
+	if n == 0 {
+		return
+	}
+	max := 0.0
+	for _, v := range r.chart.Values {
+		if v > max {
+			max = v
+		}
+	}
+	slotW := size.Width / float32(n)
+	gap := fyne.Min(slotW*0.2, 2)
+	for i, bar := range r.bars {
+		h := float32(0)
+		if max > 0 {
+			h = chartH * float32(r.chart.Values[i]/max)
+		}
+		bar.Move(fyne.NewPos(float32(i)*slotW+gap/2, chartTop+chartH-h))
+		bar.Resize(fyne.NewSize(slotW-gap, h))
+	}
+}
+
+func (r *barChartRenderer) Refresh() {
+	for len(r.bars) < len(r.chart.Values) {
+		r.bars = append(r.bars, canvas.NewRectangle(color.Transparent))
+	}
+	r.bars = r.bars[:len(r.chart.Values)]
+	for _, bar := range r.bars {
+		bar.FillColor = theme.PrimaryColor()
+	}
+	for _, t := range []*canvas.Text{r.maxLabel, r.startLabel, r.endLabel} {
+		t.Color = theme.ForegroundColor()
+		t.TextSize = theme.CaptionTextSize()
+	}
+	r.maxLabel.Text = r.chart.MaxLabel
+	r.startLabel.Text = r.chart.StartLabel
+	r.endLabel.Text = r.chart.EndLabel
+	r.axis.StrokeColor = theme.DisabledColor()
+	r.Layout(r.size)
+	canvas.Refresh(r.chart)
+}
+
+func (r *barChartRenderer) Objects() []fyne.CanvasObject {
+	objs := make([]fyne.CanvasObject, 0, len(r.bars)+4)
+	for _, b := range r.bars {
+		objs = append(objs, b)
+	}
+	return append(objs, r.axis, r.maxLabel, r.startLabel, r.endLabel)
+}
+
+func (r *barChartRenderer) Destroy() {}
+
+// A grid of cells shaded according to their relative values,
+// with a label for each row and for some columns.
+type Heatmap struct {
+	widget.BaseWidget
+
+	// Values indexed by [row][column]. All rows must have the same length.
+	Values       [][]float64
+	RowLabels    []string
+	ColumnLabels []string // empty strings are not shown
+
+	CellHeight float32
+}
+
+func NewHeatmap() *Heatmap {
+	h := &Heatmap{CellHeight: 18}
+	h.ExtendBaseWidget(h)
+	return h
+}
+
+func (h *Heatmap) CreateRenderer() fyne.WidgetRenderer {
+	r := &heatmapRenderer{heatmap: h}
+	r.Refresh()
+	return r
+}
+
+type heatmapRenderer struct {
+	heatmap   *Heatmap
+	cells     [][]*canvas.Rectangle
+	rowLabels []*canvas.Text
+	colLabels []*canvas.Text
+	size      fyne.Size
+}
+
+func (r *heatmapRenderer) labelSize() fyne.Size {
+	var w float32
+	for _, l := range r.heatmap.RowLabels {
+		w = fyne.Max(w, fyne.MeasureText(l, theme.CaptionTextSize(), fyne.TextStyle{}).Width)
+	}
+	return fyne.NewSize(w+theme.Padding(), fyne.MeasureText("0", theme.CaptionTextSize(), fyne.TextStyle{}).Height)
+}
+
+func (r *heatmapRenderer) MinSize() fyne.Size {
+	lbl := r.labelSize()
+	return fyne.NewSize(lbl.Width+100, lbl.Height+r.heatmap.CellHeight*float32(len(r.heatmap.Values)))
+}
+
+func (r *heatmapRenderer) Layout(size fyne.Size) {
+	r.size = size
+	lbl := r.labelSize()
+	rows := len(r.cells)
+	if rows == 0 {
+		return
+	}
+	cols := len(r.cells[0])
+	cellW := (size.Width - lbl.Width) / float32(cols)
+	cellH := r.heatmap.CellHeight
+	for i, row := range r.cells {
+		y := lbl.Height + float32(i)*cellH
+		r.rowLabels[i].Move(fyne.NewPos(0, y+(cellH-lbl.Height)/2))
+		for j, cell := range row {
+			cell.Move(fyne.NewPos(lbl.Width+float32(j)*cellW+1, y+1))
+			cell.Resize(fyne.NewSize(cellW-2, cellH-2))
+		}
+	}
+	for j, l := range r.colLabels {
+		l.Move(fyne.NewPos(lbl.Width+float32(j)*cellW, 0))
+	}
+}
+
+func (r *heatmapRenderer) Refresh() {
+	h := r.heatmap
+	max := 0.0
+	for _, row := range h.Values {
+		for _, v := range row {
+			if v > max {
+				max = v
+			}
+		}
+	}
+	primary := theme.PrimaryColor()
+	pr, pg, pb, _ := primary.RGBA()
+	bg := theme.InputBackgroundColor()
+
+	r.cells = r.cells[:0]
+	r.rowLabels = r.rowLabels[:0]
+	for i, row := range h.Values {
+		cells := make([]*canvas.Rectangle, len(row))
+		for j, v := range row {
+			var c color.Color = bg
+			if v > 0 && max > 0 {
+				// scale alpha so that even small values are visible
+				a := uint8(40 + 215*v/max)
+				c = color.NRGBA{R: uint8(pr >> 8), G: uint8(pg >> 8), B: uint8(pb >> 8), A: a}
+			}
+			cells[j] = canvas.NewRectangle(c)
+		}
+		r.cells = append(r.cells, cells)
+		label := ""
+		if i < len(h.RowLabels) {
+			label = h.RowLabels[i]
+		}
+		t := canvas.NewText(label, theme.ForegroundColor())
+		t.TextSize = theme.CaptionTextSize()
+		r.rowLabels = append(r.rowLabels, t)
+	}
+	r.colLabels = r.colLabels[:0]
+	for _, l := range h.ColumnLabels {
+		t := canvas.NewText(l, theme.ForegroundColor())
+		t.TextSize = theme.CaptionTextSize()
+		r.colLabels = append(r.colLabels, t)
+	}
+	r.Layout(r.size)
+	canvas.Refresh(h)
+}
+
+func (r *heatmapRenderer) Objects() []fyne.CanvasObject {
+	var objs []fyne.CanvasObject
+	for _, row := range r.cells {
+		for _, c := range row {
+			objs = append(objs, c)
+		}
+	}
+	for _, l := range r.rowLabels {
+		objs = append(objs, l)
+	}
+	for _, l := range r.colLabels {
+		objs = append(objs, l)
+	}
+	return objs
+}
+
+func (r *heatmapRenderer) Destroy() {}
@@ -81,6 +81,7 @@ type Tracklist struct {
 	OnSetFavorite   func(trackIDs []string, fav bool)
 	OnSetRating     func(trackIDs []string, rating int)
 	OnDownload      func(tracks []*mediaprovider.Track, downloadName string)
+	OnCopyLink      func(trackIDs []string)
 
 	OnShowArtistPage func(artistID string)
 	OnShowAlbumPage  func(albumID string)
@@ -528,6 +529,12 @@ func (t *Tracklist) onShowContextMenu(e *fyne.PointEvent, trackIdx int) {
 			fyne.NewMenuItem("Download...", func() {
 				t.onDownload(t.selectedTracks(), "Selected tracks")
 			}))
+		t.ctxMenu.Items = append(t.ctxMenu.Items,
+			fyne.NewMenuItem("Copy link", func() {
+				if t.OnCopyLink != nil {
+					t.OnCopyLink(t.SelectedTrackIDs())
+				}
+			}))
 		t.ctxMenu.Items = append(t.ctxMenu.Items, fyne.NewMenuItemSeparator())
 		t.ctxMenu.Items = append(t.ctxMenu.Items,
 			fyne.NewMenuItem("Set favorite", func() {
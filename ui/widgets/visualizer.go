@@ -0,0 +1,185 @@
+package widgets
+
+import (
+	"image/color"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	visualizerMaxFPS = 30
+	// fraction of the full height a bar may fall per frame
+	visualizerFallRate = 0.06
+)
+
+// A spectrum visualizer which renders the levels returned by a
+// source func as vertical bars, redrawing at a capped frame rate
+// while it is running.
+type Visualizer struct {
+	widget.BaseWidget
+
+	BarsHeight float32
+
+	source func() []float64
+
+	mutex  sync.Mutex
+	levels []float64
+	stop   chan struct{}
+}
+
+// Creates a new Visualizer which gets its levels, from 0 to 1, from
+// the given func. Source may return nil when no levels are available.
+func NewVisualizer(source func() []float64) *Visualizer {
+	v := &Visualizer{source: source, BarsHeight: 60}
+	v.ExtendBaseWidget(v)
+	return v
+}
+
+// Starts periodically updating the visualizer from its source.
+func (v *Visualizer) Start() {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.stop != nil {
+		return
+	}
+	v.stop = make(chan struct{})
+	go v.run(v.stop)
+}
+
+// Stops updating the visualizer, and lets the bars fall to zero.
+func (v *Visualizer) Stop() {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.stop != nil {
+		close(v.stop)
+		v.stop = nil
+	}
+}
+
+func (v *Visualizer) run(stop chan struct{}) {
+	ticker := time.NewTicker(time.Second / visualizerMaxFPS)
+	defer ticker.Stop()
+	stopped := false
+	for {
+		select {
+		case <-stop:
+			// after Stop, keep ticking until the bars have fallen
+			stopped = true
+			stop = nil
+		case <-ticker.C:
+		}
+		var target []float64
+		if !stopped {
+			target = v.source()
+		} else if v.doneFalling() {
+			return
+		}
+		if v.update(target) && v.Visible() {
+			v.Refresh()
+		}
+	}
+}
+
+// Moves the displayed levels towards target, rising immediately and falling
+// at a limited rate. A nil target lets all bars fall. Returns true if changed.
+func (v *Visualizer) update(target []float64) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if target != nil && len(v.levels) != len(target) {
+		v.levels = make([]float64, len(target))
+	}
+	changed := false
+	for i, l := range v.levels {
+		t := 0.0
+		if target != nil {
+			t = target[i]
+		}
+		if t < l-visualizerFallRate {
+			t = l - visualizerFallRate
+		}
+		if t != l {
+			v.levels[i] = t
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Returns true if the bars have fallen to zero after Stop,
+// or if the visualizer has since been restarted.
+func (v *Visualizer) doneFalling() bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.stop != nil {
+		return true
+	}
+	for _, l := range v.levels {
+		if l > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *Visualizer) CreateRenderer() fyne.WidgetRenderer {
+	r := &visualizerRenderer{vis: v}
+	r.Refresh()
+	return r
+}
+
+type visualizerRenderer struct {
+	vis    *Visualizer
+	levels []float64
+	bars   []*canvas.Rectangle
+	size   fyne.Size
+}
+
+func (r *visualizerRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(100, r.vis.BarsHeight)
+}
+
+func (r *visualizerRenderer) Layout(size fyne.Size) {
+	r.size = size
+	n := len(r.bars)
+	if n == 0 {
+		return
+	}
+	slotW := size.Width / float32(n)
+	gap := fyne.Min(slotW*0.25, theme.Padding())
+	for i, bar := range r.bars {
+		h := size.Height * float32(r.levels[i])
+		bar.Move(fyne.NewPos(float32(i)*slotW+gap/2, size.Height-h))
+		bar.Resize(fyne.NewSize(slotW-gap, h))
+	}
+}
+
+func (r *visualizerRenderer) Refresh() {
+	r.vis.mutex.Lock()
+	r.levels = append(r.levels[:0], r.vis.levels...)
+	r.vis.mutex.Unlock()
+
+	for len(r.bars) < len(r.levels) {
+		r.bars = append(r.bars, canvas.NewRectangle(color.Transparent))
+	}
+	r.bars = r.bars[:len(r.levels)]
+	for _, bar := range r.bars {
+		bar.FillColor = theme.PrimaryColor()
+	}
+	r.Layout(r.size)
+	canvas.Refresh(r.vis)
+}
+
+func (r *visualizerRenderer) Objects() []fyne.CanvasObject {
+	objs := make([]fyne.CanvasObject, len(r.bars))
+	for i, b := range r.bars {
+		objs[i] = b
+	}
+	return objs
+}
+
+func (r *visualizerRenderer) Destroy() {}